@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"leavemaster/database"
+)
+
+// apiKeyPrefix - Semua API key diawali "lm_" supaya bisa dibedakan dari JWT
+const apiKeyPrefix = "lm_"
+
+var ErrAPIKeyInvalid = errors.New("API key is invalid or revoked")
+
+// ServiceAccountIdentity - Service account pemilik API key
+type ServiceAccountIdentity struct {
+	ID     int
+	Name   string
+	Scopes []string
+}
+
+// IsAPIKey - Bedakan API key dari JWT di header Authorization
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// GenerateAPIKey - Key baru "lm_<prefix>_<secret>"; prefix disimpan apa adanya
+// untuk identifikasi, key lengkap hanya disimpan hash-nya
+func GenerateAPIKey() (key, prefix string, err error) {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	prefix = apiKeyPrefix + hex.EncodeToString(buf)
+	return prefix + "_" + secret, prefix, nil
+}
+
+// AuthenticateAPIKey - Cari service account aktif untuk key dan catat last_used_at
+func AuthenticateAPIKey(key string) (ServiceAccountIdentity, error) {
+	var identity ServiceAccountIdentity
+	var scopes string
+	err := database.DB.QueryRow(`SELECT id, name, scopes FROM service_accounts
+		WHERE key_hash = ? AND revoked_at IS NULL`, HashToken(key)).Scan(&identity.ID, &identity.Name, &scopes)
+	if err == sql.ErrNoRows {
+		return identity, ErrAPIKeyInvalid
+	}
+	if err != nil {
+		return identity, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &identity.Scopes); err != nil {
+		return identity, err
+	}
+
+	// Cukup presisi per menit, supaya tidak menulis ke DB di setiap request
+	database.DB.Exec(`UPDATE service_accounts SET last_used_at = NOW()
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL 1 MINUTE)`, identity.ID)
+
+	return identity, nil
+}
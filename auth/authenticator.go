@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials - Password salah menurut authenticator (coba authenticator berikutnya)
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Credentials - Data login yang diperiksa authenticator
+type Credentials struct {
+	Email        string
+	Password     string
+	PasswordHash string // bcrypt hash dari employees.password
+}
+
+// Authenticator - Satu cara memverifikasi password (bcrypt lokal, LDAP bind, ...)
+type Authenticator interface {
+	Name() string
+	// Authenticate - nil kalau valid, ErrInvalidCredentials kalau salah,
+	// error lain kalau backend-nya bermasalah
+	Authenticate(creds Credentials) error
+}
+
+// LocalAuthenticator - Bandingkan dengan bcrypt hash di tabel employees
+type LocalAuthenticator struct{}
+
+func (LocalAuthenticator) Name() string { return "local" }
+
+func (LocalAuthenticator) Authenticate(creds Credentials) error {
+	if creds.PasswordHash == "" {
+		return ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(creds.PasswordHash), []byte(creds.Password)) != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// AuthenticatorChain - Urutan authenticator per domain email
+type AuthenticatorChain struct {
+	byDomain map[string][]Authenticator
+	fallback []Authenticator
+}
+
+// Authenticate - Coba authenticator satu per satu sampai ada yang menerima.
+// Return nama authenticator yang berhasil.
+func (chain *AuthenticatorChain) Authenticate(creds Credentials) (string, error) {
+	for _, authenticator := range chain.forEmail(creds.Email) {
+		err := authenticator.Authenticate(creds)
+		if err == nil {
+			return authenticator.Name(), nil
+		}
+		if err != ErrInvalidCredentials {
+			log.Printf("⚠️ Authenticator %s unavailable: %v", authenticator.Name(), err)
+		}
+	}
+	return "", ErrInvalidCredentials
+}
+
+func (chain *AuthenticatorChain) forEmail(email string) []Authenticator {
+	domain := ""
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		domain = strings.ToLower(strings.TrimSpace(email[at+1:]))
+	}
+	if authenticators, ok := chain.byDomain[domain]; ok {
+		return authenticators
+	}
+	return chain.fallback
+}
+
+// NewAuthenticatorChain - Baca env AUTH_CHAIN, contoh:
+//
+//	AUTH_CHAIN=corp.example.com:local|ldap,ad.example.com:ldap,*:local
+//
+// Domain yang tidak disebut memakai entry "*" (default: local saja).
+func NewAuthenticatorChain() *AuthenticatorChain {
+	available := map[string]Authenticator{"local": LocalAuthenticator{}}
+	if ldapAuthenticator := NewLDAPAuthenticatorFromEnv(); ldapAuthenticator != nil {
+		available["ldap"] = ldapAuthenticator
+	}
+
+	chain := &AuthenticatorChain{
+		byDomain: map[string][]Authenticator{},
+		fallback: []Authenticator{LocalAuthenticator{}},
+	}
+	for _, entry := range parseKeyList(os.Getenv("AUTH_CHAIN")) {
+		var authenticators []Authenticator
+		for _, name := range strings.Split(entry.value, "|") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			authenticator, ok := available[name]
+			if !ok {
+				log.Printf("⚠️ AUTH_CHAIN: authenticator %q for %s is not available, skipping", name, entry.kid)
+				continue
+			}
+			authenticators = append(authenticators, authenticator)
+		}
+		if len(authenticators) == 0 {
+			continue
+		}
+
+		domain := strings.ToLower(entry.kid)
+		if domain == "*" {
+			chain.fallback = authenticators
+		} else {
+			chain.byDomain[domain] = authenticators
+		}
+	}
+	return chain
+}
@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Purpose token challenge - bukan access token, ditolak oleh AuthMiddleware
+const PurposeTwoFactor = "2fa_login"
+
+var ErrChallengeInvalid = errors.New("challenge token is invalid or expired")
+
+// SignChallengeToken - Token singkat yang membuktikan langkah login sebelumnya sudah lolos
+func SignChallengeToken(employeeID int, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	return SignToken(jwt.MapClaims{
+		"employee_id": employeeID,
+		"purpose":     purpose,
+		"iat":         now.Unix(),
+		"exp":         now.Add(ttl).Unix(),
+	})
+}
+
+// ParseChallengeToken - Verifikasi token challenge dengan purpose tertentu
+func ParseChallengeToken(tokenString, purpose string) (int, error) {
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		return 0, ErrChallengeInvalid
+	}
+	if claimPurpose, _ := claims["purpose"].(string); claimPurpose != purpose {
+		return 0, ErrChallengeInvalid
+	}
+	employeeID, ok := claims["employee_id"].(float64)
+	if !ok {
+		return 0, ErrChallengeInvalid
+	}
+	return int(employeeID), nil
+}
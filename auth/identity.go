@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+// identityKey - Satu-satunya key di gin.Context untuk identitas caller
+const identityKey = "identity"
+
+// RoleServiceAccount - role_name untuk request yang memakai API key
+const RoleServiceAccount = "service_account"
+
+var ErrIncompleteClaims = errors.New("token is missing required claims")
+
+// Identity - Siapa yang memanggil request ini, sama untuk HTTP dan WebSocket.
+// Employee diisi dari claims JWT, service account dari API key.
+type Identity struct {
+	EmployeeID   int
+	RoleName     string
+	IsManager    bool
+	DepartmentID *int
+
+	ServiceAccountID   int
+	ServiceAccountName string
+	Scopes             []string
+
+	// Impersonator - Diisi kalau super_admin sedang memakai token impersonation;
+	// field lain di atas tetap milik employee target
+	Impersonator *Impersonator
+}
+
+// IsServiceAccount - Request dari integrasi (API key), bukan employee
+func (id Identity) IsServiceAccount() bool {
+	return id.ServiceAccountID != 0
+}
+
+// IsImpersonated - Request dikirim super_admin atas nama employee lain
+func (id Identity) IsImpersonated() bool {
+	return id.Impersonator != nil
+}
+
+// IdentityFromClaims - Baca identitas dari access token; claim yang hilang atau
+// tipenya salah menghasilkan ErrIncompleteClaims, bukan panic
+func IdentityFromClaims(claims jwt.MapClaims) (Identity, error) {
+	employeeID, ok := claims["employee_id"].(float64)
+	if !ok || employeeID <= 0 {
+		return Identity{}, ErrIncompleteClaims
+	}
+	roleName, _ := claims["role_name"].(string)
+	roleName = strings.ToLower(strings.TrimSpace(roleName))
+	if roleName == "" {
+		return Identity{}, ErrIncompleteClaims
+	}
+	isManager, _ := claims["is_manager"].(bool)
+
+	id := Identity{
+		EmployeeID: int(employeeID),
+		RoleName:   roleName,
+		IsManager:  isManager,
+	}
+	if departmentID, ok := claims["department_id"].(float64); ok {
+		dept := int(departmentID)
+		id.DepartmentID = &dept
+	}
+	impersonator, impersonated, err := ImpersonatorFromClaims(claims)
+	if err != nil {
+		return Identity{}, err
+	}
+	if impersonated {
+		id.Impersonator = &impersonator
+	}
+	return id, nil
+}
+
+// ServiceAccountIdentityOf - Identitas request untuk service account pemilik API key
+func ServiceAccountIdentityOf(account ServiceAccountIdentity) Identity {
+	return Identity{
+		RoleName:           RoleServiceAccount,
+		ServiceAccountID:   account.ID,
+		ServiceAccountName: account.Name,
+		Scopes:             account.Scopes,
+	}
+}
+
+// SetIdentity - Dipanggil oleh middleware setelah token/API key valid
+func SetIdentity(c *gin.Context, id Identity) {
+	c.Set(identityKey, id)
+}
+
+// CurrentIdentity - Identitas caller; ok=false kalau route tidak lewat auth middleware
+func CurrentIdentity(c *gin.Context) (Identity, bool) {
+	value, exists := c.Get(identityKey)
+	if !exists {
+		return Identity{}, false
+	}
+	id, ok := value.(Identity)
+	return id, ok
+}
+
+// CurrentEmployeeID - 0 kalau tidak ada identitas atau caller adalah service account
+func CurrentEmployeeID(c *gin.Context) int {
+	id, _ := CurrentIdentity(c)
+	return id.EmployeeID
+}
+
+// CurrentRole - role_name caller dalam lowercase, "" kalau tidak ada identitas
+func CurrentRole(c *gin.Context) string {
+	id, _ := CurrentIdentity(c)
+	return id.RoleName
+}
+
+// CurrentIsManager - Flag is_manager caller
+func CurrentIsManager(c *gin.Context) bool {
+	id, _ := CurrentIdentity(c)
+	return id.IsManager
+}
+
+// CurrentDepartmentID - Department caller, ok=false kalau tidak punya department
+func CurrentDepartmentID(c *gin.Context) (int, bool) {
+	id, _ := CurrentIdentity(c)
+	if id.DepartmentID == nil {
+		return 0, false
+	}
+	return *id.DepartmentID, true
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ClaimImpersonator - Claim berisi employee asli (super_admin) yang sedang impersonate.
+// Formatnya {"employee_id": 1, "tv": 3, "read_only": true, "jti": "..."}.
+const ClaimImpersonator = "act"
+
+// ImpersonationTTL - Umur token impersonation (env IMPERSONATION_TTL, default 15m, maksimal 1 jam).
+// Token ini tidak punya refresh token; kalau habis, super_admin harus mulai lagi.
+func ImpersonationTTL() time.Duration {
+	ttl := durationFromEnv("IMPERSONATION_TTL", 15*time.Minute)
+	if ttl > time.Hour {
+		return time.Hour
+	}
+	return ttl
+}
+
+// Impersonator - Identitas asli di balik token impersonation
+type Impersonator struct {
+	EmployeeID   int
+	TokenVersion int
+	ReadOnly     bool
+	SessionID    string
+}
+
+// AddImpersonatorClaim - Tandai access token milik target dengan actor aslinya
+func AddImpersonatorClaim(claims jwt.MapClaims, actor Impersonator) {
+	claims[ClaimImpersonator] = map[string]interface{}{
+		"employee_id": actor.EmployeeID,
+		"tv":          actor.TokenVersion,
+		"read_only":   actor.ReadOnly,
+		"jti":         actor.SessionID,
+	}
+}
+
+// ImpersonatorFromClaims - ok=false kalau token bukan token impersonation.
+// Claim "act" yang ada tapi rusak dianggap token tidak valid, bukan token biasa.
+func ImpersonatorFromClaims(claims jwt.MapClaims) (Impersonator, bool, error) {
+	raw, exists := claims[ClaimImpersonator]
+	if !exists {
+		return Impersonator{}, false, nil
+	}
+	act, ok := raw.(map[string]interface{})
+	if !ok {
+		return Impersonator{}, true, ErrIncompleteClaims
+	}
+	employeeID, ok := act["employee_id"].(float64)
+	if !ok || employeeID <= 0 {
+		return Impersonator{}, true, ErrIncompleteClaims
+	}
+	version, ok := act["tv"].(float64)
+	if !ok {
+		return Impersonator{}, true, ErrIncompleteClaims
+	}
+	// Tanpa flag read_only yang jelas, anggap read-only
+	readOnly, ok := act["read_only"].(bool)
+	if !ok {
+		readOnly = true
+	}
+	sessionID, _ := act["jti"].(string)
+	return Impersonator{
+		EmployeeID:   int(employeeID),
+		TokenVersion: int(version),
+		ReadOnly:     readOnly,
+		SessionID:    sessionID,
+	}, true, nil
+}
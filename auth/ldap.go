@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Konfigurasi LDAP/AD (env):
+//
+//	LDAP_URL              ldap://dc.example.com:389 atau ldaps://dc.example.com:636
+//	LDAP_START_TLS        "true" untuk StartTLS di koneksi ldap://
+//	LDAP_BIND_DN          service account untuk mencari user (kosong = anonymous search)
+//	LDAP_BIND_PASSWORD
+//	LDAP_BASE_DN          base DN pencarian user, contoh "ou=People,dc=example,dc=com"
+//	LDAP_USER_FILTER      filter pencarian per email (default "(mail=%s)")
+//	LDAP_SYNC_FILTER      filter untuk sync semua user (default "(mail=*)")
+//	LDAP_ATTR_EMAIL       default "mail"
+//	LDAP_ATTR_NAME        default "displayName"
+//	LDAP_ATTR_DEPARTMENT  default "department"
+//	LDAP_ATTR_MANAGER     default "manager" (berisi DN manager)
+
+// LDAPConfig - Koneksi dan atribut direktori
+type LDAPConfig struct {
+	URL            string
+	StartTLS       bool
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	UserFilter     string
+	SyncFilter     string
+	AttrEmail      string
+	AttrName       string
+	AttrDepartment string
+	AttrManager    string
+	Timeout        time.Duration
+}
+
+// LDAPConfigFromEnv - nil kalau LDAP_URL tidak diisi
+func LDAPConfigFromEnv() *LDAPConfig {
+	if os.Getenv("LDAP_URL") == "" {
+		return nil
+	}
+	return &LDAPConfig{
+		URL:            os.Getenv("LDAP_URL"),
+		StartTLS:       strings.EqualFold(os.Getenv("LDAP_START_TLS"), "true"),
+		BindDN:         os.Getenv("LDAP_BIND_DN"),
+		BindPassword:   os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:         os.Getenv("LDAP_BASE_DN"),
+		UserFilter:     envOrDefault("LDAP_USER_FILTER", "(mail=%s)"),
+		SyncFilter:     envOrDefault("LDAP_SYNC_FILTER", "(mail=*)"),
+		AttrEmail:      envOrDefault("LDAP_ATTR_EMAIL", "mail"),
+		AttrName:       envOrDefault("LDAP_ATTR_NAME", "displayName"),
+		AttrDepartment: envOrDefault("LDAP_ATTR_DEPARTMENT", "department"),
+		AttrManager:    envOrDefault("LDAP_ATTR_MANAGER", "manager"),
+		Timeout:        10 * time.Second,
+	}
+}
+
+// ldapConn - Operasi LDAP yang dipakai authenticator dan sync (dipenuhi *ldap.Conn)
+type ldapConn interface {
+	Bind(username, password string) error
+	Search(request *ldap.SearchRequest) (*ldap.SearchResult, error)
+	SearchWithPaging(request *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// dialLDAP - Bisa diganti di test supaya tidak butuh server LDAP
+var dialLDAP = func(cfg *LDAPConfig) (ldapConn, error) {
+	conn, err := ldap.DialURL(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(cfg.Timeout)
+
+	if cfg.StartTLS {
+		host := strings.TrimPrefix(strings.TrimPrefix(cfg.URL, "ldap://"), "ldaps://")
+		if i := strings.IndexAny(host, ":/"); i >= 0 {
+			host = host[:i]
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// connect - Buka koneksi dan bind sebagai service account
+func (cfg *LDAPConfig) connect() (ldapConn, error) {
+	conn, err := dialLDAP(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.BindDN != "" {
+		if err := conn.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("service bind: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// LDAPAuthenticator - Cari DN user berdasarkan email lalu bind dengan password-nya
+type LDAPAuthenticator struct {
+	config *LDAPConfig
+}
+
+func NewLDAPAuthenticatorFromEnv() *LDAPAuthenticator {
+	cfg := LDAPConfigFromEnv()
+	if cfg == nil {
+		return nil
+	}
+	return &LDAPAuthenticator{config: cfg}
+}
+
+func (a *LDAPAuthenticator) Name() string { return "ldap" }
+
+func (a *LDAPAuthenticator) Authenticate(creds Credentials) error {
+	// Password kosong = unauthenticated bind, yang di banyak server "berhasil"
+	if creds.Password == "" {
+		return ErrInvalidCredentials
+	}
+
+	conn, err := a.config.connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	filter := strings.ReplaceAll(a.config.UserFilter, "%s", ldap.EscapeFilter(creds.Email))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		filter, []string{"dn"}, nil,
+	))
+	if err != nil {
+		return fmt.Errorf("search user: %w", err)
+	}
+	if len(result.Entries) != 1 {
+		return ErrInvalidCredentials
+	}
+
+	err = conn.Bind(result.Entries[0].DN, creds.Password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return ErrInvalidCredentials
+	}
+	return err
+}
+
+// DirectoryUser - Atribut user dari direktori untuk sync ke tabel employees
+type DirectoryUser struct {
+	Email        string
+	Name         string
+	Department   string
+	ManagerEmail string
+}
+
+var ErrLDAPNotConfigured = errors.New("LDAP is not configured")
+
+// SearchDirectoryUsers - Ambil semua user (paging) dan resolve DN manager ke email
+func SearchDirectoryUsers(cfg *LDAPConfig) ([]DirectoryUser, error) {
+	if cfg == nil {
+		return nil, ErrLDAPNotConfigured
+	}
+
+	conn, err := cfg.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	result, err := conn.SearchWithPaging(ldap.NewSearchRequest(
+		cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		cfg.SyncFilter, []string{cfg.AttrEmail, cfg.AttrName, cfg.AttrDepartment, cfg.AttrManager}, nil,
+	), 500)
+	if err != nil {
+		return nil, err
+	}
+
+	emailByDN := make(map[string]string, len(result.Entries))
+	for _, entry := range result.Entries {
+		emailByDN[strings.ToLower(entry.DN)] = strings.ToLower(entry.GetAttributeValue(cfg.AttrEmail))
+	}
+
+	users := make([]DirectoryUser, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		email := strings.ToLower(strings.TrimSpace(entry.GetAttributeValue(cfg.AttrEmail)))
+		if email == "" {
+			continue
+		}
+		users = append(users, DirectoryUser{
+			Email:        email,
+			Name:         strings.TrimSpace(entry.GetAttributeValue(cfg.AttrName)),
+			Department:   strings.TrimSpace(entry.GetAttributeValue(cfg.AttrDepartment)),
+			ManagerEmail: emailByDN[strings.ToLower(entry.GetAttributeValue(cfg.AttrManager))],
+		})
+	}
+	return users, nil
+}
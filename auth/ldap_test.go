@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// fakeDirectory - Direktori di memori; filter yang didukung hanya "(attr=value)" dan "(attr=*)"
+type fakeDirectory struct {
+	entries   []*ldap.Entry
+	passwords map[string]string // DN -> password
+	binds     []string
+	closed    int
+}
+
+func (d *fakeDirectory) Bind(username, password string) error {
+	d.binds = append(d.binds, username)
+	if want, ok := d.passwords[username]; !ok || want != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	return nil
+}
+
+func (d *fakeDirectory) Search(request *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	attr, value, ok := strings.Cut(strings.Trim(request.Filter, "()"), "=")
+	if !ok {
+		return nil, ldap.NewError(ldap.LDAPResultFilterError, errors.New("unsupported filter "+request.Filter))
+	}
+	result := &ldap.SearchResult{}
+	for _, entry := range d.entries {
+		got := entry.GetAttributeValue(attr)
+		if (value == "*" && got != "") || strings.EqualFold(got, value) {
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	return result, nil
+}
+
+func (d *fakeDirectory) SearchWithPaging(request *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error) {
+	return d.Search(request)
+}
+
+func (d *fakeDirectory) Close() error {
+	d.closed++
+	return nil
+}
+
+func useFakeDirectory(t *testing.T, directory *fakeDirectory, dialErr error) {
+	original := dialLDAP
+	dialLDAP = func(cfg *LDAPConfig) (ldapConn, error) {
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		return directory, nil
+	}
+	t.Cleanup(func() { dialLDAP = original })
+}
+
+func testLDAPConfig(t *testing.T) *LDAPConfig {
+	t.Setenv("LDAP_URL", "ldap://dc.example.com:389")
+	t.Setenv("LDAP_BIND_DN", "cn=svc,dc=example,dc=com")
+	t.Setenv("LDAP_BIND_PASSWORD", "svc-secret")
+	t.Setenv("LDAP_BASE_DN", "ou=People,dc=example,dc=com")
+	return LDAPConfigFromEnv()
+}
+
+func testDirectory() *fakeDirectory {
+	return &fakeDirectory{
+		entries: []*ldap.Entry{
+			ldap.NewEntry("cn=Jane,ou=People,dc=example,dc=com", map[string][]string{
+				"mail": {"Jane@Example.com"}, "displayName": {"Jane Doe"}, "department": {"Engineering"},
+				"manager": {"CN=Boss,ou=People,dc=example,dc=com"},
+			}),
+			ldap.NewEntry("cn=Boss,ou=People,dc=example,dc=com", map[string][]string{
+				"mail": {"boss@example.com"}, "displayName": {" The Boss "},
+			}),
+			ldap.NewEntry("cn=Printer,ou=People,dc=example,dc=com", map[string][]string{
+				"displayName": {"Printer"},
+			}),
+			ldap.NewEntry("cn=Dup1,ou=People,dc=example,dc=com", map[string][]string{"mail": {"dup@example.com"}}),
+			ldap.NewEntry("cn=Dup2,ou=People,dc=example,dc=com", map[string][]string{"mail": {"dup@example.com"}}),
+		},
+		passwords: map[string]string{
+			"cn=svc,dc=example,dc=com":            "svc-secret",
+			"cn=Jane,ou=People,dc=example,dc=com": "jane-secret",
+			"cn=Dup1,ou=People,dc=example,dc=com": "dup-secret",
+		},
+	}
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	authenticator := &LDAPAuthenticator{config: testLDAPConfig(t)}
+
+	cases := []struct {
+		name     string
+		email    string
+		password string
+		want     error
+	}{
+		{"bind success", "jane@example.com", "jane-secret", nil},
+		{"wrong password", "jane@example.com", "wrong", ErrInvalidCredentials},
+		{"empty password", "jane@example.com", "", ErrInvalidCredentials},
+		{"unknown user", "nobody@example.com", "jane-secret", ErrInvalidCredentials},
+		{"ambiguous email", "dup@example.com", "dup-secret", ErrInvalidCredentials},
+	}
+	for _, tc := range cases {
+		directory := testDirectory()
+		useFakeDirectory(t, directory, nil)
+
+		err := authenticator.Authenticate(Credentials{Email: tc.email, Password: tc.password})
+		if err != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+		if tc.password != "" && (len(directory.binds) == 0 || directory.binds[0] != "cn=svc,dc=example,dc=com") {
+			t.Errorf("%s: expected service bind first, got %v", tc.name, directory.binds)
+		}
+		if tc.password != "" && directory.closed != 1 {
+			t.Errorf("%s: connection closed %d times", tc.name, directory.closed)
+		}
+	}
+}
+
+func TestLDAPAuthenticateServiceBindFailure(t *testing.T) {
+	cfg := testLDAPConfig(t)
+	cfg.BindPassword = "rotated"
+	directory := testDirectory()
+	useFakeDirectory(t, directory, nil)
+
+	err := (&LDAPAuthenticator{config: cfg}).Authenticate(Credentials{Email: "jane@example.com", Password: "jane-secret"})
+	// Service account salah adalah error konfigurasi, bukan password user yang salah
+	if err == nil || err == ErrInvalidCredentials || !strings.Contains(err.Error(), "service bind") {
+		t.Errorf("expected service bind error, got %v", err)
+	}
+	if directory.closed != 1 {
+		t.Errorf("connection closed %d times", directory.closed)
+	}
+}
+
+func TestSearchDirectoryUsers(t *testing.T) {
+	cfg := testLDAPConfig(t)
+	useFakeDirectory(t, testDirectory(), nil)
+
+	users, err := SearchDirectoryUsers(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []DirectoryUser{
+		{Email: "jane@example.com", Name: "Jane Doe", Department: "Engineering", ManagerEmail: "boss@example.com"},
+		{Email: "boss@example.com", Name: "The Boss"},
+		{Email: "dup@example.com"},
+		{Email: "dup@example.com"},
+	}
+	if !reflect.DeepEqual(users, want) {
+		t.Errorf("got %+v\nwant %+v", users, want)
+	}
+
+	if _, err := SearchDirectoryUsers(nil); err != ErrLDAPNotConfigured {
+		t.Errorf("expected ErrLDAPNotConfigured, got %v", err)
+	}
+
+	useFakeDirectory(t, nil, errors.New("connection refused"))
+	if _, err := SearchDirectoryUsers(cfg); err == nil {
+		t.Error("expected dial error")
+	}
+}
@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scope untuk key limiter login (maks 10 karakter, kolom login_attempts.scope)
+const (
+	LimitScopeAccount = "account"
+	LimitScopeIP      = "ip"
+
+	// Permintaan reset password (forgot password) dihitung terpisah dari gagal login
+	LimitScopeResetAccount = "reset_acct"
+	LimitScopeResetIP      = "reset_ip"
+)
+
+// LimitKey - Identitas yang dihitung gagal login-nya (email atau IP)
+type LimitKey struct {
+	Scope      string
+	Identifier string
+}
+
+func AccountLimitKey(email string) LimitKey {
+	return LimitKey{Scope: LimitScopeAccount, Identifier: strings.ToLower(strings.TrimSpace(email))}
+}
+
+func IPLimitKey(ip string) LimitKey {
+	return LimitKey{Scope: LimitScopeIP, Identifier: ip}
+}
+
+// PasswordResetLimitKeys - Permintaan link reset dihitung per email dan per IP
+func PasswordResetLimitKeys(email, ip string) []LimitKey {
+	return []LimitKey{
+		{Scope: LimitScopeResetAccount, Identifier: AccountLimitKey(email).Identifier},
+		{Scope: LimitScopeResetIP, Identifier: ip},
+	}
+}
+
+// LockoutStatus - Kondisi gagal login untuk satu key
+type LockoutStatus struct {
+	Scope         string     `json:"scope"`
+	Identifier    string     `json:"identifier"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	JustLocked    bool       `json:"-"` // true kalau failure ini yang memicu lockout
+}
+
+// LoginLimiter - Tracking gagal login dengan delay bertahap dan lockout sementara
+type LoginLimiter interface {
+	// RetryAfter - Berapa lama key harus menunggu sebelum boleh mencoba lagi (0 = boleh)
+	RetryAfter(key LimitKey) (time.Duration, error)
+	// RecordFailure - Catat satu kali gagal login
+	RecordFailure(key LimitKey) (LockoutStatus, error)
+	// Reset - Hapus hitungan gagal (login sukses atau unlock admin)
+	Reset(key LimitKey) error
+	// Lockouts - Semua key yang sedang terkunci
+	Lockouts() ([]LockoutStatus, error)
+}
+
+// ThrottlePolicy - Aturan delay dan lockout untuk satu scope
+type ThrottlePolicy struct {
+	FreeAttempts int           // gagal sebanyak ini belum kena delay
+	MaxFailures  int           // gagal sebanyak ini langsung lockout
+	BaseDelay    time.Duration // delay setelah FreeAttempts, dobel tiap gagal berikutnya
+	MaxDelay     time.Duration
+	Lockout      time.Duration
+	Window       time.Duration // hitungan gagal di-reset kalau tidak ada gagal selama ini
+}
+
+// attemptState - State yang disimpan limiter per key
+type attemptState struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// current - State yang sudah kadaluarsa (window lewat / lockout selesai) dianggap bersih
+func (p ThrottlePolicy) current(state attemptState, now time.Time) attemptState {
+	if !state.LockedUntil.IsZero() {
+		if now.Before(state.LockedUntil) {
+			return state
+		}
+		return attemptState{}
+	}
+	if state.Failures > 0 && now.Sub(state.LastFailure) > p.Window {
+		return attemptState{}
+	}
+	return state
+}
+
+func (p ThrottlePolicy) retryAfter(state attemptState, now time.Time) time.Duration {
+	state = p.current(state, now)
+	if !state.LockedUntil.IsZero() {
+		return state.LockedUntil.Sub(now)
+	}
+	if state.Failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := time.Duration(float64(p.BaseDelay) * math.Pow(2, float64(state.Failures-p.FreeAttempts-1)))
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+	if wait := state.LastFailure.Add(delay).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+func (p ThrottlePolicy) fail(state attemptState, now time.Time) (attemptState, bool) {
+	state = p.current(state, now)
+	state.Failures++
+	state.LastFailure = now
+
+	justLocked := false
+	if p.MaxFailures > 0 && state.Failures >= p.MaxFailures && state.LockedUntil.IsZero() {
+		state.LockedUntil = now.Add(p.Lockout)
+		justLocked = true
+	}
+	return state, justLocked
+}
+
+func (s attemptState) status(key LimitKey, justLocked bool) LockoutStatus {
+	status := LockoutStatus{
+		Scope:         key.Scope,
+		Identifier:    key.Identifier,
+		Failures:      s.Failures,
+		LastFailureAt: s.LastFailure,
+		JustLocked:    justLocked,
+	}
+	if !s.LockedUntil.IsZero() {
+		lockedUntil := s.LockedUntil
+		status.LockedUntil = &lockedUntil
+	}
+	return status
+}
+
+// DefaultThrottlePolicies - Policy per scope, bisa diatur lewat env
+func DefaultThrottlePolicies() map[string]ThrottlePolicy {
+	lockout := durationFromEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+	return map[string]ThrottlePolicy{
+		LimitScopeAccount: {
+			FreeAttempts: 3,
+			MaxFailures:  intFromEnv("LOGIN_MAX_FAILURES", 5),
+			BaseDelay:    time.Second,
+			MaxDelay:     30 * time.Second,
+			Lockout:      lockout,
+			Window:       lockout,
+		},
+		LimitScopeIP: {
+			FreeAttempts: 10,
+			MaxFailures:  intFromEnv("LOGIN_IP_MAX_FAILURES", 20),
+			BaseDelay:    time.Second,
+			MaxDelay:     30 * time.Second,
+			Lockout:      lockout,
+			Window:       lockout,
+		},
+		// Setiap permintaan forgot password dicatat sebagai "failure": dua permintaan berturut-turut
+		// boleh, setelah itu harus menunggu, dan lockout 1 jam supaya inbox dan tabel token tidak dibanjiri
+		LimitScopeResetAccount: {
+			FreeAttempts: 1,
+			MaxFailures:  intFromEnv("PASSWORD_RESET_MAX_PER_EMAIL", 5),
+			BaseDelay:    time.Minute,
+			MaxDelay:     15 * time.Minute,
+			Lockout:      time.Hour,
+			Window:       time.Hour,
+		},
+		LimitScopeResetIP: {
+			FreeAttempts: 10,
+			MaxFailures:  intFromEnv("PASSWORD_RESET_MAX_PER_IP", 30),
+			BaseDelay:    10 * time.Second,
+			MaxDelay:     5 * time.Minute,
+			Lockout:      time.Hour,
+			Window:       time.Hour,
+		},
+	}
+}
+
+func intFromEnv(key string, fallback int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		log.Printf("⚠️ Invalid %s=%q, using default %d", key, raw, fallback)
+		return fallback
+	}
+	return value
+}
+
+// NewLoginLimiter - Pilih implementasi dari env LOGIN_LIMITER: "db" (default, berlaku lintas instance) atau "memory"
+func NewLoginLimiter() LoginLimiter {
+	policies := DefaultThrottlePolicies()
+	if strings.EqualFold(os.Getenv("LOGIN_LIMITER"), "memory") {
+		log.Println("🛡️ Login limiter: in-memory")
+		return NewMemoryLimiter(policies)
+	}
+	log.Println("🛡️ Login limiter: database")
+	return NewDBLimiter(policies)
+}
+
+// MemoryLimiter - Limiter per-proses, cocok untuk single instance dan testing
+type MemoryLimiter struct {
+	policies map[string]ThrottlePolicy
+	mutex    sync.Mutex
+	states   map[LimitKey]attemptState
+	now      func() time.Time
+}
+
+func NewMemoryLimiter(policies map[string]ThrottlePolicy) *MemoryLimiter {
+	return &MemoryLimiter{
+		policies: policies,
+		states:   make(map[LimitKey]attemptState),
+		now:      time.Now,
+	}
+}
+
+func (m *MemoryLimiter) RetryAfter(key LimitKey) (time.Duration, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.policies[key.Scope].retryAfter(m.states[key], m.now()), nil
+}
+
+func (m *MemoryLimiter) RecordFailure(key LimitKey) (LockoutStatus, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state, justLocked := m.policies[key.Scope].fail(m.states[key], m.now())
+	m.states[key] = state
+	return state.status(key, justLocked), nil
+}
+
+func (m *MemoryLimiter) Reset(key LimitKey) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.states, key)
+	return nil
+}
+
+func (m *MemoryLimiter) Lockouts() ([]LockoutStatus, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	result := []LockoutStatus{}
+	for key, state := range m.states {
+		state = m.policies[key.Scope].current(state, now)
+		if state.LockedUntil.IsZero() {
+			if state.Failures == 0 {
+				delete(m.states, key)
+			}
+			continue
+		}
+		result = append(result, state.status(key, false))
+	}
+	return result, nil
+}
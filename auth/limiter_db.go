@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+
+	"leavemaster/database"
+)
+
+// DBLimiter - Limiter yang menyimpan state di tabel login_attempts, jadi berlaku lintas instance
+type DBLimiter struct {
+	policies map[string]ThrottlePolicy
+}
+
+func NewDBLimiter(policies map[string]ThrottlePolicy) *DBLimiter {
+	return &DBLimiter{policies: policies}
+}
+
+// rowQuerier - *sql.DB atau *sql.Tx
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func loadAttemptState(q rowQuerier, key LimitKey, forUpdate bool) (attemptState, error) {
+	query := `SELECT failures, last_failure_at, locked_until FROM login_attempts
+		WHERE scope = ? AND identifier = ?`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	var state attemptState
+	var lockedUntil sql.NullTime
+	err := q.QueryRow(query, key.Scope, key.Identifier).Scan(&state.Failures, &state.LastFailure, &lockedUntil)
+	if err == sql.ErrNoRows {
+		return attemptState{}, nil
+	}
+	if err != nil {
+		return attemptState{}, err
+	}
+	if lockedUntil.Valid {
+		state.LockedUntil = lockedUntil.Time
+	}
+	return state, nil
+}
+
+func (d *DBLimiter) RetryAfter(key LimitKey) (time.Duration, error) {
+	state, err := loadAttemptState(database.DB, key, false)
+	if err != nil {
+		return 0, err
+	}
+	return d.policies[key.Scope].retryAfter(state, time.Now()), nil
+}
+
+func (d *DBLimiter) RecordFailure(key LimitKey) (LockoutStatus, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return LockoutStatus{}, err
+	}
+	defer tx.Rollback()
+
+	state, err := loadAttemptState(tx, key, true)
+	if err != nil {
+		return LockoutStatus{}, err
+	}
+
+	state, justLocked := d.policies[key.Scope].fail(state, time.Now())
+
+	var lockedUntil interface{}
+	if !state.LockedUntil.IsZero() {
+		lockedUntil = state.LockedUntil
+	}
+	_, err = tx.Exec(`
+		INSERT INTO login_attempts (scope, identifier, failures, last_failure_at, locked_until)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE failures = VALUES(failures), last_failure_at = VALUES(last_failure_at),
+			locked_until = VALUES(locked_until)`,
+		key.Scope, key.Identifier, state.Failures, state.LastFailure, lockedUntil)
+	if err != nil {
+		return LockoutStatus{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return LockoutStatus{}, err
+	}
+	return state.status(key, justLocked), nil
+}
+
+func (d *DBLimiter) Reset(key LimitKey) error {
+	_, err := database.DB.Exec("DELETE FROM login_attempts WHERE scope = ? AND identifier = ?",
+		key.Scope, key.Identifier)
+	return err
+}
+
+func (d *DBLimiter) Lockouts() ([]LockoutStatus, error) {
+	rows, err := database.DB.Query(`
+		SELECT scope, identifier, failures, last_failure_at, locked_until FROM login_attempts
+		WHERE locked_until > ?
+		ORDER BY locked_until DESC`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []LockoutStatus{}
+	for rows.Next() {
+		var key LimitKey
+		var state attemptState
+		if err := rows.Scan(&key.Scope, &key.Identifier, &state.Failures, &state.LastFailure, &state.LockedUntil); err != nil {
+			return nil, err
+		}
+		result = append(result, state.status(key, false))
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func testLimiter() (*MemoryLimiter, *time.Time) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	limiter := NewMemoryLimiter(map[string]ThrottlePolicy{
+		LimitScopeAccount: {
+			FreeAttempts: 2,
+			MaxFailures:  5,
+			BaseDelay:    time.Second,
+			MaxDelay:     3 * time.Second,
+			Lockout:      15 * time.Minute,
+			Window:       15 * time.Minute,
+		},
+	})
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestMemoryLimiterBackoff(t *testing.T) {
+	limiter, now := testLimiter()
+	key := AccountLimitKey(" User@Example.com ")
+
+	// Delay mulai setelah FreeAttempts lalu dobel sampai MaxDelay
+	wantDelays := []time.Duration{0, 0, time.Second, 2 * time.Second}
+	for i, want := range wantDelays {
+		if _, err := limiter.RecordFailure(key); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := limiter.RetryAfter(key)
+		if got != want {
+			t.Errorf("after failure %d: retry after %v, want %v", i+1, got, want)
+		}
+	}
+
+	*now = now.Add(1500 * time.Millisecond)
+	if got, _ := limiter.RetryAfter(key); got != 500*time.Millisecond {
+		t.Errorf("partial wait: got %v, want 500ms", got)
+	}
+	*now = now.Add(time.Second)
+	if got, _ := limiter.RetryAfter(AccountLimitKey("user@example.com")); got != 0 {
+		t.Errorf("delay should have elapsed, got %v", got)
+	}
+}
+
+func TestMemoryLimiterLockout(t *testing.T) {
+	limiter, now := testLimiter()
+	key := AccountLimitKey("user@example.com")
+
+	for i := 1; i <= 5; i++ {
+		status, _ := limiter.RecordFailure(key)
+		if status.Failures != i {
+			t.Errorf("failure %d: counted %d", i, status.Failures)
+		}
+		if status.JustLocked != (i == 5) {
+			t.Errorf("failure %d: JustLocked = %v", i, status.JustLocked)
+		}
+	}
+
+	// Gagal lagi selama lockout tidak memperpanjang dan tidak dilaporkan sebagai lockout baru
+	*now = now.Add(time.Minute)
+	status, _ := limiter.RecordFailure(key)
+	if status.JustLocked || status.LockedUntil == nil {
+		t.Fatalf("expected existing lockout, got %+v", status)
+	}
+	if got, _ := limiter.RetryAfter(key); got != 14*time.Minute {
+		t.Errorf("retry after %v, want 14m", got)
+	}
+
+	lockouts, _ := limiter.Lockouts()
+	if len(lockouts) != 1 || lockouts[0].Identifier != "user@example.com" {
+		t.Errorf("lockouts = %+v", lockouts)
+	}
+
+	// Lockout selesai: hitungan mulai dari nol
+	*now = now.Add(14 * time.Minute)
+	if got, _ := limiter.RetryAfter(key); got != 0 {
+		t.Errorf("lockout should have expired, got %v", got)
+	}
+	status, _ = limiter.RecordFailure(key)
+	if status.Failures != 1 || status.LockedUntil != nil {
+		t.Errorf("expected fresh count after lockout, got %+v", status)
+	}
+	if lockouts, _ := limiter.Lockouts(); len(lockouts) != 0 {
+		t.Errorf("expected no lockouts, got %+v", lockouts)
+	}
+}
+
+func TestMemoryLimiterWindowAndReset(t *testing.T) {
+	limiter, now := testLimiter()
+	key := AccountLimitKey("user@example.com")
+	other := IPLimitKey("10.0.0.1")
+
+	for i := 0; i < 4; i++ {
+		limiter.RecordFailure(key)
+	}
+	*now = now.Add(16 * time.Minute)
+	if status, _ := limiter.RecordFailure(key); status.Failures != 1 {
+		t.Errorf("failures older than the window should be forgotten, got %d", status.Failures)
+	}
+
+	for i := 0; i < 4; i++ {
+		limiter.RecordFailure(key)
+	}
+	if err := limiter.Reset(key); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := limiter.RetryAfter(key); got != 0 {
+		t.Errorf("reset should clear delay, got %v", got)
+	}
+	if status, _ := limiter.RecordFailure(key); status.Failures != 1 {
+		t.Errorf("reset should clear count, got %d", status.Failures)
+	}
+
+	// Scope tanpa policy tidak pernah mengunci
+	for i := 0; i < 10; i++ {
+		limiter.RecordFailure(other)
+	}
+	if got, _ := limiter.RetryAfter(other); got != 0 {
+		t.Errorf("scope without policy should not throttle, got %v", got)
+	}
+}
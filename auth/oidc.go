@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Konfigurasi OIDC (env):
+//
+//	OIDC_ISSUER_URL        issuer IdP (discovery di /.well-known/openid-configuration)
+//	OIDC_CLIENT_ID         client id
+//	OIDC_CLIENT_SECRET     kosongkan untuk public client (PKCE saja)
+//	OIDC_REDIRECT_URL      halaman frontend yang menerima ?code&state lalu POST ke /api/auth/oidc/callback
+//	OIDC_SCOPES            default "openid email profile"
+//	OIDC_AUTO_PROVISION    "true" untuk membuat employee otomatis di login pertama
+//	OIDC_ROLE_CLAIM        claim berisi role/group IdP (default "roles")
+//	OIDC_ROLE_MAPPING      "idp-group:role_name,..." contoh "hr-admins:admin,team-leads:manager"
+//	OIDC_DEFAULT_ROLE      role untuk employee baru kalau tidak ada mapping yang cocok (default "employee")
+//	OIDC_DEPARTMENT_CLAIM  claim berisi nama department (default "department")
+
+var (
+	ErrOIDCNotConfigured = errors.New("OIDC login is not configured")
+	ErrOIDCEmailMissing  = errors.New("ID token has no verified email")
+)
+
+// OIDCIdentity - Data dari ID token yang dipakai untuk mencocokkan/membuat employee
+type OIDCIdentity struct {
+	Subject    string
+	Email      string
+	Name       string
+	Roles      []string
+	Department string
+}
+
+type oidcClient struct {
+	provider *oidc.Provider
+	verifier *oidc.IDTokenVerifier
+	config   oauth2.Config
+}
+
+var (
+	oidcMutex    sync.Mutex
+	oidcInstance *oidcClient
+)
+
+// OIDCEnabled - True kalau env OIDC minimal sudah diisi
+func OIDCEnabled() bool {
+	return os.Getenv("OIDC_ISSUER_URL") != "" && os.Getenv("OIDC_CLIENT_ID") != ""
+}
+
+// getOIDCClient - Discovery dilakukan saat pertama dipakai, bukan saat startup,
+// supaya server tetap jalan kalau IdP sedang tidak bisa dihubungi
+func getOIDCClient(ctx context.Context) (*oidcClient, error) {
+	if !OIDCEnabled() {
+		return nil, ErrOIDCNotConfigured
+	}
+
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+	if oidcInstance != nil {
+		return oidcInstance, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, os.Getenv("OIDC_ISSUER_URL"))
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %w", err)
+	}
+
+	scopes := strings.Fields(strings.ReplaceAll(os.Getenv("OIDC_SCOPES"), ",", " "))
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	oidcInstance = &oidcClient{
+		provider: provider,
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+	}
+	return oidcInstance, nil
+}
+
+// OIDCAuthorizationURL - URL ke IdP dengan state, nonce dan PKCE challenge (S256)
+func OIDCAuthorizationURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	client, err := getOIDCClient(ctx)
+	if err != nil {
+		return "", err
+	}
+	return client.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(codeVerifier)), nil
+}
+
+// NewPKCEVerifier - Code verifier PKCE (RFC 7636)
+func NewPKCEVerifier() string {
+	return oauth2.GenerateVerifier()
+}
+
+// ExchangeOIDCCode - Tukar authorization code, verifikasi ID token (issuer, audience,
+// expiry, nonce) dan ambil identitasnya
+func ExchangeOIDCCode(ctx context.Context, code, codeVerifier, nonce string) (OIDCIdentity, error) {
+	client, err := getOIDCClient(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	token, err := client.config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return OIDCIdentity{}, errors.New("token response has no id_token")
+	}
+
+	idToken, err := client.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("verify ID token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return OIDCIdentity{}, errors.New("ID token nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("decode ID token claims: %w", err)
+	}
+	return identityFromClaims(idToken.Subject, claims)
+}
+
+func identityFromClaims(subject string, claims map[string]interface{}) (OIDCIdentity, error) {
+	identity := OIDCIdentity{Subject: subject}
+
+	identity.Email, _ = claims["email"].(string)
+	identity.Email = strings.ToLower(strings.TrimSpace(identity.Email))
+	// email_verified tidak wajib ada, tapi kalau ada dan false jangan dipercaya
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		identity.Email = ""
+	}
+	if identity.Email == "" {
+		return identity, ErrOIDCEmailMissing
+	}
+
+	identity.Name, _ = claims["name"].(string)
+	if identity.Name == "" {
+		givenName, _ := claims["given_name"].(string)
+		familyName, _ := claims["family_name"].(string)
+		identity.Name = strings.TrimSpace(givenName + " " + familyName)
+	}
+	if identity.Name == "" {
+		identity.Name = identity.Email
+	}
+
+	roleClaim := envOrDefault("OIDC_ROLE_CLAIM", "roles")
+	switch value := claims[roleClaim].(type) {
+	case string:
+		identity.Roles = []string{value}
+	case []interface{}:
+		for _, item := range value {
+			if role, ok := item.(string); ok {
+				identity.Roles = append(identity.Roles, role)
+			}
+		}
+	}
+
+	identity.Department, _ = claims[envOrDefault("OIDC_DEPARTMENT_CLAIM", "department")].(string)
+	return identity, nil
+}
+
+// OIDCAutoProvision - Employee baru boleh dibuat otomatis?
+func OIDCAutoProvision() bool {
+	return strings.EqualFold(os.Getenv("OIDC_AUTO_PROVISION"), "true")
+}
+
+// OIDCRoleName - Role LeaveMaster pertama yang cocok dengan role/group dari IdP
+func OIDCRoleName(idpRoles []string) string {
+	for _, entry := range parseKeyList(os.Getenv("OIDC_ROLE_MAPPING")) {
+		for _, role := range idpRoles {
+			if strings.EqualFold(role, entry.kid) {
+				return entry.value
+			}
+		}
+	}
+	return envOrDefault("OIDC_DEFAULT_ROLE", "employee")
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
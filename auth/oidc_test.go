@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIdP - Provider OIDC minimal: discovery, JWKS dan token endpoint yang memeriksa PKCE
+type fakeIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mutex sync.Mutex
+	codes map[string]fakeGrant
+}
+
+type fakeGrant struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &fakeIdP{t: t, key: key, codes: map[string]fakeGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "test", "alg": "RS256", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// grant - Daftarkan authorization code untuk challenge PKCE dari URL login
+func (idp *fakeIdP) grant(code, challenge string, claims map[string]interface{}) {
+	idp.mutex.Lock()
+	defer idp.mutex.Unlock()
+	idp.codes[code] = fakeGrant{challenge: challenge, claims: claims}
+}
+
+func (idp *fakeIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idp.mutex.Lock()
+	grant, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mutex.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss": idp.server.URL,
+		"aud": "leavemaster",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range grant.claims {
+		claims[k] = v
+	}
+	writeJSON(w, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idp.sign(claims),
+	})
+}
+
+func (idp *fakeIdP) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// useFakeIdP - Arahkan konfigurasi OIDC ke fake IdP dan buang client hasil discovery sebelumnya
+func useFakeIdP(t *testing.T) *fakeIdP {
+	idp := newFakeIdP(t)
+	t.Setenv("OIDC_ISSUER_URL", idp.server.URL)
+	t.Setenv("OIDC_CLIENT_ID", "leavemaster")
+	t.Setenv("OIDC_CLIENT_SECRET", "")
+	t.Setenv("OIDC_REDIRECT_URL", "http://localhost:3000/sso/callback")
+	t.Setenv("OIDC_SCOPES", "")
+
+	resetOIDCClient := func() {
+		oidcMutex.Lock()
+		oidcInstance = nil
+		oidcMutex.Unlock()
+	}
+	resetOIDCClient()
+	t.Cleanup(resetOIDCClient)
+	return idp
+}
+
+// startLogin - Buat URL login lalu ambil parameter yang dikirim ke IdP
+func startLogin(t *testing.T, state, nonce, verifier string) url.Values {
+	t.Helper()
+	authURL, err := OIDCAuthorizationURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("authorization URL: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Query()
+}
+
+func TestOIDCDiscoveryAndAuthorizationURL(t *testing.T) {
+	idp := useFakeIdP(t)
+
+	authURL, err := OIDCAuthorizationURL(context.Background(), "state-1", "nonce-1", NewPKCEVerifier())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+		t.Errorf("authorization URL %q does not use the discovered endpoint", authURL)
+	}
+
+	query := startLogin(t, "state-1", "nonce-1", NewPKCEVerifier())
+	want := map[string]string{
+		"client_id":             "leavemaster",
+		"response_type":         "code",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge_method": "S256",
+		"redirect_uri":          "http://localhost:3000/sso/callback",
+		"scope":                 "openid email profile",
+	}
+	for key, value := range want {
+		if got := query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if query.Get("code_challenge") == "" {
+		t.Error("missing PKCE code_challenge")
+	}
+}
+
+func TestOIDCDiscoveryFailure(t *testing.T) {
+	t.Setenv("OIDC_ISSUER_URL", "http://127.0.0.1:1")
+	t.Setenv("OIDC_CLIENT_ID", "leavemaster")
+	oidcMutex.Lock()
+	oidcInstance = nil
+	oidcMutex.Unlock()
+
+	if _, err := OIDCAuthorizationURL(context.Background(), "s", "n", NewPKCEVerifier()); err == nil {
+		t.Fatal("expected discovery error")
+	}
+	// Kegagalan discovery tidak di-cache
+	if oidcInstance != nil {
+		t.Error("failed discovery should not be cached")
+	}
+}
+
+func TestExchangeOIDCCode(t *testing.T) {
+	idp := useFakeIdP(t)
+	t.Setenv("OIDC_ROLE_CLAIM", "")
+	t.Setenv("OIDC_DEPARTMENT_CLAIM", "")
+
+	verifier := NewPKCEVerifier()
+	query := startLogin(t, "state-1", "nonce-1", verifier)
+	identityClaims := map[string]interface{}{
+		"sub":            "user-123",
+		"nonce":          "nonce-1",
+		"email":          " Jane.Doe@Example.com ",
+		"email_verified": true,
+		"given_name":     "Jane",
+		"family_name":    "Doe",
+		"roles":          []string{"team-leads"},
+		"department":     "Engineering",
+	}
+
+	t.Run("success", func(t *testing.T) {
+		idp.grant("code-ok", query.Get("code_challenge"), identityClaims)
+		identity, err := ExchangeOIDCCode(context.Background(), "code-ok", verifier, "nonce-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity.Subject != "user-123" || identity.Email != "jane.doe@example.com" || identity.Name != "Jane Doe" ||
+			len(identity.Roles) != 1 || identity.Roles[0] != "team-leads" || identity.Department != "Engineering" {
+			t.Errorf("unexpected identity %+v", identity)
+		}
+	})
+
+	t.Run("wrong PKCE verifier", func(t *testing.T) {
+		idp.grant("code-pkce", query.Get("code_challenge"), identityClaims)
+		if _, err := ExchangeOIDCCode(context.Background(), "code-pkce", NewPKCEVerifier(), "nonce-1"); err == nil {
+			t.Error("expected exchange to fail with another verifier")
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		idp.grant("code-nonce", query.Get("code_challenge"), identityClaims)
+		_, err := ExchangeOIDCCode(context.Background(), "code-nonce", verifier, "nonce-from-another-login")
+		if err == nil || !strings.Contains(err.Error(), "nonce mismatch") {
+			t.Errorf("expected nonce mismatch, got %v", err)
+		}
+	})
+
+	t.Run("unverified email", func(t *testing.T) {
+		claims := map[string]interface{}{"sub": "user-456", "nonce": "nonce-1", "email": "x@example.com", "email_verified": false}
+		idp.grant("code-email", query.Get("code_challenge"), claims)
+		if _, err := ExchangeOIDCCode(context.Background(), "code-email", verifier, "nonce-1"); err != ErrOIDCEmailMissing {
+			t.Errorf("expected ErrOIDCEmailMissing, got %v", err)
+		}
+	})
+
+	t.Run("code used twice", func(t *testing.T) {
+		idp.grant("code-once", query.Get("code_challenge"), identityClaims)
+		if _, err := ExchangeOIDCCode(context.Background(), "code-once", verifier, "nonce-1"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ExchangeOIDCCode(context.Background(), "code-once", verifier, "nonce-1"); err == nil {
+			t.Error("expected the second exchange to fail")
+		}
+	})
+}
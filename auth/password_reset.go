@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"leavemaster/database"
+)
+
+var ErrResetTokenInvalid = errors.New("reset token is invalid or expired")
+
+// PasswordResetTTL - Umur link reset password (env PASSWORD_RESET_TTL, default 1 jam)
+func PasswordResetTTL() time.Duration {
+	return durationFromEnv("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// IssuePasswordResetToken - Buat token reset baru; token lama yang belum dipakai dibatalkan
+func IssuePasswordResetToken(employeeID int, ipAddress string) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = database.DB.Exec(`UPDATE password_reset_tokens SET used_at = NOW()
+		WHERE employee_id = ? AND used_at IS NULL`, employeeID)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO password_reset_tokens (employee_id, token_hash, expires_at, ip_address)
+		VALUES (?, ?, ?, ?)`,
+		employeeID, HashToken(token), time.Now().Add(PasswordResetTTL()), ipAddress)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// InviteTTL - Umur link undangan untuk employee baru (env INVITE_TTL, default 7 hari)
+func InviteTTL() time.Duration {
+	return durationFromEnv("INVITE_TTL", 7*24*time.Hour)
+}
+
+// IssueInviteToken - Token set-password pertama untuk employee baru, di dalam transaksi
+// yang membuat employee-nya. Dipakai lewat POST /api/password/reset seperti token reset.
+func IssueInviteToken(tx *sql.Tx, employeeID int) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO password_reset_tokens (employee_id, token_hash, expires_at)
+		VALUES (?, ?, ?)`,
+		employeeID, HashToken(token), time.Now().Add(InviteTTL()))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumePasswordResetToken - Tandai token terpakai di dalam tx dan return employee-nya.
+// Token hanya berlaku sekali; request paralel dengan token sama akan gagal.
+// expires_at ditulis dari time.Now() Go, jadi dibandingkan dengan waktu Go juga (bukan NOW() MySQL
+// yang bisa beda time zone).
+func ConsumePasswordResetToken(tx *sql.Tx, token string) (int, error) {
+	var id int64
+	var employeeID int
+	err := tx.QueryRow(`
+		SELECT id, employee_id FROM password_reset_tokens
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		FOR UPDATE`, HashToken(token), time.Now()).Scan(&id, &employeeID)
+	if err == sql.ErrNoRows {
+		return 0, ErrResetTokenInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec("UPDATE password_reset_tokens SET used_at = NOW() WHERE id = ?", id); err != nil {
+		return 0, err
+	}
+	return employeeID, nil
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"leavemaster/database"
+)
+
+// PermissionAll - Semua permission (dipakai role super_admin)
+const PermissionAll = "*"
+
+// KnownPermissions - Permission yang dicek di route; role hanya boleh diberi permission dari daftar ini,
+// opsional dengan scope (lihat Scope), contoh "reports:read@department"
+var KnownPermissions = []string{
+	"leave:read",
+	"leave:write",
+	"leave:approve",
+	"leave:confidential",
+	"calendar:team",
+	"reports:read",
+	"users:read",
+	"users:write",
+	"departments:write",
+	"roles:write",
+	"changes:approve",
+}
+
+var ErrUnknownPermission = errors.New("unknown permission")
+
+// IsKnownPermission - Cek nama permission (termasuk "*")
+func IsKnownPermission(permission string) bool {
+	if permission == PermissionAll {
+		return true
+	}
+	for _, known := range KnownPermissions {
+		if known == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePermissions - Baca kolom roles.permissions. Format utama adalah array
+// ["leave:read", ...]; object {"leave:read": true} dan {"leave": ["read"]} juga diterima.
+func ParsePermissions(raw string) ([]string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "null" {
+		return []string{}, nil
+	}
+
+	var list []string
+	if err := json.Unmarshal([]byte(raw), &list); err == nil {
+		return normalizePermissions(list), nil
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &object); err != nil {
+		return nil, err
+	}
+	for key, value := range object {
+		switch v := value.(type) {
+		case bool:
+			if v {
+				list = append(list, key)
+			}
+		case []interface{}:
+			for _, action := range v {
+				if s, ok := action.(string); ok {
+					list = append(list, key+":"+s)
+				}
+			}
+		}
+	}
+	return normalizePermissions(list), nil
+}
+
+// NormalizePermissions - Lowercase, tanpa duplikat, urut; error kalau ada permission atau
+// scope yang tidak dikenal. Permission yang sama dengan beberapa scope diringkas ke scope terluas.
+func NormalizePermissions(permissions []string) ([]string, error) {
+	widest := map[string]Scope{}
+	for _, permission := range normalizePermissions(permissions) {
+		name, scope, err := SplitPermission(permission)
+		if err != nil {
+			return nil, err
+		}
+		if !IsKnownPermission(name) {
+			return nil, ErrUnknownPermission
+		}
+		if scope > widest[name] {
+			widest[name] = scope
+		}
+	}
+
+	normalized := []string{}
+	for name, scope := range widest {
+		normalized = append(normalized, JoinPermission(name, scope))
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func normalizePermissions(permissions []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, permission := range permissions {
+		permission = strings.ToLower(strings.TrimSpace(permission))
+		if permission == "" || seen[permission] {
+			continue
+		}
+		seen[permission] = true
+		normalized = append(normalized, permission)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// permissionCache - Scope per permission per role name, dibaca ulang dari DB setelah TTL
+// habis atau setelah InvalidatePermissionCache (role dibuat/diubah/dihapus)
+var permissionCache struct {
+	sync.RWMutex
+	byRole   map[string]map[string]Scope
+	loadedAt time.Time
+}
+
+// PermissionCacheTTL - Batas umur cache (env PERMISSION_CACHE_TTL, default 1m). Invalidasi
+// hanya berlaku di instance yang mengubah role; instance lain ikut setelah TTL.
+func PermissionCacheTTL() time.Duration {
+	return durationFromEnv("PERMISSION_CACHE_TTL", time.Minute)
+}
+
+// InvalidatePermissionCache - Paksa load ulang di pengecekan berikutnya
+func InvalidatePermissionCache() {
+	permissionCache.Lock()
+	permissionCache.byRole = nil
+	permissionCache.Unlock()
+}
+
+// RolePermissionScope - Scope permission role dari tabel roles (lewat cache); ScopeNone kalau tidak punya
+func RolePermissionScope(roleName, permission string) (Scope, error) {
+	byRole, err := rolePermissions()
+	if err != nil {
+		return ScopeNone, err
+	}
+	permissions := byRole[normalizeRoleName(roleName)]
+	if permissions[PermissionAll] != ScopeNone {
+		return ScopeOrganisation, nil
+	}
+	return permissions[permission], nil
+}
+
+func normalizeRoleName(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func rolePermissions() (map[string]map[string]Scope, error) {
+	permissionCache.RLock()
+	byRole, loadedAt := permissionCache.byRole, permissionCache.loadedAt
+	permissionCache.RUnlock()
+	if byRole != nil && time.Since(loadedAt) < PermissionCacheTTL() {
+		return byRole, nil
+	}
+
+	byRole, err := loadRolePermissions()
+	if err != nil {
+		return nil, err
+	}
+
+	permissionCache.Lock()
+	permissionCache.byRole = byRole
+	permissionCache.loadedAt = time.Now()
+	permissionCache.Unlock()
+	return byRole, nil
+}
+
+func loadRolePermissions() (map[string]map[string]Scope, error) {
+	rows, err := database.DB.Query("SELECT name, COALESCE(permissions, '') FROM roles")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byRole := map[string]map[string]Scope{}
+	for rows.Next() {
+		var name, raw string
+		if err := rows.Scan(&name, &raw); err != nil {
+			return nil, err
+		}
+		permissions, err := ParsePermissions(raw)
+		if err != nil {
+			// Role dengan JSON rusak tidak dapat permission apa pun, bukan membuat semua request gagal
+			log.Printf("⚠️ Role %s has invalid permissions JSON: %v", name, err)
+			permissions = nil
+		}
+		scopes := map[string]Scope{}
+		for _, permission := range permissions {
+			permissionName, scope, err := SplitPermission(permission)
+			if err != nil {
+				log.Printf("⚠️ Role %s has permission with unknown scope: %s", name, permission)
+				continue
+			}
+			if scope > scopes[permissionName] {
+				scopes[permissionName] = scope
+			}
+		}
+		byRole[normalizeRoleName(name)] = scopes
+	}
+	return byRole, rows.Err()
+}
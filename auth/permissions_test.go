@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePermissions(t *testing.T) {
+	cases := map[string][]string{
+		``:     {},
+		`null`: {},
+		`["users:read", "Leave:Read", "users:read"]`:   {"leave:read", "users:read"},
+		`{"reports:read": true, "users:write": false}`: {"reports:read"},
+		`{"leave": ["read", "write"]}`:                 {"leave:read", "leave:write"},
+		`["*"]`:                                        {"*"},
+	}
+	for raw, want := range cases {
+		got, err := ParsePermissions(raw)
+		if err != nil {
+			t.Errorf("ParsePermissions(%q): %v", raw, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParsePermissions(%q) = %v, want %v", raw, got, want)
+		}
+	}
+
+	if _, err := ParsePermissions(`not json`); err == nil {
+		t.Error("expected error for invalid JSON")
+	}
+}
+
+func TestNormalizePermissionsRejectsUnknown(t *testing.T) {
+	if _, err := NormalizePermissions([]string{"users:read", "payroll:write"}); err != ErrUnknownPermission {
+		t.Errorf("got %v, want ErrUnknownPermission", err)
+	}
+	got, err := NormalizePermissions([]string{" Reports:Read ", "leave:approve"})
+	if err != nil || !reflect.DeepEqual(got, []string{"leave:approve", "reports:read"}) {
+		t.Errorf("got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,36 @@
+package auth
+
+import "time"
+
+// privilegedPermissions - Permission administratif; role yang punya salah satunya
+// (dengan scope apa pun) hanya bisa diberikan lewat change request yang di-approve orang kedua
+var privilegedPermissions = []string{PermissionAll, "users:write", "roles:write", "changes:approve"}
+
+// IsPrivilegedRole - Role dengan permission administratif (super_admin, admin, dst)
+func IsPrivilegedRole(roleName string) (bool, error) {
+	for _, permission := range privilegedPermissions {
+		scope, err := RolePermissionScope(roleName, permission)
+		if err != nil {
+			return false, err
+		}
+		if scope != ScopeNone {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// GrantsAllPermissions - Role dengan "*" (super_admin); promosi ke role ini hanya bisa
+// di-approve oleh role yang juga punya "*"
+func GrantsAllPermissions(roleName string) (bool, error) {
+	permissions, err := rolePermissions()
+	if err != nil {
+		return false, err
+	}
+	return permissions[normalizeRoleName(roleName)][PermissionAll] != ScopeNone, nil
+}
+
+// ChangeRequestTTL - Batas waktu change request menunggu approval (env CHANGE_REQUEST_TTL, default 72h)
+func ChangeRequestTTL() time.Duration {
+	return durationFromEnv("CHANGE_REQUEST_TTL", 72*time.Hour)
+}
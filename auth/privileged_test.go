@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func seedPermissionCache(t *testing.T, byRole map[string]map[string]Scope) {
+	t.Helper()
+	permissionCache.Lock()
+	permissionCache.byRole = byRole
+	permissionCache.loadedAt = time.Now()
+	permissionCache.Unlock()
+	t.Cleanup(InvalidatePermissionCache)
+}
+
+func TestIsPrivilegedRole(t *testing.T) {
+	seedPermissionCache(t, map[string]map[string]Scope{
+		"super_admin": {PermissionAll: ScopeOrganisation},
+		"admin":       {"users:write": ScopeOrganisation, "changes:approve": ScopeOrganisation},
+		"hr_partner":  {"users:write": ScopeDepartment},
+		"manager":     {"leave:approve": ScopeDepartment, "users:read": ScopeDepartment},
+		"employee":    {"leave:read": ScopeSelf},
+	})
+
+	cases := map[string]struct{ privileged, grantsAll bool }{
+		"super_admin": {true, true},
+		"Admin":       {true, false},
+		"hr_partner":  {true, false},
+		"manager":     {false, false},
+		"employee":    {false, false},
+		"unknown":     {false, false},
+	}
+	for role, want := range cases {
+		privileged, err := IsPrivilegedRole(role)
+		if err != nil || privileged != want.privileged {
+			t.Errorf("IsPrivilegedRole(%q) = %v, %v; want %v", role, privileged, err, want.privileged)
+		}
+		grantsAll, err := GrantsAllPermissions(role)
+		if err != nil || grantsAll != want.grantsAll {
+			t.Errorf("GrantsAllPermissions(%q) = %v, %v; want %v", role, grantsAll, err, want.grantsAll)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"leavemaster/database"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+)
+
+// AccessTokenTTL - Umur access token (env ACCESS_TOKEN_TTL, default 15 menit)
+func AccessTokenTTL() time.Duration {
+	return durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// RefreshTokenTTL - Umur refresh token (env REFRESH_TOKEN_TTL, default 30 hari)
+func RefreshTokenTTL() time.Duration {
+	return durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️ Invalid %s=%q, using default %s", key, raw, fallback)
+		return fallback
+	}
+	return d
+}
+
+// RandomToken - Token random URL-safe (n byte entropy)
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken - SHA-256 hex dari token; yang disimpan di DB hanya hash-nya
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewSessionID - ID untuk satu "family" refresh token (satu login)
+func NewSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// IssueRefreshToken - Buat refresh token baru dalam family sessionID
+func IssueRefreshToken(employeeID int, sessionID, ipAddress, userAgent string) (string, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = database.DB.Exec(`
+		INSERT INTO refresh_tokens (employee_id, family_id, token_hash, expires_at, ip_address, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		employeeID, sessionID, HashToken(token), time.Now().Add(RefreshTokenTTL()),
+		ipAddress, truncate(userAgent, 255))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken - Tukar refresh token lama dengan yang baru di family yang sama.
+// Kalau token lama sudah pernah dipakai (kemungkinan dicuri), seluruh family di-revoke.
+func RotateRefreshToken(token, ipAddress, userAgent string) (employeeID int, sessionID, newToken string, err error) {
+	var id int64
+	var expiresAt time.Time
+	var usedAt, revokedAt sql.NullTime
+
+	err = database.DB.QueryRow(`
+		SELECT id, employee_id, family_id, expires_at, used_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = ?`, HashToken(token)).
+		Scan(&id, &employeeID, &sessionID, &expiresAt, &usedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return 0, "", "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	if usedAt.Valid {
+		log.Printf("🚨 Refresh token reuse detected - Employee: %d, Session: %s. Revoking session.", employeeID, sessionID)
+		if err := RevokeSession(sessionID); err != nil {
+			return 0, "", "", err
+		}
+		return 0, "", "", ErrRefreshTokenReused
+	}
+	if revokedAt.Valid || time.Now().After(expiresAt) {
+		return 0, "", "", ErrRefreshTokenInvalid
+	}
+
+	// Tandai terpakai secara atomik - kalau request paralel sudah duluan, anggap reuse
+	result, err := database.DB.Exec(`UPDATE refresh_tokens SET used_at = NOW()
+		WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL`, id)
+	if err != nil {
+		return 0, "", "", err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if err := RevokeSession(sessionID); err != nil {
+			return 0, "", "", err
+		}
+		return 0, "", "", ErrRefreshTokenReused
+	}
+
+	newToken, err = IssueRefreshToken(employeeID, sessionID, ipAddress, userAgent)
+	if err != nil {
+		return 0, "", "", err
+	}
+	return employeeID, sessionID, newToken, nil
+}
+
+// RevokeSession - Revoke semua refresh token dalam satu family
+func RevokeSession(sessionID string) error {
+	_, err := database.DB.Exec(`UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = ? AND revoked_at IS NULL`, sessionID)
+	return err
+}
+
+// RevokeSessionByToken - Revoke family dari refresh token tertentu (untuk logout)
+func RevokeSessionByToken(token string) error {
+	var sessionID string
+	err := database.DB.QueryRow("SELECT family_id FROM refresh_tokens WHERE token_hash = ?", HashToken(token)).
+		Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return RevokeSession(sessionID)
+}
+
+// RevokeAllSessions - Revoke semua refresh token milik employee
+func RevokeAllSessions(employeeID int) error {
+	_, err := database.DB.Exec(`UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE employee_id = ? AND revoked_at IS NULL`, employeeID)
+	return err
+}
+
+func truncate(value string, max int) string {
+	if len(value) > max {
+		return value[:max]
+	}
+	return value
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scope - Jangkauan data sebuah permission. Urutannya bertingkat: setiap scope
+// juga mencakup scope di bawahnya (department mencakup team, team mencakup self).
+type Scope int
+
+const (
+	ScopeNone Scope = iota
+	ScopeSelf
+	ScopeTeam
+	ScopeDepartment
+	ScopeOrganisation
+)
+
+// scopeKey - Scope yang diberikan PermissionMiddleware untuk route ini
+const scopeKey = "permission_scope"
+
+var ErrUnknownScope = errors.New("unknown permission scope")
+
+// KnownScopes - Nama scope yang bisa ditulis setelah "@", contoh "leave:approve@team"
+var KnownScopes = []string{"self", "team", "department", "organisation"}
+
+var scopeNames = map[string]Scope{
+	"self":         ScopeSelf,
+	"team":         ScopeTeam,
+	"department":   ScopeDepartment,
+	"organisation": ScopeOrganisation,
+	"organization": ScopeOrganisation,
+	"org":          ScopeOrganisation,
+}
+
+func (s Scope) String() string {
+	switch s {
+	case ScopeSelf:
+		return "self"
+	case ScopeTeam:
+		return "team"
+	case ScopeDepartment:
+		return "department"
+	case ScopeOrganisation:
+		return "organisation"
+	}
+	return "none"
+}
+
+// SplitPermission - "leave:approve@team" -> ("leave:approve", ScopeTeam).
+// Tanpa "@" berarti seluruh organisasi, sama seperti sebelum ada scope.
+func SplitPermission(permission string) (string, Scope, error) {
+	name, scopeName, hasScope := strings.Cut(permission, "@")
+	if !hasScope {
+		return name, ScopeOrganisation, nil
+	}
+	scope, ok := scopeNames[scopeName]
+	if !ok {
+		return name, ScopeNone, ErrUnknownScope
+	}
+	return name, scope, nil
+}
+
+// JoinPermission - Kebalikan SplitPermission; scope organisasi ditulis tanpa suffix
+func JoinPermission(name string, scope Scope) string {
+	if scope == ScopeOrganisation || name == PermissionAll {
+		return name
+	}
+	return name + "@" + scope.String()
+}
+
+// PermissionScopeOf - Scope terluas yang dimiliki identity untuk permission ini
+// (ScopeNone kalau tidak punya). Service account selalu berlaku untuk seluruh organisasi.
+func PermissionScopeOf(id Identity, permission string) (Scope, error) {
+	if id.IsServiceAccount() {
+		for _, scope := range id.Scopes {
+			if scope == permission {
+				return ScopeOrganisation, nil
+			}
+		}
+		return ScopeNone, nil
+	}
+	if id.RoleName == "super_admin" {
+		return ScopeOrganisation, nil
+	}
+	return RolePermissionScope(id.RoleName, permission)
+}
+
+// SetPermissionScope - Dipanggil PermissionMiddleware setelah permission diberikan
+func SetPermissionScope(c *gin.Context, scope Scope) {
+	c.Set(scopeKey, scope)
+}
+
+// CurrentScope - Scope permission route ini; ScopeSelf kalau route tidak memakai PermissionMiddleware
+func CurrentScope(c *gin.Context) Scope {
+	if value, exists := c.Get(scopeKey); exists {
+		if scope, ok := value.(Scope); ok {
+			return scope
+		}
+	}
+	return ScopeSelf
+}
+
+// ScopeFilter - Kondisi SQL untuk membatasi baris employee (alias tabel employees di query)
+// ke scope caller. Dipakai semua handler yang menampilkan data lintas employee:
+//
+//	clause, args := auth.ScopeFilter(c, auth.CurrentScope(c), "e")
+//	query += " AND " + clause
+func ScopeFilter(c *gin.Context, scope Scope, employeeAlias string) (string, []interface{}) {
+	id, _ := CurrentIdentity(c)
+	column := func(name string) string { return employeeAlias + "." + name }
+
+	switch {
+	case scope == ScopeOrganisation:
+		return "1=1", nil
+	case scope == ScopeNone || id.EmployeeID == 0:
+		return "1=0", nil
+	case scope == ScopeDepartment && id.DepartmentID != nil:
+		return "(" + column("department_id") + " = ? OR " + column("manager_id") + " = ? OR " + column("id") + " = ?)",
+			[]interface{}{*id.DepartmentID, id.EmployeeID, id.EmployeeID}
+	case scope == ScopeDepartment || scope == ScopeTeam:
+		// Tanpa department, scope department sama dengan team
+		return "(" + column("manager_id") + " = ? OR " + column("id") + " = ?)",
+			[]interface{}{id.EmployeeID, id.EmployeeID}
+	default:
+		return column("id") + " = ?", []interface{}{id.EmployeeID}
+	}
+}
+
+// ScopeTarget - Data employee yang dibutuhkan untuk cek scope satu baris
+type ScopeTarget struct {
+	EmployeeID   int
+	ManagerID    *int
+	DepartmentID *int
+}
+
+// InScope - Versi ScopeFilter untuk satu employee yang sudah di-load
+func InScope(c *gin.Context, scope Scope, target ScopeTarget) bool {
+	id, _ := CurrentIdentity(c)
+	self := id.EmployeeID != 0 && target.EmployeeID == id.EmployeeID
+	directReport := id.EmployeeID != 0 && target.ManagerID != nil && *target.ManagerID == id.EmployeeID
+	sameDepartment := id.DepartmentID != nil && target.DepartmentID != nil && *id.DepartmentID == *target.DepartmentID
+
+	switch scope {
+	case ScopeOrganisation:
+		return true
+	case ScopeDepartment:
+		return self || directReport || (id.EmployeeID != 0 && sameDepartment)
+	case ScopeTeam:
+		return self || directReport
+	case ScopeSelf:
+		return self
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func contextWithIdentity(id Identity) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	SetIdentity(c, id)
+	return c
+}
+
+func intPtr(v int) *int { return &v }
+
+func TestSplitPermission(t *testing.T) {
+	cases := map[string]struct {
+		name  string
+		scope Scope
+	}{
+		"reports:read":              {"reports:read", ScopeOrganisation},
+		"leave:approve@team":        {"leave:approve", ScopeTeam},
+		"users:read@department":     {"users:read", ScopeDepartment},
+		"leave:read@self":           {"leave:read", ScopeSelf},
+		"reports:read@organization": {"reports:read", ScopeOrganisation},
+	}
+	for raw, want := range cases {
+		name, scope, err := SplitPermission(raw)
+		if err != nil || name != want.name || scope != want.scope {
+			t.Errorf("SplitPermission(%q) = %q, %s, %v", raw, name, scope, err)
+		}
+	}
+	if _, _, err := SplitPermission("leave:approve@galaxy"); err != ErrUnknownScope {
+		t.Errorf("expected ErrUnknownScope, got %v", err)
+	}
+}
+
+func TestNormalizePermissionsKeepsWidestScope(t *testing.T) {
+	got, err := NormalizePermissions([]string{"leave:approve@team", "leave:approve@department", "reports:read@organisation"})
+	want := []string{"leave:approve@department", "reports:read"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, %v; want %v", got, err, want)
+	}
+}
+
+func TestScopeFilter(t *testing.T) {
+	manager := contextWithIdentity(Identity{EmployeeID: 7, RoleName: "manager", DepartmentID: intPtr(3)})
+	noDepartment := contextWithIdentity(Identity{EmployeeID: 8, RoleName: "manager"})
+	service := contextWithIdentity(ServiceAccountIdentityOf(ServiceAccountIdentity{ID: 1, Scopes: []string{"reports:read"}}))
+
+	cases := []struct {
+		name   string
+		c      *gin.Context
+		scope  Scope
+		clause string
+		args   []interface{}
+	}{
+		{"organisation", manager, ScopeOrganisation, "1=1", nil},
+		{"department", manager, ScopeDepartment, "(e.department_id = ? OR e.manager_id = ? OR e.id = ?)", []interface{}{3, 7, 7}},
+		{"department without department", noDepartment, ScopeDepartment, "(e.manager_id = ? OR e.id = ?)", []interface{}{8, 8}},
+		{"team", manager, ScopeTeam, "(e.manager_id = ? OR e.id = ?)", []interface{}{7, 7}},
+		{"self", manager, ScopeSelf, "e.id = ?", []interface{}{7}},
+		{"none", manager, ScopeNone, "1=0", nil},
+		{"service account below organisation", service, ScopeDepartment, "1=0", nil},
+	}
+	for _, tc := range cases {
+		clause, args := ScopeFilter(tc.c, tc.scope, "e")
+		if clause != tc.clause || !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%s: got %q %v, want %q %v", tc.name, clause, args, tc.clause, tc.args)
+		}
+	}
+}
+
+func TestInScope(t *testing.T) {
+	c := contextWithIdentity(Identity{EmployeeID: 7, RoleName: "manager", DepartmentID: intPtr(3)})
+	self := ScopeTarget{EmployeeID: 7, DepartmentID: intPtr(3)}
+	report := ScopeTarget{EmployeeID: 20, ManagerID: intPtr(7), DepartmentID: intPtr(9)}
+	colleague := ScopeTarget{EmployeeID: 21, ManagerID: intPtr(2), DepartmentID: intPtr(3)}
+	outsider := ScopeTarget{EmployeeID: 22, ManagerID: intPtr(2), DepartmentID: intPtr(9)}
+
+	cases := []struct {
+		scope  Scope
+		target ScopeTarget
+		want   bool
+	}{
+		{ScopeSelf, self, true},
+		{ScopeSelf, report, false},
+		{ScopeTeam, report, true},
+		{ScopeTeam, colleague, false},
+		{ScopeDepartment, colleague, true},
+		{ScopeDepartment, report, true},
+		{ScopeDepartment, outsider, false},
+		{ScopeOrganisation, outsider, true},
+		{ScopeNone, self, false},
+	}
+	for _, tc := range cases {
+		if got := InScope(c, tc.scope, tc.target); got != tc.want {
+			t.Errorf("InScope(%s, employee %d) = %v, want %v", tc.scope, tc.target.EmployeeID, got, tc.want)
+		}
+	}
+}
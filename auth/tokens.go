@@ -0,0 +1,262 @@
+// Package auth - Semua signing dan verifikasi JWT LeaveMaster lewat package ini.
+//
+// Konfigurasi (env):
+//
+//	JWT_ALGORITHM        HS256 (default), RS256 atau EdDSA
+//	JWT_SECRET           secret HS256 tunggal (kid "default")
+//	JWT_KEYS             beberapa secret HS256 untuk rotasi: "kid1:secret1,kid2:secret2"
+//	JWT_PRIVATE_KEY_FILE PEM private key untuk RS256/EdDSA
+//	JWT_PUBLIC_KEY_FILES PEM public key tambahan untuk verifikasi: "kid1:/path/a.pem,kid2:/path/b.pem"
+//	JWT_ACTIVE_KID       kid yang dipakai untuk sign token baru
+//
+// Saat rotasi, tambahkan key baru dan jadikan aktif; key lama tetap bisa verifikasi
+// sampai semua token lama expired, setelah itu baru dihapus.
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// keySet - Key untuk sign (active) dan semua key yang boleh dipakai verifikasi
+type keySet struct {
+	method     jwt.SigningMethod
+	activeKID  string
+	signingKey interface{}
+	verifyKeys map[string]interface{}
+}
+
+var keys *keySet
+
+var (
+	ErrKeysNotLoaded = errors.New("JWT keys have not been loaded")
+	ErrUnknownKeyID  = errors.New("token signed with unknown key id")
+)
+
+// LoadKeys - Baca konfigurasi key dari env. Dipanggil sekali saat startup.
+func LoadKeys() error {
+	algorithm := strings.ToUpper(strings.TrimSpace(os.Getenv("JWT_ALGORITHM")))
+	if algorithm == "" {
+		algorithm = "HS256"
+	}
+
+	var set *keySet
+	var err error
+	switch algorithm {
+	case "HS256":
+		set, err = loadHMACKeys()
+	case "RS256":
+		set, err = loadAsymmetricKeys(jwt.SigningMethodRS256)
+	case "EDDSA":
+		set, err = loadAsymmetricKeys(SigningMethodEdDSA)
+	default:
+		err = fmt.Errorf("unsupported JWT_ALGORITHM %q (use HS256, RS256 or EdDSA)", algorithm)
+	}
+	if err != nil {
+		return err
+	}
+
+	keys = set
+	log.Printf("🔑 JWT keys loaded - Algorithm: %s, Active kid: %s, Verification keys: %d",
+		set.method.Alg(), set.activeKID, len(set.verifyKeys))
+	return nil
+}
+
+func loadHMACKeys() (*keySet, error) {
+	set := &keySet{method: jwt.SigningMethodHS256, verifyKeys: map[string]interface{}{}}
+	var order []string
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		set.verifyKeys["default"] = []byte(secret)
+		order = append(order, "default")
+	}
+	for _, entry := range parseKeyList(os.Getenv("JWT_KEYS")) {
+		set.verifyKeys[entry.kid] = []byte(entry.value)
+		order = append(order, entry.kid)
+	}
+	if len(set.verifyKeys) == 0 {
+		return nil, errors.New("JWT_SECRET or JWT_KEYS must be set")
+	}
+
+	set.activeKID = os.Getenv("JWT_ACTIVE_KID")
+	if set.activeKID == "" {
+		set.activeKID = order[0]
+	}
+	key, ok := set.verifyKeys[set.activeKID]
+	if !ok {
+		return nil, fmt.Errorf("JWT_ACTIVE_KID %q is not one of the configured keys", set.activeKID)
+	}
+	for _, secret := range set.verifyKeys {
+		if len(secret.([]byte)) < 32 {
+			log.Printf("⚠️ A JWT secret is shorter than 32 bytes - use a longer random secret in production")
+			break
+		}
+	}
+	set.signingKey = key
+	return set, nil
+}
+
+func loadAsymmetricKeys(method jwt.SigningMethod) (*keySet, error) {
+	set := &keySet{method: method, verifyKeys: map[string]interface{}{}}
+
+	set.activeKID = os.Getenv("JWT_ACTIVE_KID")
+	if set.activeKID == "" {
+		set.activeKID = "default"
+	}
+
+	privateFile := os.Getenv("JWT_PRIVATE_KEY_FILE")
+	if privateFile == "" {
+		return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE must be set for %s", method.Alg())
+	}
+	privatePEM, err := os.ReadFile(privateFile)
+	if err != nil {
+		return nil, fmt.Errorf("read JWT_PRIVATE_KEY_FILE: %w", err)
+	}
+
+	switch method {
+	case jwt.SigningMethodRS256:
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+		if err != nil {
+			return nil, fmt.Errorf("parse RS256 private key: %w", err)
+		}
+		set.signingKey = privateKey
+		set.verifyKeys[set.activeKID] = &privateKey.PublicKey
+	default:
+		privateKey, err := parseEd25519PrivateKey(privatePEM)
+		if err != nil {
+			return nil, err
+		}
+		set.signingKey = privateKey
+		set.verifyKeys[set.activeKID] = privateKey.Public()
+	}
+
+	for _, entry := range parseKeyList(os.Getenv("JWT_PUBLIC_KEY_FILES")) {
+		kid := entry.kid
+		publicPEM, err := os.ReadFile(entry.value)
+		if err != nil {
+			return nil, fmt.Errorf("read public key %q: %w", kid, err)
+		}
+		var publicKey interface{}
+		if method == jwt.SigningMethodRS256 {
+			publicKey, err = jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+		} else {
+			publicKey, err = parseEd25519PublicKey(publicPEM)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse public key %q: %w", kid, err)
+		}
+		set.verifyKeys[kid] = publicKey
+	}
+
+	return set, nil
+}
+
+func parseEd25519PrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("EdDSA private key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse EdDSA private key: %w", err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("EdDSA private key is not an Ed25519 key")
+	}
+	return privateKey, nil
+}
+
+func parseEd25519PublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("EdDSA public key is not PEM encoded")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an Ed25519 key")
+	}
+	return publicKey, nil
+}
+
+type keyEntry struct {
+	kid   string
+	value string
+}
+
+// parseKeyList - Parse "kid1:value1,kid2:value2" dengan urutan tetap
+func parseKeyList(raw string) []keyEntry {
+	var result []keyEntry
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Printf("⚠️ Ignoring malformed key entry (expected kid:value)")
+			continue
+		}
+		result = append(result, keyEntry{kid: strings.TrimSpace(parts[0]), value: strings.TrimSpace(parts[1])})
+	}
+	return result
+}
+
+// SignToken - Sign claims dengan key aktif, kid dimasukkan ke header
+func SignToken(claims jwt.MapClaims) (string, error) {
+	if keys == nil {
+		return "", ErrKeysNotLoaded
+	}
+	token := jwt.NewWithClaims(keys.method, claims)
+	token.Header["kid"] = keys.activeKID
+	return token.SignedString(keys.signingKey)
+}
+
+// ParseToken - Verifikasi token dan return claims-nya.
+// Hanya algoritma yang dikonfigurasi yang diterima, key dipilih berdasarkan kid.
+func ParseToken(tokenString string) (jwt.MapClaims, error) {
+	if keys == nil {
+		return nil, ErrKeysNotLoaded
+	}
+
+	parser := &jwt.Parser{ValidMethods: []string{keys.method.Alg()}}
+	token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != keys.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = keys.activeKID
+		}
+		key, ok := keys.verifyKeys[kid]
+		if !ok {
+			return nil, ErrUnknownKeyID
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Parameter TOTP (RFC 6238) - default yang didukung semua authenticator app
+const (
+	totpDigits = 6
+	totpPeriod = 30 // detik
+	totpSkew   = 1  // toleransi 1 step sebelum/sesudah untuk clock drift
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret - Secret 160-bit, base32 tanpa padding
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPIssuer - Nama yang tampil di authenticator app (env TOTP_ISSUER)
+func TOTPIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "LeaveMaster"
+}
+
+// TOTPURI - otpauth:// URI untuk QR code
+func TOTPURI(accountName, secret string) string {
+	issuer := TOTPIssuer()
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// totpCode - HOTP (RFC 4226) untuk counter tertentu
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// ValidateTOTP - Cek kode terhadap secret. Return time step yang cocok supaya
+// pemanggil bisa menolak kode yang sama dipakai dua kali.
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes - Kode sekali pakai format xxxxx-xxxxx
+func GenerateRecoveryCodes(count int) ([]string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz023456789" // 32 karakter, tanpa i/l/o/1
+	codes := make([]string, count)
+	for i := range codes {
+		buf := make([]byte, 10)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		chars := make([]byte, len(buf))
+		for j, b := range buf {
+			chars[j] = alphabet[int(b)%len(alphabet)]
+		}
+		codes[i] = string(chars[:5]) + "-" + string(chars[5:])
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode - Normalisasi (tanpa strip/spasi, lowercase) lalu hash
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return HashToken(normalized)
+}
+
+// TwoFactorRequired - Role yang wajib 2FA (env TWO_FACTOR_REQUIRED_ROLES, default super_admin,admin,manager)
+func TwoFactorRequired(roleName string) bool {
+	raw := os.Getenv("TWO_FACTOR_REQUIRED_ROLES")
+	if raw == "" {
+		raw = "super_admin,admin,manager"
+	}
+	roleName = strings.ToLower(strings.TrimSpace(roleName))
+	for _, role := range strings.Split(raw, ",") {
+		if strings.ToLower(strings.TrimSpace(role)) == roleName && roleName != "" {
+			return true
+		}
+	}
+	return false
+}
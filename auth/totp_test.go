@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Secret RFC 6238 Appendix B ("12345678901234567890") dalam base32
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Vektor SHA1 dari RFC 6238, dipotong ke 6 digit (kode 8 digit modulo 10^6)
+var rfcTOTPVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, v := range rfcTOTPVectors {
+		if got := totpCode(key, v.unix/totpPeriod); got != v.code {
+			t.Errorf("T=%d: got %s, want %s", v.unix, got, v.code)
+		}
+		step, ok := ValidateTOTP(rfcTOTPSecret, v.code, time.Unix(v.unix, 0))
+		if !ok || step != v.unix/totpPeriod {
+			t.Errorf("ValidateTOTP at T=%d = %d, %v", v.unix, step, ok)
+		}
+	}
+}
+
+func TestValidateTOTPSkewWindow(t *testing.T) {
+	// Kode untuk T=59 berlaku di step 1; skew 1 berarti step 0..2 masih menerima
+	code := "287082"
+	cases := []struct {
+		unix int64
+		ok   bool
+	}{
+		{0, true},
+		{29, true},
+		{30, true},
+		{89, true},
+		{90, false},
+		{120, false},
+	}
+	for _, tc := range cases {
+		step, ok := ValidateTOTP(rfcTOTPSecret, code, time.Unix(tc.unix, 0))
+		if ok != tc.ok {
+			t.Errorf("T=%d: ok = %v, want %v", tc.unix, ok, tc.ok)
+		}
+		if ok && step != 1 {
+			t.Errorf("T=%d: matched step %d, want 1", tc.unix, step)
+		}
+	}
+}
+
+func TestValidateTOTPRejectsMalformedInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	if _, ok := ValidateTOTP(strings.ToLower(rfcTOTPSecret), " 287082 ", now); !ok {
+		t.Error("lowercase secret and surrounding spaces should be accepted")
+	}
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := ValidateTOTP(rfcTOTPSecret, code, now); ok {
+			t.Errorf("code %q should be rejected", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "287082", now); ok {
+		t.Error("invalid secret should be rejected")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("got %d codes", len(codes))
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q does not match xxxxx-xxxxx", code)
+		}
+		if strings.ContainsAny(code, "ilo1") {
+			t.Errorf("code %q contains an ambiguous character", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+
+	// Hash tidak peduli strip, spasi dan huruf besar
+	want := HashRecoveryCode("abcde-fghjk")
+	for _, typed := range []string{"abcdefghjk", "ABCDE-FGHJK", " abcde fghjk "} {
+		if got := HashRecoveryCode(typed); got != want {
+			t.Errorf("HashRecoveryCode(%q) differs from canonical form", typed)
+		}
+	}
+	if HashRecoveryCode("abcde-fghjm") == want {
+		t.Error("different codes should hash differently")
+	}
+}
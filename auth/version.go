@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+
+	"leavemaster/database"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// CheckTokenVersion - Tolak token kalau employee sudah nonaktif atau token_version-nya sudah naik
+// (deaktivasi, ganti role, reset password, dst). Dipanggil di setiap request.
+func CheckTokenVersion(claims jwt.MapClaims) error {
+	// Token challenge (mis. langkah 2FA) bukan access token
+	if _, ok := claims["purpose"]; ok {
+		return ErrTokenRevoked
+	}
+	employeeID, ok := claims["employee_id"].(float64)
+	if !ok {
+		return ErrTokenRevoked
+	}
+	version, ok := claims["tv"].(float64)
+	if !ok {
+		return ErrTokenRevoked
+	}
+
+	if err := checkEmployeeTokenVersion(int(employeeID), int(version)); err != nil {
+		return err
+	}
+
+	// Token impersonation juga mati kalau super_admin-nya nonaktif, ganti role, dst
+	impersonator, impersonated, err := ImpersonatorFromClaims(claims)
+	if err != nil {
+		return ErrTokenRevoked
+	}
+	if impersonated {
+		return checkEmployeeTokenVersion(impersonator.EmployeeID, impersonator.TokenVersion)
+	}
+	return nil
+}
+
+func checkEmployeeTokenVersion(employeeID, version int) error {
+	var current int
+	err := database.DB.QueryRow("SELECT token_version FROM employees WHERE id = ? AND is_active = TRUE",
+		employeeID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return ErrTokenRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if current != version {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// TwoFactorSetupPending - Token untuk role yang wajib 2FA tapi belum enroll;
+// hanya boleh dipakai ke endpoint /api/2fa/*
+func TwoFactorSetupPending(claims jwt.MapClaims) bool {
+	pending, _ := claims["2fa_setup"].(bool)
+	return pending
+}
+
+// PasswordChangePending - Token employee dengan password sementara (mis. hasil import);
+// hanya boleh dipakai ke PUT /api/change-password
+func PasswordChangePending(claims jwt.MapClaims) bool {
+	pending, _ := claims["pwd_change"].(bool)
+	return pending
+}
+
+// BumpTokenVersion - Invalidasi semua access token employee yang sudah terbit
+func BumpTokenVersion(employeeID int) error {
+	_, err := database.DB.Exec("UPDATE employees SET token_version = token_version + 1 WHERE id = ?", employeeID)
+	return err
+}
@@ -33,4 +33,8 @@ func InitDB() {
 	}
 
 	log.Println("✅ Connected to MySQL database!")
+
+	if err = Migrate(); err != nil {
+		log.Fatalf("❌ Database migration failed: %v", err)
+	}
 }
@@ -0,0 +1,324 @@
+package database
+
+import (
+	"fmt"
+	"log"
+)
+
+// migration - Satu langkah perubahan schema, dijalankan sekali dan dicatat di schema_migrations
+type migration struct {
+	ID         string
+	Statements []string
+}
+
+// migrations - Urutan schema changes. Jangan ubah migration yang sudah pernah jalan, tambahkan yang baru di paling bawah.
+var migrations = []migration{
+	{
+		ID: "001_auto_approval_rules",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS auto_approval_rules (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(100) NOT NULL,
+				leave_type VARCHAR(50) NULL,
+				max_days INT NULL,
+				min_notice_days INT NULL,
+				min_remaining_balance INT NULL,
+				max_team_absent INT NULL,
+				priority INT NOT NULL DEFAULT 0,
+				is_active BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`ALTER TABLE leave_requests ADD COLUMN auto_approval_rule_id INT NULL`,
+		},
+	},
+	{
+		ID: "002_leave_type_policies",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS leave_type_policies (
+				leave_type VARCHAR(50) PRIMARY KEY,
+				min_notice_days INT NULL,
+				max_advance_days INT NULL,
+				max_backdate_days INT NULL,
+				max_consecutive_days INT NULL,
+				updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+			)`,
+			`INSERT IGNORE INTO leave_type_policies
+				(leave_type, min_notice_days, max_advance_days, max_backdate_days, max_consecutive_days)
+			VALUES
+				('annual', 1, 365, 0, NULL),
+				('sick', 0, 0, 3, NULL),
+				('personal', 1, 365, 0, NULL),
+				('other', 0, 365, 0, NULL)`,
+		},
+	},
+	{
+		ID: "003_leave_request_amendments",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS leave_request_amendments (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				leave_request_id INT NOT NULL,
+				requested_by INT NOT NULL,
+				old_leave_type VARCHAR(50) NOT NULL,
+				old_start_date DATE NOT NULL,
+				old_end_date DATE NOT NULL,
+				old_total_days INT NOT NULL,
+				old_reason TEXT,
+				new_leave_type VARCHAR(50) NOT NULL,
+				new_start_date DATE NOT NULL,
+				new_end_date DATE NOT NULL,
+				new_total_days INT NOT NULL,
+				new_reason TEXT,
+				status VARCHAR(20) NOT NULL,
+				decided_by INT NULL,
+				decided_at DATETIME NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_amendments_leave_request (leave_request_id),
+				INDEX idx_amendments_status (status)
+			)`,
+		},
+	},
+	{
+		ID: "004_leave_type_accruals",
+		Statements: []string{
+			`ALTER TABLE leave_type_policies
+				ADD COLUMN annual_entitlement INT NULL,
+				ADD COLUMN accrual_frequency VARCHAR(10) NOT NULL DEFAULT 'yearly',
+				ADD COLUMN max_carry_over_days INT NULL,
+				ADD COLUMN carry_over_expiry_months INT NULL`,
+		},
+	},
+	{
+		ID: "005_refresh_tokens",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS refresh_tokens (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				employee_id INT NOT NULL,
+				family_id CHAR(32) NOT NULL,
+				token_hash CHAR(64) NOT NULL,
+				expires_at DATETIME NOT NULL,
+				used_at DATETIME NULL,
+				revoked_at DATETIME NULL,
+				ip_address VARCHAR(45) NULL,
+				user_agent VARCHAR(255) NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE KEY uq_refresh_tokens_hash (token_hash),
+				KEY idx_refresh_tokens_family (family_id),
+				KEY idx_refresh_tokens_employee (employee_id)
+			)`,
+		},
+	},
+	{
+		ID: "006_employee_token_version",
+		Statements: []string{
+			`ALTER TABLE employees ADD COLUMN token_version INT NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		ID: "007_password_reset_tokens",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS password_reset_tokens (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				employee_id INT NOT NULL,
+				token_hash CHAR(64) NOT NULL,
+				expires_at DATETIME NOT NULL,
+				used_at DATETIME NULL,
+				ip_address VARCHAR(45) NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE KEY uq_password_reset_tokens_hash (token_hash),
+				KEY idx_password_reset_tokens_employee (employee_id)
+			)`,
+		},
+	},
+	{
+		ID: "008_login_attempts_and_audit_logs",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS login_attempts (
+				scope VARCHAR(10) NOT NULL,
+				identifier VARCHAR(255) NOT NULL,
+				failures INT NOT NULL DEFAULT 0,
+				last_failure_at DATETIME NOT NULL,
+				locked_until DATETIME NULL,
+				PRIMARY KEY (scope, identifier),
+				KEY idx_login_attempts_locked (locked_until)
+			)`,
+			`CREATE TABLE IF NOT EXISTS audit_logs (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				action VARCHAR(50) NOT NULL,
+				actor_id INT NULL,
+				subject_id INT NULL,
+				ip_address VARCHAR(45) NULL,
+				details JSON NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				KEY idx_audit_logs_action (action),
+				KEY idx_audit_logs_actor (actor_id),
+				KEY idx_audit_logs_created (created_at)
+			)`,
+		},
+	},
+	{
+		ID: "009_two_factor_auth",
+		Statements: []string{
+			`ALTER TABLE employees
+				ADD COLUMN totp_secret VARCHAR(64) NULL,
+				ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+				ADD COLUMN totp_last_step BIGINT NULL`,
+			`CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+				id BIGINT AUTO_INCREMENT PRIMARY KEY,
+				employee_id INT NOT NULL,
+				code_hash CHAR(64) NOT NULL,
+				used_at DATETIME NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				KEY idx_recovery_codes_employee (employee_id)
+			)`,
+		},
+	},
+	{
+		ID: "010_oidc_login_states",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS oidc_login_states (
+				state_hash CHAR(64) PRIMARY KEY,
+				nonce VARCHAR(64) NOT NULL,
+				code_verifier VARCHAR(128) NOT NULL,
+				expires_at DATETIME NOT NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+	},
+	{
+		ID: "011_service_accounts",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS service_accounts (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				name VARCHAR(100) NOT NULL,
+				description VARCHAR(255) NULL,
+				scopes JSON NOT NULL,
+				key_prefix VARCHAR(16) NOT NULL,
+				key_hash CHAR(64) NOT NULL,
+				created_by INT NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				rotated_at DATETIME NULL,
+				last_used_at DATETIME NULL,
+				revoked_at DATETIME NULL,
+				UNIQUE KEY uq_service_accounts_name (name),
+				UNIQUE KEY uq_service_accounts_key_hash (key_hash)
+			)`,
+		},
+	},
+	{
+		// Permission sebelumnya hardcoded di PermissionMiddleware; isi roles.permissions
+		// dengan set yang sama supaya akses tidak berubah
+		ID: "012_role_permissions",
+		Statements: []string{
+			`UPDATE roles SET permissions = '["*"]' WHERE LOWER(name) = 'super_admin'`,
+			`UPDATE roles SET permissions = '["calendar:team","leave:approve","reports:read","users:read","users:write"]'
+				WHERE LOWER(name) = 'admin'`,
+			`UPDATE roles SET permissions = '["calendar:team","leave:approve","reports:read","users:read"]'
+				WHERE LOWER(name) = 'manager'`,
+			`UPDATE roles SET permissions = '["leave:read","leave:write"]' WHERE LOWER(name) = 'employee'`,
+		},
+	},
+	{
+		// Permission tanpa "@scope" berlaku untuk seluruh organisasi; manager dibatasi
+		// ke department-nya dan employee ke datanya sendiri
+		ID: "013_scoped_role_permissions",
+		Statements: []string{
+			`UPDATE roles SET permissions =
+				'["calendar:team@department","leave:approve@department","reports:read@department","users:read@department"]'
+				WHERE LOWER(name) = 'manager'`,
+			`UPDATE roles SET permissions = '["leave:read@self","leave:write@self"]' WHERE LOWER(name) = 'employee'`,
+		},
+	},
+	{
+		// Sick leave tampil sebagai "Out of office" ke rekan kerja; reason dan leave type asli
+		// terlihat oleh HR lewat permission leave:confidential (default: admin)
+		ID: "014_leave_type_visibility",
+		Statements: []string{
+			`ALTER TABLE leave_type_policies ADD COLUMN calendar_visibility VARCHAR(20) NOT NULL DEFAULT 'full'`,
+			`ALTER TABLE leave_type_policies ADD COLUMN reason_visibility VARCHAR(20) NOT NULL DEFAULT 'approvers'`,
+			`UPDATE leave_type_policies SET calendar_visibility = 'out_of_office' WHERE leave_type = 'sick'`,
+			`UPDATE roles SET permissions = JSON_ARRAY_APPEND(permissions, '$', 'leave:confidential')
+				WHERE LOWER(name) = 'admin' AND NOT JSON_CONTAINS(permissions, '"leave:confidential"')`,
+		},
+	},
+	{
+		// Promosi ke role privileged, reaktivasi dan penyesuaian balance massal menunggu
+		// approval user privileged kedua (changes:approve, default admin dan super_admin)
+		ID: "015_change_requests",
+		Statements: []string{
+			`CREATE TABLE IF NOT EXISTS change_requests (
+				id INT AUTO_INCREMENT PRIMARY KEY,
+				action VARCHAR(50) NOT NULL,
+				subject_id INT NULL,
+				payload JSON NOT NULL,
+				reason VARCHAR(255) NULL,
+				status VARCHAR(20) NOT NULL DEFAULT 'pending',
+				requested_by INT NOT NULL,
+				decided_by INT NULL,
+				decided_at DATETIME NULL,
+				decision_note VARCHAR(255) NULL,
+				expires_at DATETIME NOT NULL,
+				created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				INDEX idx_change_requests_status (status, expires_at)
+			)`,
+			`UPDATE roles SET permissions = JSON_ARRAY_APPEND(permissions, '$', 'changes:approve')
+				WHERE LOWER(name) = 'admin' AND NOT JSON_CONTAINS(permissions, '"changes:approve"')`,
+		},
+	},
+	{
+		// Employee hasil import dengan password sementara wajib ganti password sebelum bisa pakai API
+		ID: "016_must_change_password",
+		Statements: []string{
+			`ALTER TABLE employees ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE`,
+		},
+	},
+	{
+		// Department bisa punya parent (division), head dan cost center, dan di-archive
+		// alih-alih dihapus; departments:write default untuk admin
+		ID: "017_department_hierarchy",
+		Statements: []string{
+			`ALTER TABLE departments
+				ADD COLUMN parent_id INT NULL,
+				ADD COLUMN head_id INT NULL,
+				ADD COLUMN cost_center VARCHAR(50) NULL,
+				ADD COLUMN is_archived BOOLEAN NOT NULL DEFAULT FALSE,
+				ADD COLUMN archived_at DATETIME NULL`,
+			`CREATE UNIQUE INDEX idx_departments_cost_center ON departments (cost_center)`,
+			`UPDATE roles SET permissions = JSON_ARRAY_APPEND(permissions, '$', 'departments:write')
+				WHERE LOWER(name) = 'admin' AND NOT JSON_CONTAINS(permissions, '"departments:write"')`,
+		},
+	},
+}
+
+// Migrate - Jalankan semua migration yang belum tercatat di schema_migrations
+func Migrate() error {
+	_, err := DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		id VARCHAR(100) PRIMARY KEY,
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	for _, m := range migrations {
+		var applied int
+		if err := DB.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE id = ?", m.ID).Scan(&applied); err != nil {
+			return fmt.Errorf("check migration %s: %w", m.ID, err)
+		}
+		if applied > 0 {
+			continue
+		}
+
+		for _, stmt := range m.Statements {
+			if _, err := DB.Exec(stmt); err != nil {
+				return fmt.Errorf("migration %s: %w", m.ID, err)
+			}
+		}
+
+		if _, err := DB.Exec("INSERT INTO schema_migrations (id) VALUES (?)", m.ID); err != nil {
+			return fmt.Errorf("record migration %s: %w", m.ID, err)
+		}
+		log.Printf("🗄️ Applied migration %s", m.ID)
+	}
+
+	return nil
+}
@@ -1,61 +1,50 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"time"
 
+	"leavemaster/auth"
 	"leavemaster/database"
 	"leavemaster/models"
+	"leavemaster/websocket"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func Login(c *gin.Context) {
-	var loginReq models.LoginRequest
-	if err := c.ShouldBindJSON(&loginReq); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	// Updated query dengan join ke departments dan roles
-	query := `
-		SELECT 
-			e.id, e.employee_id, e.name, e.email, e.password, e.position,
-			e.department_id, d.name as department_name,
-			e.role_id, r.name as role_name,
-			e.total_leave_days, e.remaining_leave_days,
-			e.is_manager, e.is_active, e.manager_id,
-			m.name as manager_name
-		FROM employees e
-		LEFT JOIN departments d ON e.department_id = d.id
-		LEFT JOIN roles r ON e.role_id = r.id
-		LEFT JOIN employees m ON e.manager_id = m.id
-		WHERE e.email = ? AND e.is_active = TRUE`
-
+// authEmployeeQuery - Data employee aktif yang dibutuhkan untuk login dan isi token
+const authEmployeeQuery = `
+	SELECT 
+		e.id, e.employee_id, e.name, e.email, e.password, e.position,
+		e.department_id, d.name as department_name,
+		e.role_id, r.name as role_name,
+		e.total_leave_days, e.remaining_leave_days,
+		e.is_manager, e.is_active, e.manager_id,
+		m.name as manager_name, e.token_version, e.totp_enabled, e.must_change_password
+	FROM employees e
+	LEFT JOIN departments d ON e.department_id = d.id
+	LEFT JOIN roles r ON e.role_id = r.id
+	LEFT JOIN employees m ON e.manager_id = m.id`
+
+// loadAuthEmployee - Ambil employee aktif berdasarkan kondisi WHERE (email atau id)
+func loadAuthEmployee(where string, arg interface{}) (models.Employee, error) {
 	var employee models.Employee
 	var deptID, roleID, managerID *int
 	var deptName, roleName, managerName *string
 
-	err := database.DB.QueryRow(query, loginReq.Email).Scan(
+	err := database.DB.QueryRow(authEmployeeQuery+" WHERE "+where+" AND e.is_active = TRUE", arg).Scan(
 		&employee.ID, &employee.EmployeeID, &employee.Name, &employee.Email,
 		&employee.Password, &employee.Position,
 		&deptID, &deptName, &roleID, &roleName,
 		&employee.TotalLeaveDays, &employee.RemainingLeaveDays,
-		&employee.IsManager, &employee.IsActive, &managerID, &managerName,
+		&employee.IsManager, &employee.IsActive, &managerID, &managerName, &employee.TokenVersion,
+		&employee.TwoFactorEnabled, &employee.MustChangePassword,
 	)
-
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials or account inactive"})
-		return
-	}
-
-	// Check password
-	err = bcrypt.CompareHashAndPassword([]byte(employee.Password), []byte(loginReq.Password))
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
-		return
+		return employee, err
 	}
 
 	// Handle nullable fields
@@ -68,16 +57,17 @@ func Login(c *gin.Context) {
 	if managerName != nil {
 		employee.ManagerName = *managerName
 	}
-	if deptID != nil {
-		employee.DepartmentID = deptID
-	}
-	if roleID != nil {
-		employee.RoleID = roleID
-	}
+	employee.DepartmentID = deptID
+	employee.RoleID = roleID
+	employee.ManagerID = managerID
+
+	return employee, nil
+}
 
-	// Generate JWT token dengan claims tambahan
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
+// buildAccessClaims - Claims access token; sid menghubungkan token ke refresh token family
+func buildAccessClaims(employee models.Employee, sessionID string) jwt.MapClaims {
+	now := time.Now()
+	claims := jwt.MapClaims{}
 	claims["employee_id"] = employee.ID
 	claims["is_manager"] = employee.IsManager
 	claims["role_id"] = employee.RoleID
@@ -87,26 +77,201 @@ func Login(c *gin.Context) {
 	} else {
 		claims["department_id"] = nil
 	}
-	claims["exp"] = time.Now().Add(time.Hour * 24).Unix()
+	claims["sid"] = sessionID
+	claims["tv"] = employee.TokenVersion
+	if needsTwoFactorSetup(employee) {
+		claims["2fa_setup"] = true
+	}
+	if employee.MustChangePassword {
+		claims["pwd_change"] = true
+	}
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(auth.AccessTokenTTL()).Unix()
+	return claims
+}
 
-	tokenString, err := token.SignedString([]byte("your-secret-key"))
+// issueAuthResponse - Sign access token untuk session dan susun response login/refresh
+func issueAuthResponse(employee models.Employee, sessionID, refreshToken string) (models.AuthResponse, error) {
+	tokenString, err := auth.SignToken(buildAccessClaims(employee, sessionID))
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	employee.Password = "" // Remove password dari response
+	return models.AuthResponse{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(auth.AccessTokenTTL().Seconds()),
+		Employee:     &employee,
+
+		TwoFactorSetupRequired: needsTwoFactorSetup(employee),
+		PasswordChangeRequired: employee.MustChangePassword,
+	}, nil
+}
+
+// startSession - Buat refresh token family baru dan response login untuk employee
+func startSession(c *gin.Context, employee models.Employee) (models.AuthResponse, error) {
+	sessionID, err := auth.NewSessionID()
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+	refreshToken, err := auth.IssueRefreshToken(employee.ID, sessionID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+	return issueAuthResponse(employee, sessionID, refreshToken)
+}
+
+// invalidateAccessTokens - Naikkan token_version dan putus koneksi WebSocket employee.
+// Kalau endSessions true, refresh token juga di-revoke sehingga employee harus login ulang.
+func invalidateAccessTokens(employeeID int, endSessions bool) error {
+	if err := auth.BumpTokenVersion(employeeID); err != nil {
+		return err
+	}
+	if endSessions {
+		if err := auth.RevokeAllSessions(employeeID); err != nil {
+			return err
+		}
+	}
+	websocket.HubInstance.DisconnectEmployee(employeeID)
+	return nil
+}
+
+var authenticatorChain *auth.AuthenticatorChain
+
+// SetAuthenticatorChain - Dipanggil dari main setelah env dimuat
+func SetAuthenticatorChain(chain *auth.AuthenticatorChain) {
+	authenticatorChain = chain
+}
+
+func authenticators() *auth.AuthenticatorChain {
+	if authenticatorChain == nil {
+		authenticatorChain = auth.NewAuthenticatorChain()
+	}
+	return authenticatorChain
+}
+
+func Login(c *gin.Context) {
+	var loginReq models.LoginRequest
+	if err := c.ShouldBindJSON(&loginReq); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Throttling per akun dan per IP
+	limitKeys := loginLimitKeys(c, loginReq.Email)
+	if wait := loginRetryAfter(limitKeys); wait > 0 {
+		rejectThrottledLogin(c, wait)
+		return
+	}
+
+	employee, err := loadAuthEmployee("e.email = ?", loginReq.Email)
+	if err != nil {
+		recordLoginFailure(c, limitKeys, nil)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials or account inactive"})
+		return
+	}
+
+	// Check password lewat authenticator chain (bcrypt lokal, LDAP, ...) sesuai domain email
+	method, err := authenticators().Authenticate(auth.Credentials{
+		Email:        employee.Email,
+		Password:     loginReq.Password,
+		PasswordHash: employee.Password,
+	})
+	if err != nil {
+		recordLoginFailure(c, limitKeys, &employee.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	resetLoginFailures(limitKeys)
+	if method != "local" {
+		log.Printf("🔑 Login via %s - Employee: %d", method, employee.ID)
+	}
+
+	completePrimaryLogin(c, employee)
+}
+
+// completePrimaryLogin - Setelah langkah pertama login (password atau SSO) lolos:
+// minta kode 2FA kalau aktif, kalau tidak langsung buat session
+func completePrimaryLogin(c *gin.Context, employee models.Employee) {
+	// 2FA aktif - token baru diberikan setelah kode diverifikasi di /api/login/2fa
+	if employee.TwoFactorEnabled {
+		challenge, err := auth.SignChallengeToken(employee.ID, auth.PurposeTwoFactor, twoFactorChallengeTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, models.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+			ExpiresIn:         int64(twoFactorChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	response, err := startSession(c, employee)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
 		return
 	}
 
-	employee.Password = "" // Remove password dari response
-	response := models.AuthResponse{
-		Token:    tokenString,
-		Employee: &employee,
+	c.JSON(http.StatusOK, response)
+}
+
+// RefreshToken - Tukar refresh token dengan access token + refresh token baru (rotasi)
+func RefreshToken(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	employeeID, sessionID, newRefreshToken, err := auth.RotateRefreshToken(req.RefreshToken, c.ClientIP(), c.Request.UserAgent())
+	if err == auth.ErrRefreshTokenInvalid || err == auth.ErrRefreshTokenReused {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	// Data diambil ulang supaya perubahan role/department langsung masuk ke token baru
+	employee, err := loadAuthEmployee("e.id = ?", employeeID)
+	if err != nil {
+		auth.RevokeSession(sessionID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account inactive or not found"})
+		return
+	}
+
+	response, err := issueAuthResponse(employee, sessionID, newRefreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+// Logout - Revoke session dari refresh token. Selalu sukses supaya idempotent.
+func Logout(c *gin.Context) {
+	var req models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := auth.RevokeSessionByToken(req.RefreshToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to logout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
 // ChangePassword - Handler untuk ganti password
 func ChangePassword(c *gin.Context) {
-	employeeID := c.GetInt("employeeID")
+	employeeID := auth.CurrentEmployeeID(c)
 
 	var req struct {
 		CurrentPassword string `json:"current_password" binding:"required"`
@@ -120,8 +285,9 @@ func ChangePassword(c *gin.Context) {
 
 	// Get current password hash
 	var currentPasswordHash string
-	err := database.DB.QueryRow("SELECT password FROM employees WHERE id = ?", employeeID).
-		Scan(&currentPasswordHash)
+	var mustChange bool
+	err := database.DB.QueryRow("SELECT password, must_change_password FROM employees WHERE id = ?", employeeID).
+		Scan(&currentPasswordHash, &mustChange)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
 		return
@@ -142,19 +308,26 @@ func ChangePassword(c *gin.Context) {
 	}
 
 	// Update password
-	_, err = database.DB.Exec("UPDATE employees SET password = ? WHERE id = ?",
+	_, err = database.DB.Exec("UPDATE employees SET password = ?, must_change_password = FALSE WHERE id = ?",
 		string(newPasswordHash), employeeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
+	// Token dengan claim pwd_change harus diganti (refresh token tetap berlaku)
+	if mustChange {
+		if err := invalidateAccessTokens(employeeID, false); err != nil {
+			log.Printf("❌ Failed to revoke tokens for employee %d: %v", employeeID, err)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
 }
 
 // GetProfile - Handler untuk get profile user yang login
 func GetProfile(c *gin.Context) {
-	employeeID := c.GetInt("employeeID")
+	employeeID := auth.CurrentEmployeeID(c)
 
 	query := `
 		SELECT 
@@ -209,7 +382,7 @@ func GetProfile(c *gin.Context) {
 
 // UpdateProfile - Handler untuk update profile
 func UpdateProfile(c *gin.Context) {
-	employeeID := c.GetInt("employeeID")
+	employeeID := auth.CurrentEmployeeID(c)
 
 	var req struct {
 		Name     string `json:"name"`
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"leavemaster/database"
+	"leavemaster/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// autoApprovalRuleRequest - Body untuk create/update auto-approval rule
+type autoApprovalRuleRequest struct {
+	Name                string  `json:"name" binding:"required"`
+	LeaveType           *string `json:"leave_type"`
+	MaxDays             *int    `json:"max_days"`
+	MinNoticeDays       *int    `json:"min_notice_days"`
+	MinRemainingBalance *int    `json:"min_remaining_balance"`
+	MaxTeamAbsent       *int    `json:"max_team_absent"`
+	Priority            int     `json:"priority"`
+	IsActive            *bool   `json:"is_active"`
+}
+
+const autoApprovalRuleColumns = `id, name, leave_type, max_days, min_notice_days,
+	min_remaining_balance, max_team_absent, priority, is_active, created_at`
+
+func scanAutoApprovalRule(scanner rowScanner, rule *models.AutoApprovalRule) error {
+	return scanner.Scan(
+		&rule.ID, &rule.Name, &rule.LeaveType, &rule.MaxDays, &rule.MinNoticeDays,
+		&rule.MinRemainingBalance, &rule.MaxTeamAbsent, &rule.Priority, &rule.IsActive, &rule.CreatedAt,
+	)
+}
+
+// dateOnly - Potong tanggal jadi YYYY-MM-DD (hasil scan DB bentuknya "2024-02-15T00:00:00Z")
+func dateOnly(value string) string {
+	if len(value) > 10 {
+		return value[:10]
+	}
+	return value
+}
+
+// parseLeaveDate - Parse tanggal leave request (YYYY-MM-DD, boleh diikuti jam)
+func parseLeaveDate(value string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02", dateOnly(value), time.Local)
+}
+
+// daysBetween - Selisih hari kalender dari from ke to. Tanggal dinormalkan ke tengah malam UTC
+// supaya perpindahan DST (hari 23 atau 25 jam) tidak menggeser hasilnya.
+func daysBetween(from, to time.Time) int {
+	fromDate := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDate := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toDate.Sub(fromDate).Hours() / 24)
+}
+
+// leaveDays - Jumlah hari leave request (start sampai end, inklusif); 0 kalau tanggal tidak valid
+func leaveDays(startDate, endDate string) int {
+	start, err := parseLeaveDate(startDate)
+	if err != nil {
+		return 0
+	}
+	end, err := parseLeaveDate(endDate)
+	if err != nil || end.Before(start) {
+		return 0
+	}
+	return daysBetween(start, end) + 1
+}
+
+// today - Tanggal hari ini jam 00:00 waktu lokal
+func today() time.Time {
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// findAutoApprovalRule - Cari rule aktif pertama (urut priority) yang cocok dengan leave request.
+// Return nil kalau tidak ada rule yang cocok.
+func findAutoApprovalRule(leaveReq models.LeaveRequest, remainingDays, departmentID int) (*models.AutoApprovalRule, error) {
+	startDate, err := parseLeaveDate(leaveReq.StartDate)
+	if err != nil {
+		return nil, nil // Tanggal tidak valid - biarkan manager yang review
+	}
+	noticeDays := daysBetween(today(), startDate)
+
+	rows, err := database.DB.Query(`SELECT ` + autoApprovalRuleColumns + `
+		FROM auto_approval_rules
+		WHERE is_active = TRUE
+		ORDER BY priority DESC, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.AutoApprovalRule
+	for rows.Next() {
+		var rule models.AutoApprovalRule
+		if err := scanAutoApprovalRule(rows, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	teamAbsent := -1 // Lazy - hanya dihitung kalau ada rule yang butuh
+	for i := range rules {
+		rule := &rules[i]
+
+		if rule.LeaveType != nil && !strings.EqualFold(*rule.LeaveType, leaveReq.LeaveType) {
+			continue
+		}
+		if rule.MaxDays != nil && leaveReq.TotalDays > *rule.MaxDays {
+			continue
+		}
+		if rule.MinNoticeDays != nil && noticeDays < *rule.MinNoticeDays {
+			continue
+		}
+		if rule.MinRemainingBalance != nil && remainingDays-leaveReq.TotalDays < *rule.MinRemainingBalance {
+			continue
+		}
+		if rule.MaxTeamAbsent != nil {
+			if teamAbsent < 0 {
+				teamAbsent, err = countTeamAbsences(departmentID, leaveReq.EmployeeID, leaveReq.StartDate, leaveReq.EndDate)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if teamAbsent >= *rule.MaxTeamAbsent {
+				continue
+			}
+		}
+
+		return rule, nil
+	}
+
+	return nil, nil
+}
+
+// countTeamAbsences - Jumlah rekan satu department yang sudah approved cuti di rentang tanggal yang overlap
+func countTeamAbsences(departmentID, employeeID int, startDate, endDate string) (int, error) {
+	var count int
+	err := database.DB.QueryRow(`
+		SELECT COUNT(DISTINCT lr.employee_id)
+		FROM leave_requests lr
+		JOIN employees e ON lr.employee_id = e.id
+		WHERE e.department_id = ? AND lr.employee_id <> ?
+		AND lr.status = 'approved'
+		AND lr.start_date <= ? AND lr.end_date >= ?`,
+		departmentID, employeeID, endDate, startDate).Scan(&count)
+	return count, err
+}
+
+// GetAutoApprovalRules - List semua auto-approval rules
+func GetAutoApprovalRules(c *gin.Context) {
+	rows, err := database.DB.Query(`SELECT ` + autoApprovalRuleColumns + `
+		FROM auto_approval_rules
+		ORDER BY priority DESC, id`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	rules := []models.AutoApprovalRule{}
+	for rows.Next() {
+		var rule models.AutoApprovalRule
+		if err := scanAutoApprovalRule(rows, &rule); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		rules = append(rules, rule)
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateAutoApprovalRule - Tambah auto-approval rule baru
+func CreateAutoApprovalRule(c *gin.Context) {
+	var req autoApprovalRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	result, err := database.DB.Exec(`
+		INSERT INTO auto_approval_rules
+		(name, leave_type, max_days, min_notice_days, min_remaining_balance, max_team_absent, priority, is_active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		req.Name, req.LeaveType, req.MaxDays, req.MinNoticeDays,
+		req.MinRemainingBalance, req.MaxTeamAbsent, req.Priority, isActive)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	log.Printf("✅ AUTO-APPROVAL RULE CREATED: %s (ID=%d)", req.Name, id)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Auto-approval rule created successfully",
+		"id":      id,
+	})
+}
+
+// UpdateAutoApprovalRule - Ganti seluruh isi auto-approval rule
+func UpdateAutoApprovalRule(c *gin.Context) {
+	ruleID := c.Param("id")
+
+	var req autoApprovalRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	isActive := true
+	if req.IsActive != nil {
+		isActive = *req.IsActive
+	}
+
+	_, err := database.DB.Exec(`
+		UPDATE auto_approval_rules SET
+			name = ?, leave_type = ?, max_days = ?, min_notice_days = ?,
+			min_remaining_balance = ?, max_team_absent = ?, priority = ?, is_active = ?
+		WHERE id = ?`,
+		req.Name, req.LeaveType, req.MaxDays, req.MinNoticeDays,
+		req.MinRemainingBalance, req.MaxTeamAbsent, req.Priority, isActive, ruleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rule models.AutoApprovalRule
+	err = scanAutoApprovalRule(database.DB.QueryRow(`SELECT `+autoApprovalRuleColumns+`
+		FROM auto_approval_rules WHERE id = ?`, ruleID), &rule)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Auto-approval rule not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("✏️ AUTO-APPROVAL RULE UPDATED: %s (ID=%d)", rule.Name, rule.ID)
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteAutoApprovalRule - Hapus auto-approval rule
+func DeleteAutoApprovalRule(c *gin.Context) {
+	ruleID := c.Param("id")
+
+	result, err := database.DB.Exec("DELETE FROM auto_approval_rules WHERE id = ?", ruleID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Auto-approval rule not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Auto-approval rule deleted successfully"})
+}
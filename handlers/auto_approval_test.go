@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+// Hari perpindahan DST hanya 23 atau 25 jam; hitungan hari harus tetap per tanggal kalender
+func TestDaysBetweenAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		from, to time.Time
+		want     int
+	}{
+		{"same day", time.Date(2024, 3, 30, 0, 0, 0, 0, berlin), time.Date(2024, 3, 30, 0, 0, 0, 0, berlin), 0},
+		{"spring forward", time.Date(2024, 3, 30, 0, 0, 0, 0, berlin), time.Date(2024, 4, 1, 0, 0, 0, 0, berlin), 2},
+		{"fall back", time.Date(2024, 10, 26, 0, 0, 0, 0, berlin), time.Date(2024, 10, 28, 0, 0, 0, 0, berlin), 2},
+		{"backwards", time.Date(2024, 4, 1, 0, 0, 0, 0, berlin), time.Date(2024, 3, 30, 0, 0, 0, 0, berlin), -2},
+		{"time of day ignored", time.Date(2024, 3, 30, 23, 30, 0, 0, berlin), time.Date(2024, 3, 31, 0, 15, 0, 0, berlin), 1},
+	}
+	for _, tc := range cases {
+		if got := daysBetween(tc.from, tc.to); got != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLeaveDays(t *testing.T) {
+	cases := []struct {
+		start, end string
+		want       int
+	}{
+		{"2024-02-15", "2024-02-15", 1},
+		{"2024-02-15", "2024-02-17", 3},
+		{"2024-02-28", "2024-03-01", 3}, // tahun kabisat
+		{"2024-03-30", "2024-04-02", 4},
+		{"2024-02-15T00:00:00Z", "2024-02-16T00:00:00Z", 2},
+		{"2024-02-17", "2024-02-15", 0},
+		{"not-a-date", "2024-02-15", 0},
+	}
+	for _, tc := range cases {
+		if got := leaveDays(tc.start, tc.end); got != tc.want {
+			t.Errorf("leaveDays(%q, %q): got %d, want %d", tc.start, tc.end, got, tc.want)
+		}
+	}
+}
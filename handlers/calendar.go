@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"leavemaster/auth"
 	"leavemaster/database"
 
 	"github.com/gin-gonic/gin"
@@ -24,56 +25,49 @@ type CalendarEvent struct {
 }
 
 func GetCalendarEvents(c *gin.Context) {
-	// Get user info dari context
-	employeeID, _ := c.Get("employee_id")
-	isManager, _ := c.Get("is_manager")
-	userRole, _ := c.Get("role_name")
-	userDeptID, hasDept := c.Get("department_id")
+	// Semua orang lihat leave yang approved; leave pending hanya dalam scope calendar:team
+	// caller (tanpa permission itu: hanya pending milik sendiri)
+	identity, _ := auth.CurrentIdentity(c)
+	employeeID, userRole := identity.EmployeeID, identity.RoleName
+	scope, err := auth.PermissionScopeOf(identity, "calendar:team")
+	if err != nil {
+		log.Printf("⚠️ Failed to load calendar:team scope: %v", err)
+	}
+	if scope == auth.ScopeNone {
+		scope = auth.ScopeSelf
+	}
+	scopeClause, args := auth.ScopeFilter(c, scope, "e")
 
-	log.Printf("📅 GetCalendarEvents - EmployeeID: %v, IsManager: %v, Role: %s, DeptID: %v",
-		employeeID, isManager, userRole, userDeptID)
+	log.Printf("📅 GetCalendarEvents - EmployeeID: %d, Role: %s, Pending scope: %s", employeeID, userRole, scope)
 
-	var rows *sql.Rows
-	var err error
-	var query string
-	var args []interface{}
+	// Leave type yang disembunyikan policy (mis. sick) tampil sebagai "Out of office"
+	viewer, err := newLeaveViewer(c)
+	if err != nil {
+		log.Printf("❌ Failed to load leave visibility: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar events"})
+		return
+	}
+	leaveType, typeArgs := viewer.leaveTypeSQL("lr.leave_type", "p")
 
-	if isManager == true && hasDept {
-		// Manager can see team leaves in their department - CASE INSENSITIVE
-		query = `
-            SELECT 
-                lr.id, 
-                lr.start_date, 
-                lr.end_date, 
-                lr.leave_type, 
-                lr.status, 
-                e.name as employee_name,
-                COALESCE(d.name, 'General') as department
-            FROM leave_requests lr
-            JOIN employees e ON lr.employee_id = e.id
-            LEFT JOIN departments d ON e.department_id = d.id
-            WHERE e.department_id = ? AND (LOWER(lr.status) = 'approved' OR LOWER(lr.status) = 'pending')
-            ORDER BY lr.start_date`
-		args = []interface{}{userDeptID}
-	} else {
-		// Regular employee can see only approved leaves - CASE INSENSITIVE
-		query = `
+	var rows *sql.Rows
+	query := `
             SELECT 
                 lr.id, 
                 lr.start_date, 
                 lr.end_date, 
-                lr.leave_type, 
+                ` + leaveType + `, 
                 lr.status, 
                 e.name as employee_name,
                 COALESCE(d.name, 'General') as department
             FROM leave_requests lr
             JOIN employees e ON lr.employee_id = e.id
             LEFT JOIN departments d ON e.department_id = d.id
+            ` + leavePolicyJoin + `
             WHERE LOWER(lr.status) = 'approved'
+               OR (LOWER(lr.status) = 'pending' AND ` + scopeClause + `)
             ORDER BY lr.start_date`
-	}
 
-	rows, err = database.DB.Query(query, args...)
+	rows, err = database.DB.Query(query, append(typeArgs, args...)...)
 	if err != nil {
 		log.Printf("❌ Calendar query failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load calendar events"})
@@ -103,7 +97,7 @@ func GetCalendarEvents(c *gin.Context) {
 			event.Department = "General"
 		}
 
-		event.Title = event.EmployeeName + " - " + event.Type
+		event.Title = event.EmployeeName + " - " + leaveTypeLabel(event.Type)
 		if strings.ToLower(event.Status) == "pending" {
 			event.Title += " (Pending)"
 		}
@@ -121,83 +115,44 @@ func GetCalendarEvents(c *gin.Context) {
 		log.Printf("⚠️ Row iteration error: %v", err)
 	}
 
-	log.Printf("✅ Loaded %d calendar events for user %s (role: %s)", len(events), employeeID, userRole)
+	log.Printf("✅ Loaded %d calendar events for user %d (role: %s)", len(events), employeeID, userRole)
 	c.JSON(http.StatusOK, events)
 }
 
 func GetTeamLeaveCalendar(c *gin.Context) {
-	// Get user info dari context
-	employeeID, _ := c.Get("employee_id")
-	isManager, _ := c.Get("is_manager")
-	userRole, _ := c.Get("role_name")
-	userDeptID, hasDept := c.Get("department_id")
-
-	log.Printf("📅 GetTeamLeaveCalendar - EmployeeID: %v, IsManager: %v, Role: %s, DeptID: %v",
-		employeeID, isManager, userRole, userDeptID)
-
-	// Check if user is manager or admin
-	// if !(isManager == true || userRole == "admin" || userRole == "super_admin") {
-	// 	c.JSON(http.StatusForbidden, gin.H{"error": "Access denied - manager role required"})
-	// 	return
-	// }
-
-	var query string
-	var args []interface{}
-
-	if userRole == "admin" || userRole == "super_admin" {
-		// Admin can see all team leaves - CASE INSENSITIVE
-		query = `
-            SELECT 
-                lr.id, 
-                lr.start_date, 
-                lr.end_date, 
-                lr.leave_type, 
-                lr.status, 
-                e.name as employee_name,
-                COALESCE(d.name, 'General') as department
-            FROM leave_requests lr
-            JOIN employees e ON lr.employee_id = e.id
-            LEFT JOIN departments d ON e.department_id = d.id
-            WHERE LOWER(lr.status) IN ('approved', 'pending')
-            ORDER BY lr.start_date`
-	} else if isManager == true && hasDept {
-		// Manager can see team leaves in their department - CASE INSENSITIVE
-		query = `
+	// Data dibatasi scope calendar:team caller (team, department atau organisasi)
+	employeeID := auth.CurrentEmployeeID(c)
+	scope := auth.CurrentScope(c)
+	scopeClause, args := auth.ScopeFilter(c, scope, "e")
+
+	log.Printf("📅 GetTeamLeaveCalendar - EmployeeID: %d, Role: %s, Scope: %s",
+		employeeID, auth.CurrentRole(c), scope)
+
+	viewer, err := newLeaveViewer(c)
+	if err != nil {
+		log.Printf("❌ Failed to load leave visibility: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load team calendar"})
+		return
+	}
+	leaveType, typeArgs := viewer.leaveTypeSQL("lr.leave_type", "p")
+
+	query := `
             SELECT 
                 lr.id, 
                 lr.start_date, 
                 lr.end_date, 
-                lr.leave_type, 
+                ` + leaveType + `, 
                 lr.status, 
                 e.name as employee_name,
                 COALESCE(d.name, 'General') as department
             FROM leave_requests lr
             JOIN employees e ON lr.employee_id = e.id
             LEFT JOIN departments d ON e.department_id = d.id
-            WHERE e.department_id = ? AND LOWER(lr.status) IN ('approved', 'pending')
+            ` + leavePolicyJoin + `
+            WHERE ` + scopeClause + ` AND LOWER(lr.status) IN ('approved', 'pending')
             ORDER BY lr.start_date`
-		args = []interface{}{userDeptID}
-	} else {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
-
-	// DEBUG: Test query dulu
-	testQuery := `
-        SELECT COUNT(*) as total_events
-        FROM leave_requests lr
-        JOIN employees e ON lr.employee_id = e.id
-        WHERE e.department_id = ? AND LOWER(lr.status) IN ('approved', 'pending')`
-
-	var totalEvents int
-	err := database.DB.QueryRow(testQuery, userDeptID).Scan(&totalEvents)
-	if err != nil {
-		log.Printf("❌ Test query failed: %v", err)
-	} else {
-		log.Printf("🔍 DEBUG: Found %d events in department %v", totalEvents, userDeptID)
-	}
 
-	rows, err := database.DB.Query(query, args...)
+	rows, err := database.DB.Query(query, append(typeArgs, args...)...)
 	if err != nil {
 		log.Printf("❌ Team calendar query failed: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load team calendar"})
@@ -227,7 +182,7 @@ func GetTeamLeaveCalendar(c *gin.Context) {
 			event.Department = "General"
 		}
 
-		event.Title = event.EmployeeName + " - " + event.Type
+		event.Title = event.EmployeeName + " - " + leaveTypeLabel(event.Type)
 		if strings.ToLower(event.Status) == "pending" {
 			event.Title += " (Pending)"
 		}
@@ -246,7 +201,7 @@ func GetTeamLeaveCalendar(c *gin.Context) {
 		log.Printf("⚠️ Row iteration error: %v", err)
 	}
 
-	log.Printf("✅ FINAL: Loaded %d team calendar events for user %s (dept: %v)", len(events), employeeID, userDeptID)
+	log.Printf("✅ FINAL: Loaded %d team calendar events for user %d (scope: %s)", len(events), employeeID, scope)
 	c.JSON(http.StatusOK, events)
 }
 
@@ -0,0 +1,479 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/models"
+	"leavemaster/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Jenis change request. Masing-masing punya payload sendiri di kolom payload (JSON).
+const (
+	changeRoleChange        = "role_change"
+	changeReactivation      = "reactivation"
+	changeBalanceAdjustment = "balance_adjustment"
+)
+
+type roleChangePayload struct {
+	EmployeeID int    `json:"employee_id"`
+	RoleID     int    `json:"role_id"`
+	RoleName   string `json:"role_name"`
+}
+
+type reactivationPayload struct {
+	EmployeeID int `json:"employee_id"`
+}
+
+type balanceAdjustmentPayload struct {
+	EmployeeIDs []int `json:"employee_ids"`
+	Days        int   `json:"days"`
+}
+
+const changeRequestColumns = `cr.id, cr.action, cr.subject_id, s.name, cr.payload, COALESCE(cr.reason, ''),
+	cr.status, cr.requested_by, COALESCE(r.name, ''), cr.decided_by, cr.decided_at,
+	COALESCE(cr.decision_note, ''), cr.expires_at, cr.created_at`
+
+const changeRequestJoins = `LEFT JOIN employees s ON cr.subject_id = s.id
+	LEFT JOIN employees r ON cr.requested_by = r.id`
+
+func scanChangeRequest(row rowScanner) (models.ChangeRequest, error) {
+	var cr models.ChangeRequest
+	var payload string
+	err := row.Scan(&cr.ID, &cr.Action, &cr.SubjectID, &cr.SubjectName, &payload, &cr.Reason,
+		&cr.Status, &cr.RequestedBy, &cr.RequestedByName, &cr.DecidedBy, &cr.DecidedAt,
+		&cr.DecisionNote, &cr.ExpiresAt, &cr.CreatedAt)
+	if err != nil {
+		return cr, err
+	}
+	if err := json.Unmarshal([]byte(payload), &cr.Payload); err != nil {
+		return cr, err
+	}
+	return cr, nil
+}
+
+// roleIsManager - Role yang otomatis mendapat flag is_manager
+func roleIsManager(roleName string) bool {
+	return roleName == "manager" || roleName == "admin" || roleName == "super_admin"
+}
+
+// createChangeRequest - Simpan perubahan yang menunggu approval; belum ada yang diubah di employees
+func createChangeRequest(c *gin.Context, action string, subjectID *int, payload interface{}, reason string) (int, error) {
+	if identity, _ := auth.CurrentIdentity(c); identity.IsImpersonated() {
+		return 0, errImpersonatedChange
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	requestedBy := auth.CurrentEmployeeID(c)
+	expiresAt := time.Now().Add(auth.ChangeRequestTTL())
+	result, err := database.DB.Exec(`
+		INSERT INTO change_requests (action, subject_id, payload, reason, requested_by, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		action, subjectID, string(data), reason, requestedBy, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	id, _ := result.LastInsertId()
+
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    "change_request_created",
+		ActorID:   &requestedBy,
+		SubjectID: subjectID,
+		IPAddress: c.ClientIP(),
+		Details: map[string]interface{}{
+			"change_request_id": id,
+			"change":            action,
+			"payload":           payload,
+			"reason":            reason,
+			"expires_at":        expiresAt.UTC().Format(time.RFC3339),
+		},
+	})
+	log.Printf("⏳ Change request %d (%s) created by employee %d", id, action, requestedBy)
+	return int(id), nil
+}
+
+// expireChangeRequests - Tandai change request pending yang sudah lewat expires_at.
+// expires_at ditulis dari time.Now(), jadi dibandingkan dengan waktu Go (bukan NOW() MySQL).
+func expireChangeRequests() error {
+	rows, err := database.DB.Query(`SELECT id, action, subject_id FROM change_requests
+		WHERE status = 'pending' AND expires_at <= ?`, time.Now())
+	if err != nil {
+		return err
+	}
+	type expired struct {
+		id        int
+		action    string
+		subjectID *int
+	}
+	var stale []expired
+	for rows.Next() {
+		var e expired
+		if err := rows.Scan(&e.id, &e.action, &e.subjectID); err != nil {
+			rows.Close()
+			return err
+		}
+		stale = append(stale, e)
+	}
+	rows.Close()
+
+	for _, e := range stale {
+		result, err := database.DB.Exec(`UPDATE change_requests SET status = 'expired'
+			WHERE id = ? AND status = 'pending'`, e.id)
+		if err != nil {
+			return err
+		}
+		// Instance lain bisa saja sudah meng-expire lebih dulu
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			continue
+		}
+		services.RecordAuditEvent(services.AuditEvent{
+			Action:    "change_request_expired",
+			SubjectID: e.subjectID,
+			Details:   map[string]interface{}{"change_request_id": e.id, "change": e.action},
+		})
+	}
+	return nil
+}
+
+// GetChangeRequests - Daftar change request, filter ?status=pending|approved|rejected|cancelled|expired
+func GetChangeRequests(c *gin.Context) {
+	if err := expireChangeRequests(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := `SELECT ` + changeRequestColumns + ` FROM change_requests cr ` + changeRequestJoins
+	var args []interface{}
+	if status := c.Query("status"); status != "" {
+		query += " WHERE cr.status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY cr.created_at DESC"
+
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	requests := []models.ChangeRequest{}
+	for rows.Next() {
+		cr, err := scanChangeRequest(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		requests = append(requests, cr)
+	}
+
+	c.JSON(http.StatusOK, requests)
+}
+
+// ApproveChangeRequest - User privileged kedua (bukan yang mengajukan) menerapkan perubahan
+func ApproveChangeRequest(c *gin.Context) {
+	decideChangeRequest(c, "approved")
+}
+
+// RejectChangeRequest - Tolak change request; tidak ada perubahan yang diterapkan
+func RejectChangeRequest(c *gin.Context) {
+	decideChangeRequest(c, "rejected")
+}
+
+// CancelChangeRequest - Pengaju menarik kembali change request miliknya
+func CancelChangeRequest(c *gin.Context) {
+	decideChangeRequest(c, "cancelled")
+}
+
+func decideChangeRequest(c *gin.Context, status string) {
+	if rejectImpersonatedDecision(c) {
+		return
+	}
+	var req models.ChangeRequestDecision
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := expireChangeRequests(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	identity, _ := auth.CurrentIdentity(c)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	cr, err := scanChangeRequest(tx.QueryRow(`SELECT `+changeRequestColumns+` FROM change_requests cr `+
+		changeRequestJoins+` WHERE cr.id = ? FOR UPDATE`, c.Param("id")))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if cr.Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Change request is already " + cr.Status})
+		return
+	}
+	if !cr.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusGone, gin.H{"error": "Change request has expired"})
+		return
+	}
+
+	switch status {
+	case "cancelled":
+		if cr.RequestedBy != identity.EmployeeID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the requester can cancel a change request"})
+			return
+		}
+	case "approved":
+		if message := checkChangeApprover(c, identity, cr); message != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": message})
+			return
+		}
+		if err := applyChangeRequest(tx, cr); err != nil {
+			if err == sql.ErrNoRows {
+				c.JSON(http.StatusConflict, gin.H{"error": "Change no longer applies: employee not found or already changed"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+	}
+
+	_, err = tx.Exec(`UPDATE change_requests
+		SET status = ?, decided_by = ?, decided_at = NOW(), decision_note = ?
+		WHERE id = ?`, status, identity.EmployeeID, req.Note, cr.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if status == "approved" && cr.Action == changeRoleChange && cr.SubjectID != nil {
+		// Role ada di claims - token lama harus ditolak
+		if err := invalidateAccessTokens(*cr.SubjectID, false); err != nil {
+			log.Printf("❌ Failed to revoke tokens for employee %d: %v", *cr.SubjectID, err)
+		}
+	}
+
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    "change_request_" + status,
+		ActorID:   &identity.EmployeeID,
+		SubjectID: cr.SubjectID,
+		IPAddress: c.ClientIP(),
+		Details: map[string]interface{}{
+			"change_request_id": cr.ID,
+			"change":            cr.Action,
+			"payload":           cr.Payload,
+			"requested_by":      cr.RequestedBy,
+			"note":              req.Note,
+		},
+	})
+	log.Printf("✅ Change request %d (%s) %s by employee %d", cr.ID, cr.Action, status, identity.EmployeeID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Change request " + status, "id": cr.ID, "status": status})
+}
+
+// checkChangeApprover - Approver harus orang lain, berlaku untuk seluruh organisasi, dan
+// untuk promosi ke role dengan "*" harus punya "*" juga. Return pesan error, "" kalau boleh.
+func checkChangeApprover(c *gin.Context, identity auth.Identity, cr models.ChangeRequest) string {
+	if cr.RequestedBy == identity.EmployeeID {
+		return "A change request must be approved by someone other than the requester"
+	}
+	if auth.CurrentScope(c) != auth.ScopeOrganisation {
+		return "Approving change requests requires changes:approve for the whole organisation"
+	}
+	if cr.Action == changeRoleChange {
+		roleName, _ := cr.Payload["role_name"].(string)
+		grantsAll, err := auth.GrantsAllPermissions(roleName)
+		if err != nil {
+			return "Failed to check approver permissions"
+		}
+		if grantsAll {
+			approverGrantsAll, err := auth.GrantsAllPermissions(identity.RoleName)
+			if err != nil || !approverGrantsAll {
+				return "Only a super admin can approve a promotion to " + roleName
+			}
+		}
+	}
+	return ""
+}
+
+// applyChangeRequest - Terapkan perubahan di dalam transaksi approval. sql.ErrNoRows kalau
+// target sudah tidak cocok (employee dihapus, sudah aktif, dst).
+func applyChangeRequest(tx *sql.Tx, cr models.ChangeRequest) error {
+	data, err := json.Marshal(cr.Payload)
+	if err != nil {
+		return err
+	}
+
+	var result sql.Result
+	switch cr.Action {
+	case changeRoleChange:
+		var payload roleChangePayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return err
+		}
+		// Employee dan role-nya harus masih ada saat di-approve
+		var exists int
+		err = tx.QueryRow("SELECT COUNT(*) FROM employees e JOIN roles r ON r.id = ? WHERE e.id = ?",
+			payload.RoleID, payload.EmployeeID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists == 0 {
+			return sql.ErrNoRows
+		}
+		_, err = tx.Exec("UPDATE employees SET role_id = ?, is_manager = ? WHERE id = ?",
+			payload.RoleID, roleIsManager(payload.RoleName), payload.EmployeeID)
+		return err
+	case changeReactivation:
+		var payload reactivationPayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return err
+		}
+		result, err = tx.Exec("UPDATE employees SET is_active = TRUE WHERE id = ? AND is_active = FALSE",
+			payload.EmployeeID)
+	case changeBalanceAdjustment:
+		var payload balanceAdjustmentPayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return err
+		}
+		if len(payload.EmployeeIDs) == 0 {
+			return sql.ErrNoRows
+		}
+		args := []interface{}{payload.Days, payload.Days}
+		for _, id := range payload.EmployeeIDs {
+			args = append(args, id)
+		}
+		result, err = tx.Exec(`UPDATE employees
+			SET total_leave_days = total_leave_days + ?, remaining_leave_days = remaining_leave_days + ?
+			WHERE is_active = TRUE AND id IN (`+placeholders(len(payload.EmployeeIDs))+`)`, args...)
+	default:
+		log.Printf("⚠️ Unknown change request action %q (ID: %d)", cr.Action, cr.ID)
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// placeholders - "?, ?, ?" untuk klausa IN
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// CreateBalanceAdjustment - Penyesuaian balance cuti massal; diterapkan setelah change request di-approve
+func CreateBalanceAdjustment(c *gin.Context) {
+	if rejectImpersonatedDecision(c) {
+		return
+	}
+	var req models.BalanceAdjustmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Semua employee harus aktif dan dalam scope users:write caller
+	seen := map[int]bool{}
+	var ids []int
+	for _, id := range req.EmployeeIDs {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	scopeClause, args := auth.ScopeFilter(c, auth.CurrentScope(c), "e")
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	var found int
+	err := database.DB.QueryRow(`SELECT COUNT(*) FROM employees e
+		WHERE e.is_active = TRUE AND `+scopeClause+` AND e.id IN (`+placeholders(len(ids))+`)`, args...).Scan(&found)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if found != len(ids) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Some employees were not found or are inactive"})
+		return
+	}
+
+	var subjectID *int
+	if len(ids) == 1 {
+		subjectID = &ids[0]
+	}
+	id, err := createChangeRequest(c, changeBalanceAdjustment, subjectID,
+		balanceAdjustmentPayload{EmployeeIDs: ids, Days: req.Days}, req.Reason)
+	if err != nil {
+		c.JSON(changeRequestErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":           "Balance adjustment is waiting for approval",
+		"change_request_id": id,
+	})
+}
+
+// changeRequestErrorStatus - 403 kalau change request ditolak karena impersonation, selain itu 500
+func changeRequestErrorStatus(err error) int {
+	if err == errImpersonatedChange {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// requestRoleChange - Promosi ke role privileged jadi change request. ok=false kalau role
+// bukan privileged (boleh langsung diubah).
+func requestRoleChange(c *gin.Context, employeeID, roleID int, roleName, reason string) (int, bool, error) {
+	privileged, err := auth.IsPrivilegedRole(roleName)
+	if err != nil || !privileged {
+		return 0, false, err
+	}
+	id, err := createChangeRequest(c, changeRoleChange, &employeeID,
+		roleChangePayload{EmployeeID: employeeID, RoleID: roleID, RoleName: roleName}, reason)
+	return id, true, err
+}
+
+// requestReactivation - Mengaktifkan kembali employee nonaktif jadi change request.
+// ok=false kalau employee masih aktif (tidak ada yang perlu di-approve).
+func requestReactivation(c *gin.Context, employeeID int, reason string) (int, bool, error) {
+	var isActive bool
+	if err := database.DB.QueryRow("SELECT is_active FROM employees WHERE id = ?", employeeID).Scan(&isActive); err != nil {
+		return 0, false, err
+	}
+	if isActive {
+		return 0, false, nil
+	}
+	id, err := createChangeRequest(c, changeReactivation, &employeeID, reactivationPayload{EmployeeID: employeeID}, reason)
+	return id, true, err
+}
@@ -0,0 +1,400 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/models"
+	"leavemaster/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// departmentColumns - Kolom yang dibaca scanDepartment (butuh JOIN departments pd, employees h)
+const departmentColumns = `d.id, d.name, COALESCE(d.description, ''), d.parent_id, pd.name,
+	d.head_id, h.name, d.cost_center, d.is_archived, d.archived_at, d.created_at`
+
+const departmentJoins = `LEFT JOIN departments pd ON d.parent_id = pd.id
+	LEFT JOIN employees h ON d.head_id = h.id`
+
+func scanDepartment(scanner rowScanner) (models.Department, error) {
+	var dept models.Department
+	var parentName, headName *string
+	err := scanner.Scan(&dept.ID, &dept.Name, &dept.Description, &dept.ParentID, &parentName,
+		&dept.HeadID, &headName, &dept.CostCenter, &dept.IsArchived, &dept.ArchivedAt, &dept.CreatedAt)
+	if err != nil {
+		return dept, err
+	}
+	if parentName != nil {
+		dept.ParentName = *parentName
+	}
+	if headName != nil {
+		dept.HeadName = *headName
+	}
+	return dept, nil
+}
+
+// GetDepartments - Semua department aktif; include_archived=true untuk ikut menampilkan yang di-archive
+func GetDepartments(c *gin.Context) {
+	query := "SELECT " + departmentColumns + " FROM departments d " + departmentJoins
+	if includeArchived, _ := strconv.ParseBool(c.Query("include_archived")); !includeArchived {
+		query += " WHERE d.is_archived = FALSE"
+	}
+	rows, err := database.DB.Query(query + " ORDER BY d.name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	departments := []models.Department{}
+	for rows.Next() {
+		dept, err := scanDepartment(rows)
+		if err != nil {
+			log.Printf("❌ Failed to scan department row: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read departments: " + err.Error()})
+			return
+		}
+		departments = append(departments, dept)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, departments)
+}
+
+// checkDepartmentAssignable - Employee hanya boleh dimasukkan ke department yang ada dan belum di-archive.
+// Return alasan penolakan, "" kalau boleh.
+func checkDepartmentAssignable(departmentID int) (string, error) {
+	var archived bool
+	err := database.DB.QueryRow("SELECT is_archived FROM departments WHERE id = ?", departmentID).Scan(&archived)
+	if err == sql.ErrNoRows {
+		return "Department not found", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if archived {
+		return "Department is archived", nil
+	}
+	return "", nil
+}
+
+// checkDepartmentParent - Parent harus department aktif dan bukan department itu sendiri atau
+// salah satu sub-department-nya (departmentID 0 = department baru)
+func checkDepartmentParent(departmentID, parentID int) (string, error) {
+	if departmentID != 0 && parentID == departmentID {
+		return "A department cannot be its own parent", nil
+	}
+	if reason, err := checkDepartmentAssignable(parentID); reason != "" || err != nil {
+		return strings.Replace(reason, "Department", "Parent department", 1), err
+	}
+	if departmentID == 0 {
+		return "", nil
+	}
+
+	seen := map[int]bool{}
+	for current := parentID; ; {
+		if current == departmentID {
+			return "Parent department would form a cycle", nil
+		}
+		if seen[current] {
+			return "", nil
+		}
+		seen[current] = true
+
+		var next *int
+		err := database.DB.QueryRow("SELECT parent_id FROM departments WHERE id = ?", current).Scan(&next)
+		if err == sql.ErrNoRows || (err == nil && next == nil) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		current = *next
+	}
+}
+
+// checkDepartmentHead - Head department harus employee aktif
+func checkDepartmentHead(headID int) (string, error) {
+	var active bool
+	err := database.DB.QueryRow("SELECT is_active FROM employees WHERE id = ?", headID).Scan(&active)
+	if err == sql.ErrNoRows {
+		return "Department head not found", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !active {
+		return "Department head is not active", nil
+	}
+	return "", nil
+}
+
+// checkDepartmentUnique - Nama (case-insensitive) dan cost center tidak boleh dipakai department lain
+func checkDepartmentUnique(departmentID int, name string, costCenter *string) (string, error) {
+	var count int
+	err := database.DB.QueryRow("SELECT COUNT(*) FROM departments WHERE LOWER(name) = LOWER(?) AND id <> ?",
+		name, departmentID).Scan(&count)
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "A department with this name already exists", nil
+	}
+	if costCenter == nil {
+		return "", nil
+	}
+	err = database.DB.QueryRow("SELECT COUNT(*) FROM departments WHERE cost_center = ? AND id <> ?",
+		*costCenter, departmentID).Scan(&count)
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "Cost center is already used by another department", nil
+	}
+	return "", nil
+}
+
+// requireOrganisationDepartmentScope - Struktur department berlaku untuk seluruh organisasi,
+// jadi departments:write dengan scope lebih sempit tidak cukup
+func requireOrganisationDepartmentScope(c *gin.Context) bool {
+	if auth.CurrentScope(c) != auth.ScopeOrganisation {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Managing departments requires departments:write for the whole organisation"})
+		return false
+	}
+	return true
+}
+
+// optionalID - 0 berarti "tidak ada" (NULL)
+func optionalID(id *int) *int {
+	if id == nil || *id == 0 {
+		return nil
+	}
+	return id
+}
+
+// optionalCostCenter - Cost center di-trim; string kosong berarti NULL
+func optionalCostCenter(costCenter *string) *string {
+	if costCenter == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*costCenter)
+	if trimmed == "" {
+		return nil
+	}
+	return &trimmed
+}
+
+// validateDepartment - Semua pengecekan parent, head dan keunikan untuk create/update
+func validateDepartment(departmentID int, name string, parentID, headID *int, costCenter *string) (string, error) {
+	if name == "" {
+		return "Department name is required", nil
+	}
+	if parentID != nil {
+		if reason, err := checkDepartmentParent(departmentID, *parentID); reason != "" || err != nil {
+			return reason, err
+		}
+	}
+	if headID != nil {
+		if reason, err := checkDepartmentHead(*headID); reason != "" || err != nil {
+			return reason, err
+		}
+	}
+	return checkDepartmentUnique(departmentID, name, costCenter)
+}
+
+func recordDepartmentEvent(c *gin.Context, action string, departmentID int, details map[string]interface{}) {
+	actorID := auth.CurrentEmployeeID(c)
+	details["department_id"] = departmentID
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    action,
+		ActorID:   &actorID,
+		IPAddress: c.ClientIP(),
+		Details:   details,
+	})
+}
+
+// CreateDepartment - Buat department baru, opsional di bawah parent (division)
+func CreateDepartment(c *gin.Context) {
+	var req models.CreateDepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !requireOrganisationDepartmentScope(c) {
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	parentID, headID, costCenter := optionalID(req.ParentID), optionalID(req.HeadID), optionalCostCenter(req.CostCenter)
+	reason, err := validateDepartment(0, name, parentID, headID, costCenter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+		return
+	}
+
+	result, err := database.DB.Exec(`INSERT INTO departments (name, description, parent_id, head_id, cost_center, created_at)
+		VALUES (?, ?, ?, ?, ?, NOW())`, name, req.Description, parentID, headID, costCenter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	recordDepartmentEvent(c, "department_created", int(id), map[string]interface{}{
+		"name": name, "parent_id": parentID, "head_id": headID, "cost_center": costCenter,
+	})
+	log.Printf("🏢 Department created - %s (ID=%d)", name, id)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Department created successfully", "id": id})
+}
+
+// loadDepartment - Department dari :id; response error sudah dikirim kalau return false
+func loadDepartment(c *gin.Context) (models.Department, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid department ID"})
+		return models.Department{}, false
+	}
+	dept, err := scanDepartment(database.DB.QueryRow(
+		"SELECT "+departmentColumns+" FROM departments d "+departmentJoins+" WHERE d.id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Department not found"})
+		return dept, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return dept, false
+	}
+	return dept, true
+}
+
+// UpdateDepartment - Rename, pindah parent, ganti head atau cost center. Department yang sudah
+// di-archive tidak bisa diubah.
+func UpdateDepartment(c *gin.Context) {
+	var req models.UpdateDepartmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !requireOrganisationDepartmentScope(c) {
+		return
+	}
+	dept, ok := loadDepartment(c)
+	if !ok {
+		return
+	}
+	if dept.IsArchived {
+		c.JSON(http.StatusConflict, gin.H{"error": "Archived departments cannot be changed"})
+		return
+	}
+
+	name, description := dept.Name, dept.Description
+	parentID, headID, costCenter := dept.ParentID, dept.HeadID, dept.CostCenter
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+	}
+	if req.Description != nil {
+		description = *req.Description
+	}
+	if req.ParentID != nil {
+		parentID = optionalID(req.ParentID)
+	}
+	if req.HeadID != nil {
+		headID = optionalID(req.HeadID)
+	}
+	if req.CostCenter != nil {
+		costCenter = optionalCostCenter(req.CostCenter)
+	}
+
+	// Parent dan head yang tidak berubah tidak dicek ulang (mis. head yang sudah tidak aktif)
+	checkParent, checkHead := parentID, headID
+	if req.ParentID == nil {
+		checkParent = nil
+	}
+	if req.HeadID == nil {
+		checkHead = nil
+	}
+	reason, err := validateDepartment(dept.ID, name, checkParent, checkHead, costCenter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+		return
+	}
+
+	_, err = database.DB.Exec(`UPDATE departments
+		SET name = ?, description = ?, parent_id = ?, head_id = ?, cost_center = ?
+		WHERE id = ?`, name, description, parentID, headID, costCenter, dept.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordDepartmentEvent(c, "department_updated", dept.ID, map[string]interface{}{
+		"old": map[string]interface{}{"name": dept.Name, "parent_id": dept.ParentID, "head_id": dept.HeadID, "cost_center": dept.CostCenter},
+		"new": map[string]interface{}{"name": name, "parent_id": parentID, "head_id": headID, "cost_center": costCenter},
+	})
+	log.Printf("🏢 Department updated - %s (ID=%d)", name, dept.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Department updated successfully"})
+}
+
+// ArchiveDepartment - Archive department yang sudah kosong (tanpa employee aktif dan tanpa
+// sub-department aktif). Data historis tetap menunjuk ke department ini.
+func ArchiveDepartment(c *gin.Context) {
+	if !requireOrganisationDepartmentScope(c) {
+		return
+	}
+	dept, ok := loadDepartment(c)
+	if !ok {
+		return
+	}
+	if dept.IsArchived {
+		c.JSON(http.StatusConflict, gin.H{"error": "Department is already archived"})
+		return
+	}
+
+	var employees, children int
+	err := database.DB.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM employees WHERE department_id = ? AND is_active = TRUE),
+		(SELECT COUNT(*) FROM departments WHERE parent_id = ? AND is_archived = FALSE)`,
+		dept.ID, dept.ID).Scan(&employees, &children)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if employees > 0 || children > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":            "Move active employees and sub-departments out of this department before archiving it",
+			"active_employees": employees,
+			"sub_departments":  children,
+		})
+		return
+	}
+
+	_, err = database.DB.Exec("UPDATE departments SET is_archived = TRUE, archived_at = NOW() WHERE id = ?", dept.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordDepartmentEvent(c, "department_archived", dept.ID, map[string]interface{}{"name": dept.Name})
+	log.Printf("🗄️ Department archived - %s (ID=%d)", dept.Name, dept.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Department archived successfully"})
+}
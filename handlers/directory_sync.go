@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+
+	"leavemaster/auth"
+	"leavemaster/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RunDirectorySync - Jalankan sync LDAP sekarang (di luar jadwal)
+func RunDirectorySync(c *gin.Context) {
+	result, err := services.SyncDirectory()
+	if err == auth.ErrLDAPNotConfigured {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "LDAP is not configured"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Directory sync failed: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -1,18 +1,24 @@
 package handlers
 
 import (
-	"leavemaster/services"
-	"net/http"
+	"os"
+	"testing"
 
-	"github.com/gin-gonic/gin"
+	"leavemaster/services"
 )
 
-func TestEmail(c *gin.Context) {
+// TestEmail - Kirim email notifikasi sungguhan lewat Resend. Hanya jalan kalau
+// RESEND_API_KEY dan TEST_EMAIL_TO di-set, supaya go test biasa tidak mengirim email.
+func TestEmail(t *testing.T) {
+	recipient := os.Getenv("TEST_EMAIL_TO")
+	if os.Getenv("RESEND_API_KEY") == "" || recipient == "" {
+		t.Skip("set RESEND_API_KEY and TEST_EMAIL_TO to send a test email")
+	}
 	emailService := services.NewEmailService()
 
 	// Test leave request notification
 	err := emailService.SendLeaveRequestNotification(
-		"manager@company.com",
+		recipient,
 		"John Manager",
 		"Alice Employee",
 		"annual",
@@ -20,16 +26,7 @@ func TestEmail(c *gin.Context) {
 		"2024-02-17",
 		"Family vacation",
 	)
-
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to send test email",
-			"details": err.Error(),
-		})
-		return
+		t.Fatalf("Failed to send test email: %v", err)
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Test email sent successfully! Check your email inbox.",
-	})
 }
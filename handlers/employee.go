@@ -1,125 +1,234 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"leavemaster/auth"
 	"leavemaster/database"
 	"leavemaster/models"
+	"leavemaster/services"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// GetEmployees - Get all employees dengan details (FROM employee.go)
-func GetEmployees(c *gin.Context) {
-	query := `
-		SELECT 
-			e.id, e.employee_id, e.name, e.email, e.position,
+// employeeColumns - Kolom yang dibaca scanEmployee (butuh JOIN departments d, roles r, employees m)
+const employeeColumns = `e.id, e.employee_id, e.name, e.email, e.position,
 			e.department_id, d.name as department_name,
 			e.role_id, r.name as role_name,
 			e.total_leave_days, e.remaining_leave_days,
 			e.is_manager, e.is_active, e.manager_id,
-			m.name as manager_name, e.created_at
-		FROM employees e
-		LEFT JOIN departments d ON e.department_id = d.id
+			m.name as manager_name, e.created_at`
+
+const employeeJoins = `LEFT JOIN departments d ON e.department_id = d.id
 		LEFT JOIN roles r ON e.role_id = r.id
-		LEFT JOIN employees m ON e.manager_id = m.id
-		ORDER BY e.name`
+		LEFT JOIN employees m ON e.manager_id = m.id`
+
+func scanEmployee(scanner rowScanner) (models.Employee, error) {
+	var emp models.Employee
+	var deptName, roleName, managerName *string
+
+	err := scanner.Scan(
+		&emp.ID, &emp.EmployeeID, &emp.Name, &emp.Email, &emp.Position,
+		&emp.DepartmentID, &deptName, &emp.RoleID, &roleName,
+		&emp.TotalLeaveDays, &emp.RemainingLeaveDays,
+		&emp.IsManager, &emp.IsActive, &emp.ManagerID, &managerName, &emp.CreatedAt,
+	)
+	if err != nil {
+		return emp, err
+	}
+
+	if deptName != nil {
+		emp.DepartmentName = *deptName
+	}
+	if roleName != nil {
+		emp.RoleName = *roleName
+	}
+	if managerName != nil {
+		emp.ManagerName = *managerName
+	}
+	return emp, nil
+}
+
+// employeeSorts - Nilai ?sort= yang diterima (prefix "-" untuk descending)
+var employeeSorts = map[string]string{
+	"name":        "e.name",
+	"email":       "e.email",
+	"employee_id": "e.employee_id",
+	"created_at":  "e.created_at",
+}
+
+// employeeSortValue - Nilai kolom sort untuk cursor halaman berikutnya
+func employeeSortValue(emp models.Employee, sort string) string {
+	switch sort {
+	case "email":
+		return emp.Email
+	case "employee_id":
+		return emp.EmployeeID
+	case "created_at":
+		return emp.CreatedAt.UTC().Format("2006-01-02 15:04:05")
+	}
+	return emp.Name
+}
+
+// likeEscaper - Escape karakter wildcard LIKE (escape default MySQL adalah backslash)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// containsPattern - Pola LIKE "mengandung q"; % dan _ di q dicari apa adanya
+func containsPattern(q string) string {
+	return "%" + likeEscaper.Replace(q) + "%"
+}
+
+// employeeFilters - Kondisi WHERE dari query parameter directory (selain cursor)
+func employeeFilters(c *gin.Context) (string, []interface{}, error) {
+	where, args := auth.ScopeFilter(c, auth.CurrentScope(c), "e")
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		pattern := containsPattern(q)
+		where += " AND (e.name LIKE ? OR e.email LIKE ? OR e.employee_id LIKE ?)"
+		args = append(args, pattern, pattern, pattern)
+	}
+
+	for _, param := range []string{"department_id", "role_id", "manager_id"} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			return "", nil, fmt.Errorf("%s must be a number", param)
+		}
+		where += " AND e." + param + " = ?"
+		args = append(args, value)
+	}
+
+	switch c.DefaultQuery("status", "active") {
+	case "active":
+		where += " AND e.is_active = TRUE"
+	case "inactive":
+		where += " AND e.is_active = FALSE"
+	case "all":
+	default:
+		return "", nil, errors.New("status must be active, inactive or all")
+	}
+
+	return where, args, nil
+}
 
-	rows, err := database.DB.Query(query)
+// GetEmployees - Directory employee dalam scope users:read caller.
+// Query: q (nama/email/employee_id), department_id, role_id, manager_id,
+// status=active|inactive|all (default active), sort=name|email|employee_id|created_at
+// (prefix "-" untuk descending), limit (default 50, maks 200) dan cursor dari next_cursor.
+func GetEmployees(c *gin.Context) {
+	where, args, err := employeeFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, err := pageLimit(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sort := c.DefaultQuery("sort", "name")
+	descending := strings.HasPrefix(sort, "-")
+	sort = strings.TrimPrefix(sort, "-")
+	sortColumn, ok := employeeSorts[sort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of name, email, employee_id, created_at"})
+		return
+	}
+
+	// Total dihitung tanpa cursor supaya sama di setiap halaman
+	var total int
+	err = database.DB.QueryRow(`SELECT COUNT(*) FROM employees e WHERE `+where, args...).Scan(&total)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
 
-	var employees []models.Employee
-	for rows.Next() {
-		var emp models.Employee
-		var deptID, roleID, managerID *int
-		var deptName, roleName, managerName *string
-
-		err := rows.Scan(
-			&emp.ID, &emp.EmployeeID, &emp.Name, &emp.Email, &emp.Position,
-			&deptID, &deptName, &roleID, &roleName,
-			&emp.TotalLeaveDays, &emp.RemainingLeaveDays,
-			&emp.IsManager, &emp.IsActive, &managerID, &managerName, &emp.CreatedAt,
-		)
+	direction := "ASC"
+	if descending {
+		direction = "DESC"
+	}
+	pageWhere, pageArgs := where, args
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
 		if err != nil {
-			continue
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
+		clause, clauseArgs := keysetClause(sortColumn, "e.id", descending, cursor)
+		pageWhere += " AND " + clause
+		pageArgs = append(append([]interface{}{}, args...), clauseArgs...)
+	}
 
-		if deptName != nil {
-			emp.DepartmentName = *deptName
-		}
-		if roleName != nil {
-			emp.RoleName = *roleName
-		}
-		if managerName != nil {
-			emp.ManagerName = *managerName
-		}
-		if deptID != nil {
-			emp.DepartmentID = deptID
-		}
-		if roleID != nil {
-			emp.RoleID = roleID
-		}
+	query := `SELECT ` + employeeColumns + `
+		FROM employees e
+		` + employeeJoins + `
+		WHERE ` + pageWhere + `
+		ORDER BY ` + sortColumn + ` ` + direction + `, e.id ` + direction + `
+		LIMIT ?`
 
+	rows, err := database.DB.Query(query, append(pageArgs, limit+1)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	employees := []models.Employee{}
+	for rows.Next() {
+		emp, err := scanEmployee(rows)
+		if err != nil {
+			log.Printf("❌ Failed to scan employee row: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read employees: " + err.Error()})
+			return
+		}
 		employees = append(employees, emp)
 	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	c.JSON(http.StatusOK, employees)
+	page := models.EmployeePage{Employees: employees, Total: total, Limit: limit}
+	if len(employees) > limit {
+		page.Employees = employees[:limit]
+		last := page.Employees[limit-1]
+		page.NextCursor = encodeCursor(pageCursor{Value: employeeSortValue(last, sort), ID: last.ID})
+	}
+
+	c.JSON(http.StatusOK, page)
 }
 
 // GetEmployeeByID - Get employee by ID (FROM employee.go)
 func GetEmployeeByID(c *gin.Context) {
 	id := c.Param("id")
 
+	// Employee di luar scope users:read diperlakukan sama dengan tidak ada
+	scopeClause, args := auth.ScopeFilter(c, auth.CurrentScope(c), "e")
 	query := `
-		SELECT 
-			e.id, e.employee_id, e.name, e.email, e.position,
-			e.department_id, d.name as department_name,
-			e.role_id, r.name as role_name,
-			e.total_leave_days, e.remaining_leave_days,
-			e.is_manager, e.is_active, e.manager_id,
-			m.name as manager_name, e.created_at
+		SELECT ` + employeeColumns + `
 		FROM employees e
-		LEFT JOIN departments d ON e.department_id = d.id
-		LEFT JOIN roles r ON e.role_id = r.id
-		LEFT JOIN employees m ON e.manager_id = m.id
-		WHERE e.id = ?`
+		` + employeeJoins + `
+		WHERE e.id = ? AND ` + scopeClause
 
-	var emp models.Employee
-	var deptID, roleID, managerID *int
-	var deptName, roleName, managerName *string
-
-	err := database.DB.QueryRow(query, id).Scan(
-		&emp.ID, &emp.EmployeeID, &emp.Name, &emp.Email, &emp.Position,
-		&deptID, &deptName, &roleID, &roleName,
-		&emp.TotalLeaveDays, &emp.RemainingLeaveDays,
-		&emp.IsManager, &emp.IsActive, &managerID, &managerName, &emp.CreatedAt,
-	)
-
-	if err != nil {
+	emp, err := scanEmployee(database.DB.QueryRow(query, append([]interface{}{id}, args...)...))
+	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
 		return
 	}
-
-	if deptName != nil {
-		emp.DepartmentName = *deptName
-	}
-	if roleName != nil {
-		emp.RoleName = *roleName
-	}
-	if managerName != nil {
-		emp.ManagerName = *managerName
-	}
-	if deptID != nil {
-		emp.DepartmentID = deptID
-	}
-	if roleID != nil {
-		emp.RoleID = roleID
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
 	c.JSON(http.StatusOK, emp)
@@ -127,13 +236,14 @@ func GetEmployeeByID(c *gin.Context) {
 
 // GetManagers - Get managers list (FROM employee.go)
 func GetManagers(c *gin.Context) {
+	scopeClause, args := auth.ScopeFilter(c, auth.CurrentScope(c), "e")
 	query := `
-		SELECT id, name, email, position 
-		FROM employees 
-		WHERE is_manager = TRUE AND is_active = TRUE
-		ORDER BY name`
+		SELECT e.id, e.name, e.email, e.position 
+		FROM employees e 
+		WHERE e.is_manager = TRUE AND e.is_active = TRUE AND ` + scopeClause + `
+		ORDER BY e.name`
 
-	rows, err := database.DB.Query(query)
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -164,6 +274,28 @@ func GetManagers(c *gin.Context) {
 	c.JSON(http.StatusOK, managers)
 }
 
+// queryRoleName - Bisa diganti di test supaya tidak butuh database
+var queryRoleName = func(roleID int) (string, error) {
+	var name string
+	err := database.DB.QueryRow("SELECT name FROM roles WHERE id = ?", roleID).Scan(&name)
+	return name, err
+}
+
+// loadRoleName - Nama role untuk role_id dari request. Role tidak ada = 400, error lain = 500;
+// ok=false kalau response sudah ditulis.
+func loadRoleName(c *gin.Context, roleID int) (string, bool) {
+	name, err := queryRoleName(roleID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
+		return "", false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return name, true
+}
+
 // CreateEmployee - Create new employee
 func CreateEmployee(c *gin.Context) {
 	var req models.CreateEmployeeRequest
@@ -193,9 +325,49 @@ func CreateEmployee(c *gin.Context) {
 	}
 
 	// Get role untuk set is_manager
-	var roleName string
-	database.DB.QueryRow("SELECT name FROM roles WHERE id = ?", req.RoleID).Scan(&roleName)
-	isManager := roleName == "manager" || roleName == "admin" || roleName == "super_admin"
+	roleName, ok := loadRoleName(c, req.RoleID)
+	if !ok {
+		return
+	}
+	isManager := roleIsManager(roleName)
+
+	// Role privileged hanya bisa diberikan lewat change request yang di-approve orang kedua
+	privileged, err := auth.IsPrivilegedRole(roleName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if privileged {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Privileged roles require a second approval: create the employee with a regular role, then change the role",
+		})
+		return
+	}
+
+	reason, err := checkDepartmentAssignable(req.DepartmentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+		return
+	}
+
+	if req.ManagerID != nil && *req.ManagerID == 0 {
+		req.ManagerID = nil
+	}
+	if req.ManagerID != nil {
+		reason, err := services.CheckReportingLine(0, *req.ManagerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if reason != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+			return
+		}
+	}
 
 	// Default values
 	if req.TotalLeaveDays == 0 {
@@ -239,6 +411,49 @@ func UpdateEmployee(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !checkEmployeeInScope(c, employeeID) {
+		return
+	}
+	id, _ := strconv.Atoi(employeeID)
+
+	// Department dan reporting line dicek sebelum apa pun ditulis (termasuk change request)
+	if req.DepartmentID != 0 {
+		reason, err := checkDepartmentAssignable(req.DepartmentID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if reason != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+			return
+		}
+	}
+	if req.ManagerID != nil && *req.ManagerID != 0 {
+		reason, err := services.CheckReportingLine(id, *req.ManagerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if reason != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+			return
+		}
+	}
+
+	// Role harus ada sebelum diputuskan apakah perlu change request; kalau lookup gagal,
+	// role_id tidak boleh langsung ditulis
+	var roleName string
+	if req.RoleID != 0 {
+		var ok bool
+		if roleName, ok = loadRoleName(c, req.RoleID); !ok {
+			return
+		}
+	}
+
+	// Promosi ke role privileged dan reaktivasi tidak langsung diterapkan: jadi change request
+	// yang harus di-approve user privileged lain (lihat change_requests.go)
+	var changeRequests []int
+	roleChanged := false
 
 	// Build dynamic update query
 	query := "UPDATE employees SET "
@@ -262,18 +477,38 @@ func UpdateEmployee(c *gin.Context) {
 	}
 	if req.RoleID != 0 {
 		// Update is_manager based on role
-		var roleName string
-		database.DB.QueryRow("SELECT name FROM roles WHERE id = ?", req.RoleID).Scan(&roleName)
-		isManager := roleName == "manager" || roleName == "admin" || roleName == "super_admin"
-
-		query += "role_id = ?, is_manager = ?, "
-		args = append(args, req.RoleID, isManager)
+		changeID, pending, err := requestRoleChange(c, id, req.RoleID, roleName, req.ChangeReason)
+		if err != nil {
+			c.JSON(changeRequestErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if pending {
+			changeRequests = append(changeRequests, changeID)
+		} else {
+			query += "role_id = ?, is_manager = ?, "
+			args = append(args, req.RoleID, roleIsManager(roleName))
+			roleChanged = true
+		}
 	}
 	if req.ManagerID != nil {
+		// manager_id 0 = hapus manager
+		var managerID interface{}
+		if *req.ManagerID != 0 {
+			managerID = *req.ManagerID
+		}
 		query += "manager_id = ?, "
-		args = append(args, *req.ManagerID)
+		args = append(args, managerID)
 	}
-	if req.IsActive != nil {
+	if req.IsActive != nil && *req.IsActive {
+		changeID, pending, err := requestReactivation(c, id, req.ChangeReason)
+		if err != nil {
+			c.JSON(changeRequestErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if pending {
+			changeRequests = append(changeRequests, changeID)
+		}
+	} else if req.IsActive != nil {
 		query += "is_active = ?, "
 		args = append(args, *req.IsActive)
 	}
@@ -282,13 +517,31 @@ func UpdateEmployee(c *gin.Context) {
 		args = append(args, req.TotalLeaveDays, req.TotalLeaveDays)
 	}
 
-	// Remove trailing comma and add WHERE clause
-	query = query[:len(query)-2] + " WHERE id = ?"
-	args = append(args, employeeID)
+	if len(args) > 0 {
+		// Remove trailing comma and add WHERE clause
+		query = query[:len(query)-2] + " WHERE id = ?"
+		args = append(args, employeeID)
 
-	_, err := database.DB.Exec(query, args...)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		_, err := database.DB.Exec(query, args...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Role, department dan status aktif ada di claims - token lama harus ditolak
+	deactivated := req.IsActive != nil && !*req.IsActive
+	if roleChanged || req.DepartmentID != 0 || deactivated {
+		if err := invalidateAccessTokens(id, deactivated); err != nil {
+			log.Printf("❌ Failed to revoke tokens for employee %d: %v", id, err)
+		}
+	}
+
+	if len(changeRequests) > 0 {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":         "Employee updated; some changes are waiting for a second approval",
+			"change_requests": changeRequests,
+		})
 		return
 	}
 
@@ -298,62 +551,37 @@ func UpdateEmployee(c *gin.Context) {
 // DeleteEmployee - Delete employee (soft delete) (FROM users.go)
 func DeleteEmployee(c *gin.Context) {
 	employeeID := c.Param("id")
-
-	_, err := database.DB.Exec("UPDATE employees SET is_active = FALSE WHERE id = ?", employeeID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if !checkEmployeeInScope(c, employeeID) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Employee deactivated successfully"})
-}
-
-// GetRoles - Get all roles (FROM users.go)
-func GetRoles(c *gin.Context) {
-	query := "SELECT id, name, description, permissions, created_at FROM roles ORDER BY name"
-	rows, err := database.DB.Query(query)
+	_, err := database.DB.Exec("UPDATE employees SET is_active = FALSE WHERE id = ?", employeeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	defer rows.Close()
-
-	var roles []models.Role
-	for rows.Next() {
-		var role models.Role
-		var permissionsJSON string
 
-		err := rows.Scan(&role.ID, &role.Name, &role.Description, &permissionsJSON, &role.CreatedAt)
-		if err != nil {
-			continue
-		}
-
-		role.Permissions = map[string]interface{}{"raw": permissionsJSON}
-		roles = append(roles, role)
+	id, _ := strconv.Atoi(employeeID)
+	if err := invalidateAccessTokens(id, true); err != nil {
+		log.Printf("❌ Failed to revoke tokens for employee %d: %v", id, err)
 	}
 
-	c.JSON(http.StatusOK, roles)
+	c.JSON(http.StatusOK, gin.H{"message": "Employee deactivated successfully"})
 }
 
-// GetDepartments - Get all departments (FROM users.go)
-func GetDepartments(c *gin.Context) {
-	query := "SELECT id, name, description, created_at FROM departments ORDER BY name"
-	rows, err := database.DB.Query(query)
-	if err != nil {
+// checkEmployeeInScope - Target harus dalam scope permission route ini (mis. users:write@department).
+// Kalau tidak, response 404 sudah dikirim dan return false.
+func checkEmployeeInScope(c *gin.Context, employeeID string) bool {
+	var target auth.ScopeTarget
+	err := database.DB.QueryRow("SELECT id, manager_id, department_id FROM employees WHERE id = ?", employeeID).
+		Scan(&target.EmployeeID, &target.ManagerID, &target.DepartmentID)
+	if err != nil && err != sql.ErrNoRows {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return false
 	}
-	defer rows.Close()
-
-	var departments []models.Department
-	for rows.Next() {
-		var dept models.Department
-		err := rows.Scan(&dept.ID, &dept.Name, &dept.Description, &dept.CreatedAt)
-		if err != nil {
-			continue
-		}
-		departments = append(departments, dept)
+	if err == sql.ErrNoRows || !auth.InScope(c, auth.CurrentScope(c), target) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return false
 	}
-
-	c.JSON(http.StatusOK, departments)
+	return true
 }
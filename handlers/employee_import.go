@@ -0,0 +1,581 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/models"
+	"leavemaster/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	maxImportRows     = 2000
+	maxImportFileSize = 5 << 20
+
+	importCredentialsInvite    = "invite"
+	importCredentialsTemporary = "temporary_password"
+)
+
+// importHeaders - Nama kolom yang dikenali (lowercase, spasi/strip jadi "_") -> field CreateEmployeeRequest
+var importHeaders = map[string]string{
+	"employee_id":         "employee_id",
+	"employee_code":       "employee_id",
+	"code":                "employee_id",
+	"name":                "name",
+	"full_name":           "name",
+	"email":               "email",
+	"position":            "position",
+	"job_title":           "position",
+	"department":          "department",
+	"department_id":       "department",
+	"department_name":     "department",
+	"role":                "role",
+	"role_id":             "role",
+	"role_name":           "role",
+	"manager":             "manager",
+	"manager_id":          "manager",
+	"manager_email":       "manager",
+	"manager_employee_id": "manager",
+	"total_leave_days":    "total_leave_days",
+	"leave_days":          "total_leave_days",
+}
+
+// isPrivilegedRole - Bisa diganti di test supaya tidak butuh database
+var isPrivilegedRole = auth.IsPrivilegedRole
+
+var requiredImportFields = []string{"employee_id", "name", "email", "position", "department", "role"}
+
+// importRow - Satu baris yang sudah di-resolve ke ID
+type importRow struct {
+	line       int
+	req        models.CreateEmployeeRequest
+	roleName   string
+	managerRow int // index baris lain di file yang jadi manager, -1 kalau tidak ada
+}
+
+// importLookup - Data referensi untuk resolve nama/kode ke ID, di-load sekali per import
+type importLookup struct {
+	departments map[string]int // id, nama dan cost center (lowercase)
+	roles       map[string]importRole
+	employees   map[string]importEmployee // id, employee_id dan email (lowercase)
+	names       map[string][]importEmployee
+}
+
+type importRole struct {
+	id   int
+	name string
+}
+
+type importEmployee struct {
+	id       int
+	active   bool
+	deptID   *int
+	code     string
+	email    string
+	fullName string
+}
+
+// ImportEmployees - Import employee dari CSV/XLSX (multipart field "file").
+// dry_run=true hanya validasi dan return error per baris; run sungguhan menulis semua baris
+// dalam satu transaksi (semua atau tidak sama sekali). credentials=invite (default) mengirim
+// link set-password, credentials=temporary_password membuat password sementara yang wajib diganti.
+func ImportEmployees(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.DefaultPostForm("dry_run", c.DefaultQuery("dry_run", "false")))
+	credentials := c.DefaultPostForm("credentials", c.DefaultQuery("credentials", importCredentialsInvite))
+	if credentials != importCredentialsInvite && credentials != importCredentialsTemporary {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "credentials must be invite or temporary_password"})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload a CSV or XLSX file in the \"file\" field"})
+		return
+	}
+	if fileHeader.Size > maxImportFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File is larger than %d MB", maxImportFileSize>>20)})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	records, err := readImportFile(file, fileHeader.Filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(records) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File has no data rows"})
+		return
+	}
+	if len(records)-1 > maxImportRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d rows can be imported at once", maxImportRows)})
+		return
+	}
+
+	columns, err := mapImportHeaders(records[0])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lookup, err := loadImportLookup()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, rowErrors := validateImportRows(c, records, columns, lookup)
+	result := models.EmployeeImportResult{
+		DryRun:    dryRun,
+		TotalRows: len(records) - 1,
+		ValidRows: len(rows) - countInvalidRows(rowErrors),
+		Errors:    rowErrors,
+	}
+
+	if dryRun {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	if len(rowErrors) > 0 {
+		result.ValidRows = 0
+		c.JSON(http.StatusUnprocessableEntity, result)
+		return
+	}
+
+	created, invites, err := applyEmployeeImport(rows, credentials)
+	if err != nil {
+		log.Printf("❌ Employee import failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Import failed, no employees were created: " + err.Error()})
+		return
+	}
+	result.Created = created
+
+	actorID := auth.CurrentEmployeeID(c)
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    "employees_imported",
+		ActorID:   &actorID,
+		IPAddress: c.ClientIP(),
+		Details: map[string]interface{}{
+			"file":        fileHeader.Filename,
+			"created":     len(created),
+			"credentials": credentials,
+		},
+	})
+	log.Printf("📥 Imported %d employees from %s (credentials: %s)", len(created), fileHeader.Filename, credentials)
+
+	// Email undangan dikirim setelah commit; gagal kirim tidak membatalkan import
+	go func() {
+		for _, invite := range invites {
+			if err := emailService.SendInviteEmail(invite.email, invite.name, invite.url, auth.InviteTTL()); err != nil {
+				log.Printf("❌ Failed to send invite to employee %d: %v", invite.employeeID, err)
+			}
+		}
+	}()
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// readImportFile - Semua baris file sebagai string; format dari ekstensi (.csv atau .xlsx, sheet pertama)
+func readImportFile(file io.Reader, filename string) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		// BOM dari Excel "CSV UTF-8"
+		if len(records) > 0 && len(records[0]) > 0 {
+			records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+		}
+		return records, nil
+	case ".xlsx":
+		workbook, err := excelize.OpenReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("invalid XLSX: %w", err)
+		}
+		defer workbook.Close()
+		sheets := workbook.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, errors.New("XLSX file has no sheets")
+		}
+		return workbook.GetRows(sheets[0])
+	}
+	return nil, errors.New("only .csv and .xlsx files are supported")
+}
+
+// mapImportHeaders - Index kolom per field; error kalau kolom wajib tidak ada
+func mapImportHeaders(header []string) (map[string]int, error) {
+	columns := map[string]int{}
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		key = strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+		if field, ok := importHeaders[key]; ok {
+			if _, duplicate := columns[field]; duplicate {
+				return nil, fmt.Errorf("column for %s appears more than once", field)
+			}
+			columns[field] = i
+		}
+	}
+	var missing []string
+	for _, field := range requiredImportFields {
+		if _, ok := columns[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, errors.New("missing required columns: " + strings.Join(missing, ", "))
+	}
+	return columns, nil
+}
+
+func loadImportLookup() (importLookup, error) {
+	lookup := importLookup{
+		departments: map[string]int{},
+		roles:       map[string]importRole{},
+		employees:   map[string]importEmployee{},
+		names:       map[string][]importEmployee{},
+	}
+
+	rows, err := database.DB.Query("SELECT id, name, cost_center FROM departments WHERE is_archived = FALSE")
+	if err != nil {
+		return lookup, err
+	}
+	for rows.Next() {
+		var id int
+		var name string
+		var costCenter *string
+		if err := rows.Scan(&id, &name, &costCenter); err != nil {
+			rows.Close()
+			return lookup, err
+		}
+		lookup.departments[strconv.Itoa(id)] = id
+		lookup.departments[strings.ToLower(name)] = id
+		if costCenter != nil {
+			lookup.departments[strings.ToLower(*costCenter)] = id
+		}
+	}
+	rows.Close()
+
+	rows, err = database.DB.Query("SELECT id, name FROM roles")
+	if err != nil {
+		return lookup, err
+	}
+	for rows.Next() {
+		var role importRole
+		if err := rows.Scan(&role.id, &role.name); err != nil {
+			rows.Close()
+			return lookup, err
+		}
+		lookup.roles[strconv.Itoa(role.id)] = role
+		lookup.roles[strings.ToLower(role.name)] = role
+	}
+	rows.Close()
+
+	rows, err = database.DB.Query("SELECT id, employee_id, email, name, is_active, department_id FROM employees")
+	if err != nil {
+		return lookup, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e importEmployee
+		if err := rows.Scan(&e.id, &e.code, &e.email, &e.fullName, &e.active, &e.deptID); err != nil {
+			return lookup, err
+		}
+		lookup.employees[strconv.Itoa(e.id)] = e
+		lookup.employees[strings.ToLower(e.code)] = e
+		lookup.employees[strings.ToLower(e.email)] = e
+		name := strings.ToLower(e.fullName)
+		lookup.names[name] = append(lookup.names[name], e)
+	}
+	return lookup, rows.Err()
+}
+
+// validateImportRows - Resolve dan validasi semua baris. Baris dengan error tetap ada di hasil
+// (untuk hitungan), tapi import sungguhan hanya jalan kalau tidak ada error sama sekali.
+func validateImportRows(c *gin.Context, records [][]string, columns map[string]int, lookup importLookup) ([]importRow, []models.ImportRowError) {
+	rowErrors := []models.ImportRowError{}
+	rows := make([]importRow, 0, len(records)-1)
+	managerRefs := make([]string, 0, len(records)-1)
+	fileKeys := map[string]int{} // employee_id/email (lowercase) -> index baris di file
+	scope := auth.CurrentScope(c)
+
+	for i, record := range records[1:] {
+		line := i + 2
+		fail := func(field, message string) {
+			rowErrors = append(rowErrors, models.ImportRowError{Row: line, Field: field, Message: message})
+		}
+		value := func(field string) string {
+			index, ok := columns[field]
+			if !ok || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+
+		row := importRow{line: line, managerRow: -1}
+		row.req.EmployeeID = value("employee_id")
+		row.req.Name = value("name")
+		row.req.Email = strings.ToLower(value("email"))
+		row.req.Position = value("position")
+
+		for _, field := range requiredImportFields {
+			if value(field) == "" {
+				fail(field, field+" is required")
+			}
+		}
+
+		if row.req.Email != "" {
+			if address, err := mail.ParseAddress(row.req.Email); err != nil || address.Address != row.req.Email {
+				fail("email", "email is not a valid address")
+			}
+		}
+		for _, unique := range []struct{ field, key string }{{"employee_id", row.req.EmployeeID}, {"email", row.req.Email}} {
+			field, key := unique.field, unique.key
+			if key == "" {
+				continue
+			}
+			if _, exists := lookup.employees[strings.ToLower(key)]; exists {
+				fail(field, field+" already exists")
+			} else if other, seen := fileKeys[strings.ToLower(key)]; seen {
+				fail(field, fmt.Sprintf("%s is duplicated in row %d", field, rows[other].line))
+			}
+		}
+
+		if department := value("department"); department != "" {
+			if id, ok := lookup.departments[strings.ToLower(department)]; ok {
+				row.req.DepartmentID = id
+			} else {
+				fail("department", "department not found: "+department)
+			}
+		}
+
+		if roleRef := value("role"); roleRef != "" {
+			role, ok := lookup.roles[strings.ToLower(roleRef)]
+			if !ok {
+				fail("role", "role not found: "+roleRef)
+			} else {
+				privileged, err := isPrivilegedRole(role.name)
+				if err != nil {
+					fail("role", "could not check role permissions")
+				} else if privileged {
+					fail("role", "privileged roles need a second approval; import with a regular role and change it afterwards")
+				} else {
+					row.req.RoleID = role.id
+					row.roleName = role.name
+				}
+			}
+		}
+
+		row.req.TotalLeaveDays = 12
+		if raw := value("total_leave_days"); raw != "" {
+			days, err := strconv.Atoi(raw)
+			if err != nil || days < 0 || days > 365 {
+				fail("total_leave_days", "total_leave_days must be a whole number between 0 and 365")
+			} else {
+				row.req.TotalLeaveDays = days
+			}
+		}
+
+		// Manager: employee yang sudah ada (id, employee_id, email atau nama unik) atau baris lain di file
+		managerRef := value("manager")
+		if managerRef != "" {
+			key := strings.ToLower(managerRef)
+			existing, ok := lookup.employees[key]
+			if matches := lookup.names[key]; !ok && len(matches) > 1 {
+				fail("manager", "manager name is ambiguous, use their employee_id or email: "+managerRef)
+			} else if !ok && len(matches) == 1 {
+				existing, ok = matches[0], true
+			}
+			if ok {
+				if !existing.active {
+					fail("manager", "manager is not active: "+managerRef)
+				} else {
+					id := existing.id
+					row.req.ManagerID = &id
+				}
+			}
+			if ok || len(lookup.names[key]) > 1 {
+				// Sudah di-resolve (atau sudah error); sisanya dicari di baris lain setelah semua baris terbaca
+				managerRef = ""
+			}
+		}
+
+		// Employee baru harus masuk scope users:write caller
+		if row.req.DepartmentID != 0 {
+			dept := row.req.DepartmentID
+			if !auth.InScope(c, scope, auth.ScopeTarget{ManagerID: row.req.ManagerID, DepartmentID: &dept}) {
+				fail("department", "employee would be outside your users:write scope")
+			}
+		}
+
+		if row.req.EmployeeID != "" {
+			fileKeys[strings.ToLower(row.req.EmployeeID)] = len(rows)
+		}
+		if row.req.Email != "" {
+			fileKeys[row.req.Email] = len(rows)
+		}
+		rows = append(rows, row)
+		managerRefs = append(managerRefs, managerRef)
+	}
+
+	for i := range rows {
+		ref := strings.ToLower(managerRefs[i])
+		if ref == "" {
+			continue
+		}
+		other, ok := fileKeys[ref]
+		switch {
+		case !ok:
+			rowErrors = append(rowErrors, models.ImportRowError{Row: rows[i].line, Field: "manager", Message: "manager not found: " + managerRefs[i]})
+		case other == i:
+			rowErrors = append(rowErrors, models.ImportRowError{Row: rows[i].line, Field: "manager", Message: "an employee cannot be their own manager"})
+		default:
+			rows[i].managerRow = other
+		}
+	}
+
+	// Rantai manager di dalam file tidak boleh melingkar
+	for i := range rows {
+		seen := map[int]bool{i: true}
+		for next := rows[i].managerRow; next >= 0; next = rows[next].managerRow {
+			if seen[next] {
+				rowErrors = append(rowErrors, models.ImportRowError{Row: rows[i].line, Field: "manager", Message: "manager chain forms a cycle"})
+				break
+			}
+			seen[next] = true
+		}
+	}
+
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+	return rows, rowErrors
+}
+
+func countInvalidRows(rowErrors []models.ImportRowError) int {
+	invalid := map[int]bool{}
+	for _, e := range rowErrors {
+		invalid[e.Row] = true
+	}
+	return len(invalid)
+}
+
+type pendingInvite struct {
+	employeeID int
+	email      string
+	name       string
+	url        string
+}
+
+// applyEmployeeImport - Tulis semua baris dalam satu transaksi. Password di-hash sebelum
+// transaksi dimulai supaya transaksi tidak tertahan oleh bcrypt.
+func applyEmployeeImport(rows []importRow, credentials string) ([]models.ImportedEmployee, []pendingInvite, error) {
+	passwords := make([]string, len(rows))
+	hashes := make([]string, len(rows))
+	var hashErr error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, runtime.NumCPU())
+	for i := range rows {
+		password, err := auth.RandomToken(12)
+		if err != nil {
+			return nil, nil, err
+		}
+		passwords[i] = password
+
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer func() { <-slots; wg.Done() }()
+			hash, err := bcrypt.GenerateFromPassword([]byte(passwords[i]), bcrypt.DefaultCost)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				hashErr = err
+				return
+			}
+			hashes[i] = string(hash)
+		}(i)
+	}
+	wg.Wait()
+	if hashErr != nil {
+		return nil, nil, hashErr
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	mustChange := credentials == importCredentialsTemporary
+	created := make([]models.ImportedEmployee, len(rows))
+	var invites []pendingInvite
+	for i, row := range rows {
+		req := row.req
+		result, err := tx.Exec(`
+			INSERT INTO employees (
+				employee_id, name, email, password, position,
+				department_id, role_id, is_manager, manager_id,
+				total_leave_days, remaining_leave_days, is_active, must_change_password, created_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, TRUE, ?, NOW())`,
+			req.EmployeeID, req.Name, req.Email, hashes[i], req.Position,
+			req.DepartmentID, req.RoleID, roleIsManager(row.roleName), req.ManagerID,
+			req.TotalLeaveDays, req.TotalLeaveDays, mustChange)
+		if err != nil {
+			return nil, nil, fmt.Errorf("row %d: %w", row.line, err)
+		}
+		id, _ := result.LastInsertId()
+
+		created[i] = models.ImportedEmployee{Row: row.line, ID: int(id), EmployeeID: req.EmployeeID, Email: req.Email}
+		if mustChange {
+			created[i].TemporaryPassword = passwords[i]
+			continue
+		}
+		token, err := auth.IssueInviteToken(tx, int(id))
+		if err != nil {
+			return nil, nil, fmt.Errorf("row %d: %w", row.line, err)
+		}
+		created[i].InviteURL = passwordResetURL(token)
+		invites = append(invites, pendingInvite{employeeID: int(id), email: req.Email, name: req.Name, url: created[i].InviteURL})
+	}
+
+	// Manager yang juga baru di file ini baru punya ID setelah semua baris masuk
+	for i, row := range rows {
+		if row.managerRow < 0 {
+			continue
+		}
+		_, err := tx.Exec("UPDATE employees SET manager_id = ? WHERE id = ?", created[row.managerRow].ID, created[i].ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("row %d: %w", row.line, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return created, invites, nil
+}
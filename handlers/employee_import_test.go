@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"leavemaster/auth"
+	"leavemaster/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMapImportHeaders(t *testing.T) {
+	cases := []struct {
+		name    string
+		header  []string
+		want    map[string]int
+		wantErr string
+	}{
+		{
+			name:   "canonical names",
+			header: []string{"employee_id", "name", "email", "position", "department", "role"},
+			want:   map[string]int{"employee_id": 0, "name": 1, "email": 2, "position": 3, "department": 4, "role": 5},
+		},
+		{
+			name:   "aliases, case, spaces and dashes",
+			header: []string{" Employee Code ", "Full-Name", "EMAIL", "Job Title", "Department Name", "role_name", "Manager Email", "Leave Days", "Notes"},
+			want: map[string]int{"employee_id": 0, "name": 1, "email": 2, "position": 3, "department": 4, "role": 5,
+				"manager": 6, "total_leave_days": 7},
+		},
+		{
+			name:    "missing required columns",
+			header:  []string{"name", "email", "role"},
+			wantErr: "missing required columns: employee_id, position, department",
+		},
+		{
+			name:    "two aliases for one field",
+			header:  []string{"employee_id", "code", "name", "email", "position", "department", "role"},
+			wantErr: "column for employee_id appears more than once",
+		},
+	}
+	for _, tc := range cases {
+		got, err := mapImportHeaders(tc.header)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, %v; want %v", tc.name, got, err, tc.want)
+		}
+	}
+}
+
+// testImportLookup - Department 1 Engineering, role employee/admin, employee aktif dan tidak aktif,
+// dan dua employee bernama sama
+func testImportLookup() importLookup {
+	dept := 1
+	lookup := importLookup{
+		departments: map[string]int{"1": 1, "engineering": 1, "cc-100": 1},
+		roles: map[string]importRole{
+			"employee": {id: 3, name: "employee"}, "3": {id: 3, name: "employee"},
+			"admin": {id: 2, name: "admin"},
+		},
+		employees: map[string]importEmployee{},
+		names:     map[string][]importEmployee{},
+	}
+	for _, e := range []importEmployee{
+		{id: 10, active: true, deptID: &dept, code: "EMP010", email: "boss@example.com", fullName: "Big Boss"},
+		{id: 11, active: false, deptID: &dept, code: "EMP011", email: "gone@example.com", fullName: "Former Lead"},
+		{id: 12, active: true, deptID: &dept, code: "EMP012", email: "alex.a@example.com", fullName: "Alex Kim"},
+		{id: 13, active: true, deptID: &dept, code: "EMP013", email: "alex.b@example.com", fullName: "Alex Kim"},
+	} {
+		lookup.employees[strings.ToLower(e.code)] = e
+		lookup.employees[e.email] = e
+		name := strings.ToLower(e.fullName)
+		lookup.names[name] = append(lookup.names[name], e)
+	}
+	return lookup
+}
+
+func importTestContext(t *testing.T, scope auth.Scope) *gin.Context {
+	original := isPrivilegedRole
+	isPrivilegedRole = func(roleName string) (bool, error) { return roleName == "admin", nil }
+	t.Cleanup(func() { isPrivilegedRole = original })
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	dept := 2
+	auth.SetIdentity(c, auth.Identity{EmployeeID: 10, RoleName: "hr_partner", DepartmentID: &dept})
+	auth.SetPermissionScope(c, scope)
+	return c
+}
+
+var importTestHeader = []string{"employee_id", "name", "email", "position", "department", "role", "manager"}
+
+// importRecord - Baris valid dengan manager yang bisa diganti
+func importRecord(code, manager string) []string {
+	return []string{code, "Name " + code, strings.ToLower(code) + "@example.com", "Engineer", "Engineering", "employee", manager}
+}
+
+func validateTestImport(t *testing.T, scope auth.Scope, records ...[]string) ([]importRow, []models.ImportRowError) {
+	t.Helper()
+	columns, err := mapImportHeaders(importTestHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return validateImportRows(importTestContext(t, scope), append([][]string{importTestHeader}, records...), columns, testImportLookup())
+}
+
+func TestImportManagerResolution(t *testing.T) {
+	cases := []struct {
+		name        string
+		manager     string
+		wantManager *int
+		wantErr     string
+	}{
+		{"by employee_id", "EMP010", intPtr(10), ""},
+		{"by email, any case", "Boss@Example.com", intPtr(10), ""},
+		{"by unique name", "big boss", intPtr(10), ""},
+		{"ambiguous name", "Alex Kim", nil, "manager name is ambiguous, use their employee_id or email: Alex Kim"},
+		{"ambiguous name resolved by email", "alex.b@example.com", intPtr(13), ""},
+		{"inactive manager", "EMP011", nil, "manager is not active: EMP011"},
+		{"unknown manager", "nobody", nil, "manager not found: nobody"},
+		{"no manager", "", nil, ""},
+	}
+	for _, tc := range cases {
+		rows, rowErrors := validateTestImport(t, auth.ScopeOrganisation, importRecord("NEW001", tc.manager))
+		var messages []string
+		for _, e := range rowErrors {
+			messages = append(messages, e.Message)
+		}
+		if tc.wantErr == "" && len(rowErrors) > 0 {
+			t.Errorf("%s: unexpected errors %v", tc.name, messages)
+		}
+		if tc.wantErr != "" && (len(rowErrors) != 1 || rowErrors[0].Message != tc.wantErr || rowErrors[0].Field != "manager") {
+			t.Errorf("%s: got errors %v, want %q", tc.name, messages, tc.wantErr)
+		}
+		if !reflect.DeepEqual(rows[0].req.ManagerID, tc.wantManager) {
+			t.Errorf("%s: manager_id = %v, want %v", tc.name, rows[0].req.ManagerID, tc.wantManager)
+		}
+	}
+}
+
+func TestImportManagerRowsInFile(t *testing.T) {
+	cases := []struct {
+		name        string
+		records     [][]string
+		wantManager []int
+		wantErrors  []models.ImportRowError
+	}{
+		{
+			name: "manager later in the file",
+			records: [][]string{
+				importRecord("NEW001", "new002@example.com"),
+				importRecord("NEW002", "EMP010"),
+			},
+			wantManager: []int{1, -1},
+		},
+		{
+			name: "chain inside the file",
+			records: [][]string{
+				importRecord("NEW001", "NEW002"),
+				importRecord("NEW002", "NEW003"),
+				importRecord("NEW003", ""),
+			},
+			wantManager: []int{1, 2, -1},
+		},
+		{
+			name:        "own manager",
+			records:     [][]string{importRecord("NEW001", "NEW001")},
+			wantManager: []int{-1},
+			wantErrors:  []models.ImportRowError{{Row: 2, Field: "manager", Message: "an employee cannot be their own manager"}},
+		},
+		{
+			name: "two-row cycle",
+			records: [][]string{
+				importRecord("NEW001", "NEW002"),
+				importRecord("NEW002", "NEW001"),
+			},
+			wantManager: []int{1, 0},
+			wantErrors: []models.ImportRowError{
+				{Row: 2, Field: "manager", Message: "manager chain forms a cycle"},
+				{Row: 3, Field: "manager", Message: "manager chain forms a cycle"},
+			},
+		},
+		{
+			name: "row hanging off a cycle",
+			records: [][]string{
+				importRecord("NEW001", "NEW002"),
+				importRecord("NEW002", "NEW003"),
+				importRecord("NEW003", "NEW002"),
+			},
+			wantManager: []int{1, 2, 1},
+			wantErrors: []models.ImportRowError{
+				{Row: 2, Field: "manager", Message: "manager chain forms a cycle"},
+				{Row: 3, Field: "manager", Message: "manager chain forms a cycle"},
+				{Row: 4, Field: "manager", Message: "manager chain forms a cycle"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		rows, rowErrors := validateTestImport(t, auth.ScopeOrganisation, tc.records...)
+		var managers []int
+		for _, row := range rows {
+			managers = append(managers, row.managerRow)
+		}
+		if !reflect.DeepEqual(managers, tc.wantManager) {
+			t.Errorf("%s: manager rows = %v, want %v", tc.name, managers, tc.wantManager)
+		}
+		if len(tc.wantErrors) == 0 {
+			tc.wantErrors = []models.ImportRowError{}
+		}
+		if !reflect.DeepEqual(rowErrors, tc.wantErrors) {
+			t.Errorf("%s: errors = %+v, want %+v", tc.name, rowErrors, tc.wantErrors)
+		}
+	}
+}
+
+func TestImportRowValidation(t *testing.T) {
+	rows, rowErrors := validateTestImport(t, auth.ScopeOrganisation,
+		[]string{"EMP010", "Dup Code", "dup@example.com", "Engineer", "cc-100", "3", ""},
+		[]string{"NEW001", "Bad Email", "not-an-email", "Engineer", "Sales", "admin", ""},
+		[]string{"NEW002", "", "new002@example.com", "", "Engineering", "ghost", ""},
+		[]string{"NEW003", "First", "same@example.com", "Engineer", "Engineering", "employee", ""},
+		[]string{"new003", "Second", "SAME@example.com", "Engineer", "Engineering", "employee", ""},
+	)
+
+	want := []models.ImportRowError{
+		{Row: 2, Field: "employee_id", Message: "employee_id already exists"},
+		{Row: 3, Field: "email", Message: "email is not a valid address"},
+		{Row: 3, Field: "department", Message: "department not found: Sales"},
+		{Row: 3, Field: "role", Message: "privileged roles need a second approval; import with a regular role and change it afterwards"},
+		{Row: 4, Field: "name", Message: "name is required"},
+		{Row: 4, Field: "position", Message: "position is required"},
+		{Row: 4, Field: "role", Message: "role not found: ghost"},
+		{Row: 6, Field: "employee_id", Message: "employee_id is duplicated in row 5"},
+		{Row: 6, Field: "email", Message: "email is duplicated in row 5"},
+	}
+	if !reflect.DeepEqual(rowErrors, want) {
+		t.Errorf("errors:\n got %+v\nwant %+v", rowErrors, want)
+	}
+	if countInvalidRows(rowErrors) != 4 {
+		t.Errorf("invalid rows = %d, want 4", countInvalidRows(rowErrors))
+	}
+	// Department lewat cost center / id dan role lewat id tetap ter-resolve
+	if rows[0].req.DepartmentID != 1 || rows[0].req.RoleID != 3 || rows[0].req.TotalLeaveDays != 12 {
+		t.Errorf("row 2 resolved to %+v", rows[0].req)
+	}
+}
+
+func TestImportScope(t *testing.T) {
+	// Caller department 2; employee baru di department 1 hanya boleh kalau melapor ke caller
+	_, rowErrors := validateTestImport(t, auth.ScopeDepartment, importRecord("NEW001", ""))
+	if len(rowErrors) != 1 || rowErrors[0].Message != "employee would be outside your users:write scope" {
+		t.Errorf("outside scope: got %+v", rowErrors)
+	}
+	_, rowErrors = validateTestImport(t, auth.ScopeDepartment, importRecord("NEW001", "EMP010"))
+	if len(rowErrors) != 0 {
+		t.Errorf("direct report of caller: got %+v", rowErrors)
+	}
+}
+
+func intPtr(v int) *int { return &v }
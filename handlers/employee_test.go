@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Role yang gagal dibaca tidak boleh jadi "" (bukan privileged) lalu langsung ditulis
+func TestLoadRoleName(t *testing.T) {
+	original := queryRoleName
+	t.Cleanup(func() { queryRoleName = original })
+
+	cases := []struct {
+		name     string
+		lookup   func(int) (string, error)
+		wantOK   bool
+		wantCode int
+	}{
+		{"found", func(int) (string, error) { return "admin", nil }, true, http.StatusOK},
+		{"missing role", func(int) (string, error) { return "", sql.ErrNoRows }, false, http.StatusBadRequest},
+		{"lookup failed", func(int) (string, error) { return "", errors.New("connection reset") }, false, http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		queryRoleName = tc.lookup
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		name, ok := loadRoleName(c, 3)
+		if ok != tc.wantOK || w.Code != tc.wantCode {
+			t.Errorf("%s: got ok=%t status=%d, want ok=%t status=%d", tc.name, ok, w.Code, tc.wantOK, tc.wantCode)
+		}
+		if ok && name != "admin" {
+			t.Errorf("%s: got role %q", tc.name, name)
+		}
+	}
+}
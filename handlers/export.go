@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	exportFormatCSV  = "csv"
+	exportFormatXLSX = "xlsx"
+
+	// exportFlushEvery - CSV di-flush ke client setiap sekian baris
+	exportFlushEvery = 500
+)
+
+// exportColumn - Satu kolom export: key untuk ?columns=, judul di baris header, ekspresi SQL
+// (dengan args-nya kalau ada) dan apakah nilainya ditulis sebagai angka di XLSX
+type exportColumn struct {
+	key     string
+	header  string
+	expr    string
+	args    []interface{}
+	numeric bool
+}
+
+// exportQuery - Bagian query export selain kolom; WHERE sudah termasuk scope caller
+type exportQuery struct {
+	name    string // nama file dan nama export di audit log
+	from    string
+	where   string
+	args    []interface{}
+	orderBy string
+}
+
+// exportWriter - Tujuan baris export (CSV atau XLSX)
+type exportWriter interface {
+	WriteRow(values []string) error
+	Close() error
+}
+
+type csvExportWriter struct {
+	writer  *csv.Writer
+	flusher http.Flusher
+	numeric []bool
+	rows    int
+}
+
+func (w *csvExportWriter) WriteRow(values []string) error {
+	safe := make([]string, len(values))
+	for i, value := range values {
+		safe[i] = csvSafeCell(value, w.numeric[i])
+	}
+	if err := w.writer.Write(safe); err != nil {
+		return err
+	}
+	w.rows++
+	if w.rows%exportFlushEvery == 0 {
+		w.writer.Flush()
+		w.flusher.Flush()
+	}
+	return w.writer.Error()
+}
+
+func (w *csvExportWriter) Close() error {
+	w.writer.Flush()
+	w.flusher.Flush()
+	return w.writer.Error()
+}
+
+// csvSafeCell - Spreadsheet membaca cell yang diawali =, +, -, @ (atau tab/CR) sebagai formula
+// (CSV injection); prefix ' supaya tampil sebagai teks. Angka di kolom numeric (mis. balance
+// negatif) dibiarkan. XLSX tidak perlu karena cell string tidak pernah dievaluasi.
+func csvSafeCell(value string, numeric bool) string {
+	if value == "" || !strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return value
+	}
+	if numeric {
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return value
+		}
+	}
+	return "'" + value
+}
+
+// numericColumns - Flag numeric per kolom untuk writer
+func numericColumns(columns []exportColumn) []bool {
+	numeric := make([]bool, len(columns))
+	for i, column := range columns {
+		numeric[i] = column.numeric
+	}
+	return numeric
+}
+
+// xlsxExportWriter - excelize StreamWriter menyimpan baris di temp file (bukan memory)
+// dan workbook baru ditulis ke response saat Close
+type xlsxExportWriter struct {
+	file    *excelize.File
+	stream  *excelize.StreamWriter
+	numeric []bool
+	out     http.ResponseWriter
+	row     int
+}
+
+func newXLSXExportWriter(out http.ResponseWriter, columns []exportColumn) (*xlsxExportWriter, error) {
+	file := excelize.NewFile()
+	stream, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &xlsxExportWriter{file: file, stream: stream, numeric: numericColumns(columns), out: out}, nil
+}
+
+func (w *xlsxExportWriter) WriteRow(values []string) error {
+	w.row++
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		cells[i] = value
+		// Baris pertama adalah header, selalu teks
+		if w.row > 1 && w.numeric[i] && value != "" {
+			if number, err := strconv.ParseFloat(value, 64); err == nil {
+				cells[i] = number
+			}
+		}
+	}
+	cell, err := excelize.CoordinatesToCellName(1, w.row)
+	if err != nil {
+		return err
+	}
+	return w.stream.SetRow(cell, cells)
+}
+
+func (w *xlsxExportWriter) Close() error {
+	defer w.file.Close()
+	if err := w.stream.Flush(); err != nil {
+		return err
+	}
+	return w.file.Write(w.out)
+}
+
+// selectExportColumns - Kolom dari ?columns=a,b,c (urutan mengikuti parameter); default semua kolom
+func selectExportColumns(c *gin.Context, available []exportColumn) ([]exportColumn, error) {
+	raw := strings.TrimSpace(c.Query("columns"))
+	if raw == "" {
+		return available, nil
+	}
+
+	byKey := map[string]exportColumn{}
+	keys := make([]string, len(available))
+	for i, column := range available {
+		byKey[column.key] = column
+		keys[i] = column.key
+	}
+
+	selected := []exportColumn{}
+	seen := map[string]bool{}
+	for _, key := range strings.Split(raw, ",") {
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "" || seen[key] {
+			continue
+		}
+		column, ok := byKey[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, available: %s", key, strings.Join(keys, ", "))
+		}
+		seen[key] = true
+		selected = append(selected, column)
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("columns must name at least one column")
+	}
+	return selected, nil
+}
+
+// exportDateRange - ?from= dan ?to= (YYYY-MM-DD, keduanya opsional). to adalah tanggal inklusif.
+func exportDateRange(c *gin.Context) (from, to *time.Time, err error) {
+	for _, param := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &from}, {"to", &to}} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		date, err := time.ParseInLocation("2006-01-02", raw, time.Local)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s must be a date in YYYY-MM-DD format", param.name)
+		}
+		*param.target = &date
+	}
+	if from != nil && to != nil && to.Before(*from) {
+		return nil, nil, errors.New("to must not be before from")
+	}
+	return from, to, nil
+}
+
+// streamExport - Jalankan query export dan tulis hasilnya langsung ke response, baris per baris.
+// Error sebelum baris pertama masih dijawab JSON; setelah itu response hanya bisa diputus.
+func streamExport(c *gin.Context, available []exportColumn, query exportQuery) {
+	format := strings.ToLower(c.DefaultQuery("format", exportFormatCSV))
+	if format != exportFormatCSV && format != exportFormatXLSX {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+		return
+	}
+	columns, err := selectExportColumns(c, available)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	expressions := make([]string, len(columns))
+	headers := make([]string, len(columns))
+	keys := make([]string, len(columns))
+	var args []interface{}
+	for i, column := range columns {
+		expressions[i] = column.expr
+		headers[i] = column.header
+		keys[i] = column.key
+		args = append(args, column.args...)
+	}
+	args = append(args, query.args...)
+
+	rows, err := database.DB.Query(`SELECT `+strings.Join(expressions, ", ")+`
+		FROM `+query.from+`
+		WHERE `+query.where+`
+		ORDER BY `+query.orderBy, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("%s-%s.%s", query.name, time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Cache-Control", "no-store")
+
+	var writer exportWriter
+	if format == exportFormatXLSX {
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		writer, err = newXLSXExportWriter(c.Writer, columns)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		writer = &csvExportWriter{writer: csv.NewWriter(c.Writer), flusher: c.Writer, numeric: numericColumns(columns)}
+	}
+	c.Status(http.StatusOK)
+
+	count, err := writeExportRows(writer, headers, rows)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Header dan sebagian data sudah terkirim, jadi client hanya melihat file terpotong
+		log.Printf("❌ Export %s aborted after %d rows: %v", query.name, count, err)
+		c.Abort()
+		return
+	}
+
+	recordExport(c, query.name, format, keys, count)
+	log.Printf("📤 Exported %d %s rows as %s", count, query.name, format)
+}
+
+func writeExportRows(writer exportWriter, headers []string, rows *sql.Rows) (int, error) {
+	if err := writer.WriteRow(headers); err != nil {
+		return 0, err
+	}
+
+	values := make([]sql.NullString, len(headers))
+	targets := make([]interface{}, len(headers))
+	for i := range values {
+		targets[i] = &values[i]
+	}
+	record := make([]string, len(headers))
+
+	count := 0
+	for rows.Next() {
+		if err := rows.Scan(targets...); err != nil {
+			return count, err
+		}
+		for i, value := range values {
+			record[i] = value.String
+		}
+		if err := writer.WriteRow(record); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// recordExport - Export berisi data personal, jadi setiap export dicatat di audit_logs
+func recordExport(c *gin.Context, name, format string, columns []string, count int) {
+	identity, _ := auth.CurrentIdentity(c)
+	event := services.AuditEvent{
+		Action:    "data_exported",
+		IPAddress: c.ClientIP(),
+		Details: map[string]interface{}{
+			"export":  name,
+			"format":  format,
+			"columns": columns,
+			"rows":    count,
+			"query":   c.Request.URL.RawQuery,
+		},
+	}
+	if identity.IsServiceAccount() {
+		event.Details["service_account"] = identity.ServiceAccountName
+	} else {
+		event.ActorID = &identity.EmployeeID
+	}
+	services.RecordAuditEvent(event)
+}
+
+// ExportEmployees - Directory employee sebagai CSV/XLSX, dengan filter yang sama seperti
+// GET /api/employees (q, department_id, role_id, manager_id, status) dan scope users:read.
+// from/to menyaring tanggal employee dibuat.
+func ExportEmployees(c *gin.Context) {
+	where, args, err := employeeFilters(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	from, to, err := exportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if from != nil {
+		where += " AND e.created_at >= ?"
+		args = append(args, *from)
+	}
+	if to != nil {
+		where += " AND e.created_at < ?"
+		args = append(args, to.AddDate(0, 0, 1))
+	}
+
+	streamExport(c, []exportColumn{
+		{key: "id", header: "ID", expr: "e.id", numeric: true},
+		{key: "employee_id", header: "Employee ID", expr: "e.employee_id"},
+		{key: "name", header: "Name", expr: "e.name"},
+		{key: "email", header: "Email", expr: "e.email"},
+		{key: "position", header: "Position", expr: "e.position"},
+		{key: "department", header: "Department", expr: "d.name"},
+		{key: "role", header: "Role", expr: "r.name"},
+		{key: "manager", header: "Manager", expr: "m.name"},
+		{key: "manager_employee_id", header: "Manager Employee ID", expr: "m.employee_id"},
+		{key: "is_manager", header: "Is Manager", expr: "IF(e.is_manager, 'yes', 'no')"},
+		{key: "status", header: "Status", expr: "IF(e.is_active, 'active', 'inactive')"},
+		{key: "total_leave_days", header: "Total Leave Days", expr: "e.total_leave_days", numeric: true},
+		{key: "remaining_leave_days", header: "Remaining Leave Days", expr: "e.remaining_leave_days", numeric: true},
+		{key: "created_at", header: "Created At", expr: "DATE_FORMAT(e.created_at, '%Y-%m-%d %H:%i:%s')"},
+	}, exportQuery{
+		name:    "employees",
+		from:    "employees e " + employeeJoins,
+		where:   where,
+		args:    args,
+		orderBy: "e.name, e.id",
+	})
+}
+
+// ExportLeaveRequests - Leave request dalam scope reports:read caller sebagai CSV/XLSX.
+// Query: from/to (leave yang beririsan dengan periode), status, leave_type, department_id.
+// Leave type dan reason mengikuti visibility policy seperti di kalender dan reports.
+func ExportLeaveRequests(c *gin.Context) {
+	from, to, err := exportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	viewer, err := newLeaveViewer(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	where, args := auth.ScopeFilter(c, auth.CurrentScope(c), "e")
+	if from != nil {
+		where += " AND lr.end_date >= ?"
+		args = append(args, from.Format("2006-01-02"))
+	}
+	if to != nil {
+		where += " AND lr.start_date <= ?"
+		args = append(args, to.Format("2006-01-02"))
+	}
+	if status := c.Query("status"); status != "" {
+		where += " AND lr.status = ?"
+		args = append(args, status)
+	}
+	if raw := c.Query("department_id"); raw != "" {
+		departmentID, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "department_id must be a number"})
+			return
+		}
+		where += " AND e.department_id = ?"
+		args = append(args, departmentID)
+	}
+
+	typeExpr, typeArgs := viewer.leaveTypeSQL("lr.leave_type", "p")
+	if leaveType := c.Query("leave_type"); leaveType != "" {
+		// Filter pada type yang terlihat, supaya type yang disembunyikan tidak bisa ditebak lewat filter
+		where += " AND " + typeExpr + " = ?"
+		args = append(append(args, typeArgs...), strings.ToLower(leaveType))
+	}
+	reasonExpr, reasonArgs := viewer.reasonSQL("lr.reason", "p")
+
+	streamExport(c, []exportColumn{
+		{key: "id", header: "ID", expr: "lr.id", numeric: true},
+		{key: "employee_id", header: "Employee ID", expr: "e.employee_id"},
+		{key: "employee_name", header: "Employee", expr: "e.name"},
+		{key: "department", header: "Department", expr: "d.name"},
+		{key: "leave_type", header: "Leave Type", expr: typeExpr, args: typeArgs},
+		{key: "start_date", header: "Start Date", expr: "DATE_FORMAT(lr.start_date, '%Y-%m-%d')"},
+		{key: "end_date", header: "End Date", expr: "DATE_FORMAT(lr.end_date, '%Y-%m-%d')"},
+		{key: "total_days", header: "Total Days", expr: "lr.total_days", numeric: true},
+		{key: "status", header: "Status", expr: "lr.status"},
+		{key: "reason", header: "Reason", expr: reasonExpr, args: reasonArgs},
+		{key: "approved_by", header: "Approved By", expr: "a.name"},
+		{key: "approved_at", header: "Approved At", expr: "DATE_FORMAT(lr.approved_at, '%Y-%m-%d %H:%i:%s')"},
+		{key: "created_at", header: "Submitted At", expr: "DATE_FORMAT(lr.created_at, '%Y-%m-%d %H:%i:%s')"},
+	}, exportQuery{
+		name: "leave-requests",
+		from: `leave_requests lr
+			JOIN employees e ON lr.employee_id = e.id
+			LEFT JOIN departments d ON e.department_id = d.id
+			LEFT JOIN employees a ON lr.approved_by = a.id
+			` + leavePolicyJoin,
+		where:   where,
+		args:    args,
+		orderBy: "lr.start_date, lr.id",
+	})
+}
+
+// ExportLeaveBalances - Balance cuti per employee dalam scope reports:read caller.
+// taken_days/pending_days dihitung dari leave yang mulai di periode from/to (default tahun ini).
+// Query lain: department_id, status=active|inactive|all (default active).
+func ExportLeaveBalances(c *gin.Context) {
+	from, to, err := exportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	now := today()
+	if from == nil {
+		start := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.Local)
+		from = &start
+	}
+	if to == nil {
+		end := time.Date(from.Year(), time.December, 31, 0, 0, 0, 0, time.Local)
+		to = &end
+	}
+
+	where, args := auth.ScopeFilter(c, auth.CurrentScope(c), "e")
+	if raw := c.Query("department_id"); raw != "" {
+		departmentID, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "department_id must be a number"})
+			return
+		}
+		where += " AND e.department_id = ?"
+		args = append(args, departmentID)
+	}
+	switch c.DefaultQuery("status", "active") {
+	case "active":
+		where += " AND e.is_active = TRUE"
+	case "inactive":
+		where += " AND e.is_active = FALSE"
+	case "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, inactive or all"})
+		return
+	}
+
+	period := []interface{}{from.Format("2006-01-02"), to.Format("2006-01-02")}
+	streamExport(c, []exportColumn{
+		{key: "employee_id", header: "Employee ID", expr: "e.employee_id"},
+		{key: "name", header: "Name", expr: "e.name"},
+		{key: "department", header: "Department", expr: "d.name"},
+		{key: "total_leave_days", header: "Total Leave Days", expr: "e.total_leave_days", numeric: true},
+		{key: "remaining_leave_days", header: "Remaining Leave Days", expr: "e.remaining_leave_days", numeric: true},
+		{key: "taken_days", header: "Taken Days", numeric: true, args: period, expr: `(SELECT COALESCE(SUM(t.total_days), 0)
+			FROM leave_requests t WHERE t.employee_id = e.id AND t.status = 'approved'
+			AND t.start_date BETWEEN ? AND ?)`},
+		{key: "pending_days", header: "Pending Days", numeric: true, args: period, expr: `(SELECT COALESCE(SUM(t.total_days), 0)
+			FROM leave_requests t WHERE t.employee_id = e.id AND t.status = 'pending'
+			AND t.start_date BETWEEN ? AND ?)`},
+		{key: "period_start", header: "Period Start", expr: "?", args: period[:1]},
+		{key: "period_end", header: "Period End", expr: "?", args: period[1:]},
+	}, exportQuery{
+		name: "leave-balances",
+		from: `employees e
+			LEFT JOIN departments d ON e.department_id = d.id`,
+		where:   where,
+		args:    args,
+		orderBy: "e.name, e.id",
+	})
+}
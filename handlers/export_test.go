@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func exportTestContext(query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/exports/employees?"+query, nil)
+	return c
+}
+
+func TestCSVSafeCell(t *testing.T) {
+	cases := []struct {
+		value   string
+		numeric bool
+		want    string
+	}{
+		{"Jane Doe", false, "Jane Doe"},
+		{"", false, ""},
+		{"=HYPERLINK(\"http://evil\")", false, "'=HYPERLINK(\"http://evil\")"},
+		{"+1 555 0100", false, "'+1 555 0100"},
+		{"-2+3", false, "'-2+3"},
+		{"@SUM(A1:A2)", false, "'@SUM(A1:A2)"},
+		{"\t=1+1", false, "'\t=1+1"},
+		{"\r=1+1", false, "'\r=1+1"},
+		{"a=b", false, "a=b"},
+		{"-2", true, "-2"},
+		{"-1.5", true, "-1.5"},
+		{"-2", false, "'-2"},
+		{"=1+1", true, "'=1+1"},
+	}
+	for _, tc := range cases {
+		if got := csvSafeCell(tc.value, tc.numeric); got != tc.want {
+			t.Errorf("csvSafeCell(%q, %v) = %q, want %q", tc.value, tc.numeric, got, tc.want)
+		}
+	}
+}
+
+func TestCSVExportWriterEscapesFormulas(t *testing.T) {
+	out := httptest.NewRecorder()
+	columns := []exportColumn{{key: "name"}, {key: "remaining_leave_days", numeric: true}}
+	writer := &csvExportWriter{writer: csv.NewWriter(out), flusher: out, numeric: numericColumns(columns)}
+
+	for _, row := range [][]string{{"Name", "Remaining"}, {"=cmd|' /C calc'!A0", "-3"}, {"Jane", "12"}} {
+		if err := writer.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(out.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"Name", "Remaining"}, {"'=cmd|' /C calc'!A0", "-3"}, {"Jane", "12"}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %q, want %q", records, want)
+	}
+}
+
+func TestSelectExportColumns(t *testing.T) {
+	available := []exportColumn{{key: "id"}, {key: "name"}, {key: "email"}}
+	keys := func(columns []exportColumn) []string {
+		var result []string
+		for _, column := range columns {
+			result = append(result, column.key)
+		}
+		return result
+	}
+
+	cases := []struct {
+		query   string
+		want    []string
+		wantErr string
+	}{
+		{"", []string{"id", "name", "email"}, ""},
+		{"columns=email,id", []string{"email", "id"}, ""},
+		{"columns=%20Name%20,,EMAIL,name", []string{"name", "email"}, ""},
+		{"columns=name,salary", nil, `unknown column "salary", available: id, name, email`},
+		{"columns=,%20,", nil, "columns must name at least one column"},
+	}
+	for _, tc := range cases {
+		got, err := selectExportColumns(exportTestContext(tc.query), available)
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("%q: got error %v, want %q", tc.query, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(keys(got), tc.want) {
+			t.Errorf("%q: got %v, %v; want %v", tc.query, keys(got), err, tc.want)
+		}
+	}
+}
+
+func TestExportDateRange(t *testing.T) {
+	date := func(value string) *time.Time {
+		parsed, _ := time.ParseInLocation("2006-01-02", value, time.Local)
+		return &parsed
+	}
+
+	cases := []struct {
+		query    string
+		from, to *time.Time
+		wantErr  string
+	}{
+		{"", nil, nil, ""},
+		{"from=2024-01-01", date("2024-01-01"), nil, ""},
+		{"to=2024-12-31", nil, date("2024-12-31"), ""},
+		{"from=2024-01-01&to=2024-01-01", date("2024-01-01"), date("2024-01-01"), ""},
+		{"from=2024-02-01&to=2024-01-31", nil, nil, "to must not be before from"},
+		{"from=01/02/2024", nil, nil, "from must be a date in YYYY-MM-DD format"},
+		{"from=2024-01-01&to=2024-13-01", nil, nil, "to must be a date in YYYY-MM-DD format"},
+	}
+	for _, tc := range cases {
+		from, to, err := exportDateRange(exportTestContext(tc.query))
+		if tc.wantErr != "" {
+			if err == nil || err.Error() != tc.wantErr {
+				t.Errorf("%q: got error %v, want %q", tc.query, err, tc.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(from, tc.from) || !reflect.DeepEqual(to, tc.to) {
+			t.Errorf("%q: got %v, %v, %v; want %v, %v", tc.query, from, to, err, tc.from, tc.to)
+		}
+	}
+}
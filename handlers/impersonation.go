@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"leavemaster/auth"
+	"leavemaster/models"
+	"leavemaster/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errImpersonatedChange - Change request tidak boleh diajukan lewat token impersonation
+var errImpersonatedChange = errors.New("Change requests cannot be filed while impersonating")
+
+// rejectImpersonatedDecision - Approval (leave, amendment, change request) dan pengajuan
+// change request ditolak untuk token impersonation, termasuk yang write diizinkan: super_admin
+// bisa mengajukan sesuatu lalu menyetujuinya sendiri atas nama approver. Return true kalau
+// response 403 sudah ditulis.
+func rejectImpersonatedDecision(c *gin.Context) bool {
+	identity, _ := auth.CurrentIdentity(c)
+	if !identity.IsImpersonated() {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Approvals and change requests are not available while impersonating", "impersonating": true})
+	return true
+}
+
+// StartImpersonation - super_admin mendapat access token berumur pendek sebagai employee
+// lain untuk melihat apa yang dilihat employee tersebut. Actor asli ada di claim "act";
+// setiap request dengan token ini dicatat di audit_logs oleh AuthMiddleware.
+func StartImpersonation(c *gin.Context) {
+	identity, _ := auth.CurrentIdentity(c)
+	if identity.RoleName != "super_admin" || identity.IsImpersonated() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only super admins can impersonate employees"})
+		return
+	}
+
+	var req models.ImpersonationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.EmployeeID == identity.EmployeeID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot impersonate yourself"})
+		return
+	}
+
+	actor, err := loadAuthEmployee("e.id = ?", identity.EmployeeID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account inactive or not found"})
+		return
+	}
+
+	target, err := loadAuthEmployee("e.id = ?", req.EmployeeID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Active employee not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if target.RoleName == "super_admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot impersonate another super admin"})
+		return
+	}
+
+	sessionID, err := auth.RandomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not start impersonation"})
+		return
+	}
+
+	ttl := auth.ImpersonationTTL()
+	expiresAt := time.Now().Add(ttl)
+	readOnly := !req.AllowWrites
+
+	// Tanpa sid (tidak ada refresh token), tanpa 2fa_setup dan pwd_change: kredensial milik target
+	claims := buildAccessClaims(target, "")
+	delete(claims, "2fa_setup")
+	delete(claims, "pwd_change")
+	claims["exp"] = expiresAt.Unix()
+	auth.AddImpersonatorClaim(claims, auth.Impersonator{
+		EmployeeID:   actor.ID,
+		TokenVersion: actor.TokenVersion,
+		ReadOnly:     readOnly,
+		SessionID:    sessionID,
+	})
+
+	token, err := auth.SignToken(claims)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    "impersonation_started",
+		ActorID:   &actor.ID,
+		SubjectID: &target.ID,
+		IPAddress: c.ClientIP(),
+		Details: map[string]interface{}{
+			"session_id": sessionID,
+			"reason":     req.Reason,
+			"read_only":  readOnly,
+			"expires_at": expiresAt.UTC().Format(time.RFC3339),
+		},
+	})
+	log.Printf("🕵️ Employee %d impersonating employee %d (read_only=%t)", actor.ID, target.ID, readOnly)
+
+	target.Password = ""
+	c.JSON(http.StatusOK, models.ImpersonationResponse{
+		Token:     token,
+		ExpiresIn: int64(ttl.Seconds()),
+		ExpiresAt: expiresAt,
+		ReadOnly:  readOnly,
+		SessionID: sessionID,
+		Employee:  &target,
+	})
+}
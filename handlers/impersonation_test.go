@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"leavemaster/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// impersonatedContext - super_admin 1 memakai token impersonation (write diizinkan) sebagai
+// approver 5. Tidak ada database: handler yang lolos sampai query akan panic.
+func impersonatedContext(method, path, body string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, path, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = gin.Params{{Key: "id", Value: "7"}}
+	auth.SetIdentity(c, auth.Identity{
+		EmployeeID:   5,
+		RoleName:     "admin",
+		IsManager:    true,
+		Impersonator: &auth.Impersonator{EmployeeID: 1, ReadOnly: false, SessionID: "s1"},
+	})
+	auth.SetPermissionScope(c, auth.ScopeOrganisation)
+	return c, w
+}
+
+func TestImpersonatedDecisionsRejected(t *testing.T) {
+	cases := []struct {
+		name    string
+		handler gin.HandlerFunc
+		method  string
+		path    string
+		body    string
+	}{
+		{"leave decision", UpdateLeaveStatus, http.MethodPut, "/api/leave/7/status", `{"status":"approved"}`},
+		{"amendment decision", UpdateLeaveAmendmentStatus, http.MethodPut, "/api/leave/amendments/7/status", `{"status":"approved"}`},
+		{"approve change request", ApproveChangeRequest, http.MethodPost, "/api/change-requests/7/approve", ""},
+		{"reject change request", RejectChangeRequest, http.MethodPost, "/api/change-requests/7/reject", ""},
+		{"cancel change request", CancelChangeRequest, http.MethodPost, "/api/change-requests/7/cancel", ""},
+		{"balance adjustment", CreateBalanceAdjustment, http.MethodPost, "/api/employees/balance-adjustments",
+			`{"employee_ids":[5],"days":3,"reason":"bonus"}`},
+	}
+	for _, tc := range cases {
+		c, w := impersonatedContext(tc.method, tc.path, tc.body)
+		tc.handler(c)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: got %d, want 403", tc.name, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `"impersonating":true`) {
+			t.Errorf("%s: unexpected body %s", tc.name, w.Body.String())
+		}
+	}
+}
+
+// Promosi dan reaktivasi dari UpdateEmployee juga lewat createChangeRequest
+func TestImpersonatedChangeRequestNotFiled(t *testing.T) {
+	c, _ := impersonatedContext(http.MethodPut, "/api/employees/7", "")
+	subjectID := 7
+	_, err := createChangeRequest(c, changeRoleChange, &subjectID,
+		roleChangePayload{EmployeeID: 7, RoleID: 2, RoleName: "admin"}, "promotion")
+	if err != errImpersonatedChange {
+		t.Fatalf("expected errImpersonatedChange, got %v", err)
+	}
+	if status := changeRequestErrorStatus(err); status != http.StatusForbidden {
+		t.Errorf("impersonation error mapped to %d, want 403", status)
+	}
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
 
+	"leavemaster/auth"
 	"leavemaster/database"
 	"leavemaster/models"
 	"leavemaster/services"
@@ -15,6 +17,24 @@ import (
 
 var emailService = services.NewEmailService()
 
+// leaveRequestColumns - Kolom yang dibaca scanLeaveRequest (butuh JOIN employees e)
+const leaveRequestColumns = `lr.id, lr.employee_id, lr.leave_type, lr.start_date, lr.end_date,
+		lr.total_days, lr.reason, lr.status, lr.approved_by, lr.approved_at, lr.created_at,
+		lr.auto_approval_rule_id, e.name as employee_name`
+
+// rowScanner - *sql.Row atau *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLeaveRequest(scanner rowScanner, lr *models.LeaveRequest) error {
+	return scanner.Scan(
+		&lr.ID, &lr.EmployeeID, &lr.LeaveType, &lr.StartDate, &lr.EndDate,
+		&lr.TotalDays, &lr.Reason, &lr.Status, &lr.ApprovedBy, &lr.ApprovedAt,
+		&lr.CreatedAt, &lr.AutoApprovalRuleID, &lr.EmployeeName,
+	)
+}
+
 func CreateLeaveRequest(c *gin.Context) {
 	var leaveReq models.LeaveRequest
 	if err := c.ShouldBindJSON(&leaveReq); err != nil {
@@ -22,28 +42,66 @@ func CreateLeaveRequest(c *gin.Context) {
 		return
 	}
 
-	employeeID := c.GetInt("employee_id")
+	employeeID := auth.CurrentEmployeeID(c)
 	leaveReq.EmployeeID = employeeID
 	leaveReq.Status = "pending"
+	// total_days dihitung dari tanggal; nilai dari client hanya diterima kalau sama
+	if leaveReq.TotalDays == 0 {
+		leaveReq.TotalDays = leaveDays(leaveReq.StartDate, leaveReq.EndDate)
+	}
+
+	// Validasi tanggal terhadap policy leave type (notice, backdate, panjang cuti)
+	violations, err := validateLeaveRequest(leaveReq)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Leave request violates leave policy",
+			"violations": violations,
+		})
+		return
+	}
 
 	// Get employee details termasuk department
 	var employeeName, employeeEmail string
 	var managerID *int
-	var employeeDeptID int
-	err := database.DB.QueryRow("SELECT name, email, manager_id, department_id FROM employees WHERE id = ?", employeeID).
-		Scan(&employeeName, &employeeEmail, &managerID, &employeeDeptID)
+	var employeeDeptID, remainingDays int
+	err = database.DB.QueryRow("SELECT name, email, manager_id, department_id, remaining_leave_days FROM employees WHERE id = ?", employeeID).
+		Scan(&employeeName, &employeeEmail, &managerID, &employeeDeptID, &remainingDays)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Employee not found"})
 		return
 	}
 
+	// Cek auto-approval rules - request rutin tidak perlu menunggu manager
+	rule, err := findAutoApprovalRule(leaveReq, remainingDays, employeeDeptID)
+	if err != nil {
+		log.Printf("⚠️ Auto-approval evaluation failed, falling back to manual approval: %v", err)
+		rule = nil
+	}
+	if rule != nil {
+		leaveReq.Status = "approved"
+		leaveReq.AutoApprovalRuleID = &rule.ID
+		leaveReq.AutoApprovalRuleName = rule.Name
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
 	query := `INSERT INTO leave_requests 
-        (employee_id, leave_type, start_date, end_date, total_days, reason, status) 
-        VALUES (?, ?, ?, ?, ?, ?, ?)`
+        (employee_id, leave_type, start_date, end_date, total_days, reason, status, approved_at, auto_approval_rule_id) 
+        VALUES (?, ?, ?, ?, ?, ?, ?, CASE WHEN ? = 'approved' THEN NOW() END, ?)`
 
-	result, err := database.DB.Exec(query,
+	result, err := tx.Exec(query,
 		leaveReq.EmployeeID, leaveReq.LeaveType, leaveReq.StartDate,
-		leaveReq.EndDate, leaveReq.TotalDays, leaveReq.Reason, leaveReq.Status)
+		leaveReq.EndDate, leaveReq.TotalDays, leaveReq.Reason, leaveReq.Status,
+		leaveReq.Status, leaveReq.AutoApprovalRuleID)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -53,6 +111,49 @@ func CreateLeaveRequest(c *gin.Context) {
 	id, _ := result.LastInsertId()
 	leaveReq.ID = int(id)
 
+	if rule != nil {
+		_, err = tx.Exec(`UPDATE employees SET remaining_leave_days = remaining_leave_days - ? WHERE id = ?`,
+			leaveReq.TotalDays, employeeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if rule != nil {
+		log.Printf("🤖 Leave request %d auto-approved by rule %q (ID: %d)", leaveReq.ID, rule.Name, rule.ID)
+
+		go func() {
+			if employeeEmail != "" {
+				emailService.SendLeaveStatusNotification(
+					employeeEmail,
+					employeeName,
+					"approved",
+					leaveReq.LeaveType,
+					leaveReq.StartDate,
+					leaveReq.EndDate,
+				)
+			}
+		}()
+
+		go func() {
+			websocket.SendLeaveStatusNotification(
+				employeeName,
+				"approved",
+				leaveReq.LeaveType,
+				employeeID,
+			)
+		}()
+
+		c.JSON(http.StatusCreated, leaveReq)
+		return
+	}
+
 	// DEBUG: Log untuk troubleshooting
 	fmt.Printf("🆕 DEBUG: Employee %s (ID: %d, Dept: %d) created leave request. Manager ID: %v\n",
 		employeeName, employeeID, employeeDeptID, managerID)
@@ -79,7 +180,7 @@ func CreateLeaveRequest(c *gin.Context) {
 					leaveReq.LeaveType,
 					leaveReq.StartDate,
 					leaveReq.EndDate,
-					leaveReq.Reason,
+					reasonForApprovers(leaveReq.LeaveType, leaveReq.Reason),
 				)
 			}
 		}()
@@ -95,7 +196,7 @@ func CreateLeaveRequest(c *gin.Context) {
 			leaveReq.LeaveType,
 			leaveReq.StartDate,
 			leaveReq.EndDate,
-			leaveReq.Reason,
+			reasonForApprovers(leaveReq.LeaveType, leaveReq.Reason),
 			employeeDeptID, // Kirim department ID
 		)
 
@@ -109,9 +210,9 @@ func CreateLeaveRequest(c *gin.Context) {
 }
 
 func GetMyLeaveRequests(c *gin.Context) {
-	employeeID := c.GetInt("employee_id")
+	employeeID := auth.CurrentEmployeeID(c)
 
-	query := `SELECT lr.*, e.name as employee_name 
+	query := `SELECT ` + leaveRequestColumns + ` 
 		FROM leave_requests lr 
 		JOIN employees e ON lr.employee_id = e.id 
 		WHERE lr.employee_id = ? 
@@ -127,12 +228,7 @@ func GetMyLeaveRequests(c *gin.Context) {
 	var leaveRequests []models.LeaveRequest
 	for rows.Next() {
 		var lr models.LeaveRequest
-		err := rows.Scan(
-			&lr.ID, &lr.EmployeeID, &lr.LeaveType, &lr.StartDate, &lr.EndDate,
-			&lr.TotalDays, &lr.Reason, &lr.Status, &lr.ApprovedBy, &lr.ApprovedAt,
-			&lr.CreatedAt, &lr.EmployeeName,
-		)
-		if err != nil {
+		if err := scanLeaveRequest(rows, &lr); err != nil {
 			continue
 		}
 		leaveRequests = append(leaveRequests, lr)
@@ -142,33 +238,31 @@ func GetMyLeaveRequests(c *gin.Context) {
 }
 
 func GetPendingLeaveRequests(c *gin.Context) {
-	if !c.GetBool("is_manager") {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
+	managerID := auth.CurrentEmployeeID(c)
+	scope := auth.CurrentScope(c)
 
-	managerID := c.GetInt("employee_id")
+	log.Printf("🔍 Approver %d loading pending requests (scope: %s)", managerID, scope)
 
-	// Get manager's department
-	var managerDeptID int
-	err := database.DB.QueryRow("SELECT department_id FROM employees WHERE id = ?", managerID).
-		Scan(&managerDeptID)
+	// Hanya requests dalam scope leave:approve caller, tanpa request milik sendiri.
+	// Reason dengan policy "hr" hanya terlihat kalau caller juga punya leave:confidential.
+	viewer, err := newLeaveViewer(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Manager department not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-
-	log.Printf("🔍 Manager %d loading pending requests for department %d", managerID, managerDeptID)
-
-	// Hanya tampilkan requests dari department yang sama dengan manager
-	query := `SELECT lr.*, e.name as employee_name 
+	columns, args := viewer.leaveRequestColumns()
+	scopeClause, scopeArgs := auth.ScopeFilter(c, scope, "e")
+	args = append(append(args, scopeArgs...), managerID)
+	query := `SELECT ` + columns + ` 
 		FROM leave_requests lr 
 		JOIN employees e ON lr.employee_id = e.id 
+		` + leavePolicyJoin + `
 		WHERE lr.status = 'pending' 
-		AND e.department_id = ?
+		AND ` + scopeClause + `
+		AND lr.employee_id <> ?
 		ORDER BY lr.created_at DESC`
 
-	rows, err := database.DB.Query(query, managerDeptID)
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -178,30 +272,23 @@ func GetPendingLeaveRequests(c *gin.Context) {
 	var leaveRequests []models.LeaveRequest
 	for rows.Next() {
 		var lr models.LeaveRequest
-		err := rows.Scan(
-			&lr.ID, &lr.EmployeeID, &lr.LeaveType, &lr.StartDate, &lr.EndDate,
-			&lr.TotalDays, &lr.Reason, &lr.Status, &lr.ApprovedBy, &lr.ApprovedAt,
-			&lr.CreatedAt, &lr.EmployeeName,
-		)
-		if err != nil {
+		if err := scanLeaveRequest(rows, &lr); err != nil {
 			continue
 		}
 		leaveRequests = append(leaveRequests, lr)
 	}
 
-	log.Printf("✅ Found %d pending leave requests for department %d", len(leaveRequests), managerDeptID)
+	log.Printf("✅ Found %d pending leave requests for approver %d", len(leaveRequests), managerID)
 	c.JSON(http.StatusOK, leaveRequests)
 }
 
 func UpdateLeaveStatus(c *gin.Context) {
-	if !c.GetBool("is_manager") {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+	if rejectImpersonatedDecision(c) {
 		return
 	}
-
 	leaveID := c.Param("id")
 	var request struct {
-		Status string `json:"status" binding:"required"`
+		Status string `json:"status" binding:"required,oneof=approved rejected"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -209,10 +296,67 @@ func UpdateLeaveStatus(c *gin.Context) {
 		return
 	}
 
-	managerID := c.GetInt("employee_id")
-	query := `UPDATE leave_requests SET status = ?, approved_by = ?, approved_at = NOW() WHERE id = ?`
+	managerID := auth.CurrentEmployeeID(c)
 
-	_, err := database.DB.Exec(query, request.Status, managerID, leaveID)
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Pastikan manager ini memang approver untuk request tersebut. Row di-lock supaya dua
+	// keputusan bersamaan tidak sama-sama lolos pengecekan status pending.
+	var target leaveApprovalTarget
+	var currentStatus string
+	err = tx.QueryRow(`
+		SELECT lr.employee_id, e.manager_id, e.department_id, lr.status
+		FROM leave_requests lr
+		JOIN employees e ON lr.employee_id = e.id
+		WHERE lr.id = ?
+		FOR UPDATE`, leaveID).
+		Scan(&target.EmployeeID, &target.ManagerID, &target.DepartmentID, &currentStatus)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Leave request not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if reason := checkLeaveApprover(c, target); reason != "" {
+		log.Printf("⛔ Approval denied - Manager %d, Leave %s: %s", managerID, leaveID, reason)
+		c.JSON(http.StatusForbidden, gin.H{"error": reason})
+		return
+	}
+
+	// Hanya request pending yang bisa diputuskan; approve ulang akan memotong balance dua kali
+	if currentStatus != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Leave request is no longer pending", "status": currentStatus})
+		return
+	}
+
+	query := `UPDATE leave_requests SET status = ?, approved_by = ?, approved_at = NOW() WHERE id = ? AND status = 'pending'`
+
+	result, err := tx.Exec(query, request.Status, managerID, leaveID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Leave request is no longer pending"})
+		return
+	}
+
+	var totalDays, employeeID int
+	var leaveType, startDate, endDate, employeeName string
+	err = tx.QueryRow(`
+		SELECT e.id, e.name, lr.total_days, lr.leave_type, lr.start_date, lr.end_date 
+		FROM leave_requests lr
+		JOIN employees e ON lr.employee_id = e.id
+		WHERE lr.id = ?`, leaveID).
+		Scan(&employeeID, &employeeName, &totalDays, &leaveType, &startDate, &endDate)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -220,18 +364,19 @@ func UpdateLeaveStatus(c *gin.Context) {
 
 	// Update remaining leave days if approved
 	if request.Status == "approved" {
-		var totalDays, employeeID int
-		var leaveType, startDate, endDate, employeeName string
-		database.DB.QueryRow(`
-            SELECT e.id, e.name, lr.total_days, lr.leave_type, lr.start_date, lr.end_date 
-            FROM leave_requests lr
-            JOIN employees e ON lr.employee_id = e.id
-            WHERE lr.id = ?`, leaveID).
-			Scan(&employeeID, &employeeName, &totalDays, &leaveType, &startDate, &endDate)
-
 		updateQuery := `UPDATE employees SET remaining_leave_days = remaining_leave_days - ? WHERE id = ?`
-		database.DB.Exec(updateQuery, totalDays, employeeID)
+		if _, err := tx.Exec(updateQuery, totalDays, employeeID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if request.Status == "approved" {
 		// Send email to employee
 		go func() {
 			var employeeEmail string
@@ -262,14 +407,9 @@ func UpdateLeaveStatus(c *gin.Context) {
 	} else if request.Status == "rejected" {
 		// Send rejection email dan notification
 		go func() {
-			var employeeEmail, employeeName, leaveType, startDate, endDate string
-			var employeeID int
-			database.DB.QueryRow(`
-                SELECT e.id, e.email, e.name, lr.leave_type, lr.start_date, lr.end_date 
-                FROM employees e 
-                JOIN leave_requests lr ON e.id = lr.employee_id 
-                WHERE lr.id = ?`, leaveID).
-				Scan(&employeeID, &employeeEmail, &employeeName, &leaveType, &startDate, &endDate)
+			var employeeEmail string
+			database.DB.QueryRow(`SELECT email FROM employees WHERE id = ?`, employeeID).
+				Scan(&employeeEmail)
 
 			if employeeEmail != "" {
 				// Send email
@@ -295,3 +435,30 @@ func UpdateLeaveStatus(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Leave request updated successfully"})
 }
+
+// leaveApprovalTarget - Data pemilik leave request yang dibutuhkan untuk cek approver
+type leaveApprovalTarget struct {
+	EmployeeID   int
+	ManagerID    *int
+	DepartmentID *int
+}
+
+// checkLeaveApprover - Cek apakah user yang login boleh approve/reject leave request milik target,
+// berdasarkan scope leave:approve (team = bawahan langsung, department, atau organisasi).
+// Return string kosong kalau boleh, atau alasan penolakan kalau tidak.
+func checkLeaveApprover(c *gin.Context, target leaveApprovalTarget) string {
+	if auth.CurrentEmployeeID(c) == target.EmployeeID {
+		return "You cannot approve or reject your own leave request"
+	}
+
+	identity, _ := auth.CurrentIdentity(c)
+	scope, err := auth.PermissionScopeOf(identity, "leave:approve")
+	if err != nil {
+		return "Failed to check approval permission"
+	}
+	if auth.InScope(c, scope, auth.ScopeTarget(target)) {
+		return ""
+	}
+
+	return "You are not an approver for this employee: they are outside your leave:approve scope"
+}
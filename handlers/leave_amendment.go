@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/models"
+	"leavemaster/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// updateLeaveRequestBody - Field yang boleh diubah pemilik leave request. Field kosong = tidak diubah.
+type updateLeaveRequestBody struct {
+	LeaveType string  `json:"leave_type"`
+	StartDate string  `json:"start_date"`
+	EndDate   string  `json:"end_date"`
+	TotalDays int     `json:"total_days"`
+	Reason    *string `json:"reason"`
+}
+
+const leaveAmendmentColumns = `a.id, a.leave_request_id, a.requested_by, e.name,
+	a.old_leave_type, a.old_start_date, a.old_end_date, a.old_total_days, COALESCE(a.old_reason, ''),
+	a.new_leave_type, a.new_start_date, a.new_end_date, a.new_total_days, COALESCE(a.new_reason, ''),
+	a.status, a.decided_by, a.decided_at, a.created_at`
+
+func scanLeaveAmendment(scanner rowScanner, a *models.LeaveAmendment) error {
+	return scanner.Scan(
+		&a.ID, &a.LeaveRequestID, &a.RequestedBy, &a.EmployeeName,
+		&a.OldLeaveType, &a.OldStartDate, &a.OldEndDate, &a.OldTotalDays, &a.OldReason,
+		&a.NewLeaveType, &a.NewStartDate, &a.NewEndDate, &a.NewTotalDays, &a.NewReason,
+		&a.Status, &a.DecidedBy, &a.DecidedAt, &a.CreatedAt,
+	)
+}
+
+// UpdateLeaveRequest - Edit leave request milik sendiri.
+// Request pending langsung diubah, request approved jadi amendment yang harus di-approve ulang.
+func UpdateLeaveRequest(c *gin.Context) {
+	leaveID := c.Param("id")
+	employeeID := auth.CurrentEmployeeID(c)
+
+	var body updateLeaveRequestBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var current models.LeaveRequest
+	err := scanLeaveRequest(database.DB.QueryRow(`SELECT `+leaveRequestColumns+`
+		FROM leave_requests lr
+		JOIN employees e ON lr.employee_id = e.id
+		WHERE lr.id = ?`, leaveID), &current)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Leave request not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if current.EmployeeID != employeeID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own leave requests"})
+		return
+	}
+	if current.Status != "pending" && current.Status != "approved" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only pending or approved leave requests can be edited"})
+		return
+	}
+
+	// Gabungkan perubahan ke data lama
+	updated := current
+	if body.LeaveType != "" {
+		updated.LeaveType = body.LeaveType
+	}
+	if body.StartDate != "" {
+		updated.StartDate = body.StartDate
+	}
+	if body.EndDate != "" {
+		updated.EndDate = body.EndDate
+	}
+	// total_days selalu dari tanggal hasil gabungan; kalau client kirim, validasi yang membandingkan
+	updated.TotalDays = leaveDays(updated.StartDate, updated.EndDate)
+	if body.TotalDays != 0 {
+		updated.TotalDays = body.TotalDays
+	}
+	if body.Reason != nil {
+		updated.Reason = *body.Reason
+	}
+
+	violations, err := validateLeaveRequest(updated)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(violations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Leave request violates leave policy",
+			"violations": violations,
+		})
+		return
+	}
+
+	if current.Status == "pending" {
+		updatePendingLeaveRequest(c, current, updated)
+		return
+	}
+	requestLeaveAmendment(c, current, updated)
+}
+
+// updatePendingLeaveRequest - Request belum di-approve, langsung update dan simpan nilai lama di history
+func updatePendingLeaveRequest(c *gin.Context, current, updated models.LeaveRequest) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	// Status ikut dicek supaya tidak menimpa request yang barusan di-approve manager
+	result, err := tx.Exec(`
+		UPDATE leave_requests
+		SET leave_type = ?, start_date = ?, end_date = ?, total_days = ?, reason = ?
+		WHERE id = ? AND status = 'pending'`,
+		updated.LeaveType, dateOnly(updated.StartDate), dateOnly(updated.EndDate), updated.TotalDays, updated.Reason, current.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Leave request is no longer pending, please reload and try again"})
+		return
+	}
+
+	if _, err := insertLeaveAmendment(tx, current, updated, "applied"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("✏️ Pending leave request %d edited by employee %d", current.ID, current.EmployeeID)
+	c.JSON(http.StatusOK, updated)
+}
+
+// requestLeaveAmendment - Request sudah approved, buat amendment yang menunggu approval ulang
+func requestLeaveAmendment(c *gin.Context, current, updated models.LeaveRequest) {
+	var pendingCount int
+	err := database.DB.QueryRow(`SELECT COUNT(*) FROM leave_request_amendments
+		WHERE leave_request_id = ? AND status = 'pending'`, current.ID).Scan(&pendingCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if pendingCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "This leave request already has an amendment waiting for approval"})
+		return
+	}
+
+	amendmentID, err := insertLeaveAmendment(database.DB, current, updated, "pending")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("📝 Amendment %d requested for approved leave request %d", amendmentID, current.ID)
+
+	// Notifikasi ke manager - sama seperti leave request baru
+	var employeeName string
+	var managerID, departmentID *int
+	database.DB.QueryRow("SELECT name, manager_id, department_id FROM employees WHERE id = ?", current.EmployeeID).
+		Scan(&employeeName, &managerID, &departmentID)
+
+	if managerID != nil {
+		go func() {
+			var managerEmail, managerName string
+			err := database.DB.QueryRow("SELECT email, name FROM employees WHERE id = ?", *managerID).
+				Scan(&managerEmail, &managerName)
+			if err != nil || managerEmail == "" {
+				return
+			}
+			emailService.SendLeaveRequestNotification(
+				managerEmail,
+				managerName,
+				employeeName,
+				updated.LeaveType,
+				updated.StartDate,
+				updated.EndDate,
+				"[Amendment to approved leave] "+reasonForApprovers(updated.LeaveType, updated.Reason),
+			)
+		}()
+	}
+
+	if departmentID != nil {
+		go websocket.SendLeaveAmendmentNotification(
+			employeeName,
+			updated.LeaveType,
+			updated.StartDate,
+			updated.EndDate,
+			*departmentID,
+		)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":      "Amendment submitted and waiting for re-approval",
+		"amendment_id": amendmentID,
+	})
+}
+
+// sqlExecer - *sql.DB atau *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertLeaveAmendment(db sqlExecer, current, updated models.LeaveRequest, status string) (int64, error) {
+	result, err := db.Exec(`
+		INSERT INTO leave_request_amendments (
+			leave_request_id, requested_by,
+			old_leave_type, old_start_date, old_end_date, old_total_days, old_reason,
+			new_leave_type, new_start_date, new_end_date, new_total_days, new_reason,
+			status
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		current.ID, current.EmployeeID,
+		current.LeaveType, dateOnly(current.StartDate), dateOnly(current.EndDate), current.TotalDays, current.Reason,
+		updated.LeaveType, dateOnly(updated.StartDate), dateOnly(updated.EndDate), updated.TotalDays, updated.Reason,
+		status)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetLeaveRequestHistory - History perubahan leave request (pemilik atau approver)
+func GetLeaveRequestHistory(c *gin.Context) {
+	leaveID := c.Param("id")
+
+	var target leaveApprovalTarget
+	err := database.DB.QueryRow(`
+		SELECT lr.employee_id, e.manager_id, e.department_id
+		FROM leave_requests lr
+		JOIN employees e ON lr.employee_id = e.id
+		WHERE lr.id = ?`, leaveID).
+		Scan(&target.EmployeeID, &target.ManagerID, &target.DepartmentID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Leave request not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if target.EmployeeID != auth.CurrentEmployeeID(c) {
+		if reason := checkLeaveApprover(c, target); reason != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": reason})
+			return
+		}
+	}
+
+	// Approver tidak melihat reason yang policy-nya hanya untuk HR
+	viewer, err := newLeaveViewer(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	columns, args := viewer.leaveAmendmentColumns()
+
+	rows, err := database.DB.Query(`SELECT `+columns+`
+		FROM leave_request_amendments a
+		JOIN employees e ON a.requested_by = e.id
+		`+leaveAmendmentPolicyJoins+`
+		WHERE a.leave_request_id = ?
+		ORDER BY a.created_at, a.id`, append(args, leaveID)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	history := []models.LeaveAmendment{}
+	for rows.Next() {
+		var a models.LeaveAmendment
+		if err := scanLeaveAmendment(rows, &a); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		history = append(history, a)
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// GetPendingLeaveAmendments - Amendment yang menunggu approval dalam scope leave:approve caller
+func GetPendingLeaveAmendments(c *gin.Context) {
+	// Reason lama/baru disaring dengan policy leave type masing-masing
+	viewer, err := newLeaveViewer(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	columns, args := viewer.leaveAmendmentColumns()
+
+	scopeClause, scopeArgs := auth.ScopeFilter(c, auth.CurrentScope(c), "e")
+	args = append(append(args, scopeArgs...), auth.CurrentEmployeeID(c))
+
+	rows, err := database.DB.Query(`SELECT `+columns+`
+		FROM leave_request_amendments a
+		JOIN employees e ON a.requested_by = e.id
+		`+leaveAmendmentPolicyJoins+`
+		WHERE a.status = 'pending' AND `+scopeClause+` AND a.requested_by <> ?
+		ORDER BY a.created_at DESC`, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	amendments := []models.LeaveAmendment{}
+	for rows.Next() {
+		var a models.LeaveAmendment
+		if err := scanLeaveAmendment(rows, &a); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		amendments = append(amendments, a)
+	}
+
+	c.JSON(http.StatusOK, amendments)
+}
+
+// UpdateLeaveAmendmentStatus - Approve/reject amendment. Kalau approved, leave request diupdate
+// dan remaining_leave_days disesuaikan dengan selisih hari.
+func UpdateLeaveAmendmentStatus(c *gin.Context) {
+	if rejectImpersonatedDecision(c) {
+		return
+	}
+	amendmentID := c.Param("id")
+	var request struct {
+		Status string `json:"status" binding:"required,oneof=approved rejected"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var amendment models.LeaveAmendment
+	err := scanLeaveAmendment(database.DB.QueryRow(`SELECT `+leaveAmendmentColumns+`
+		FROM leave_request_amendments a
+		JOIN employees e ON a.requested_by = e.id
+		WHERE a.id = ?`, amendmentID), &amendment)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Amendment not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if amendment.Status != "pending" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Amendment has already been decided"})
+		return
+	}
+
+	var target leaveApprovalTarget
+	var employeeEmail string
+	err = database.DB.QueryRow(`
+		SELECT e.id, e.manager_id, e.department_id, e.email
+		FROM employees e WHERE e.id = ?`, amendment.RequestedBy).
+		Scan(&target.EmployeeID, &target.ManagerID, &target.DepartmentID, &employeeEmail)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if reason := checkLeaveApprover(c, target); reason != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": reason})
+		return
+	}
+
+	approverID := auth.CurrentEmployeeID(c)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE leave_request_amendments
+		SET status = ?, decided_by = ?, decided_at = NOW()
+		WHERE id = ? AND status = 'pending'`, request.Status, approverID, amendment.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Amendment has already been decided"})
+		return
+	}
+
+	if request.Status == "approved" {
+		// Selisih dihitung dari total_days yang sekarang tersimpan, bukan snapshot amendment.
+		// Leave induk dikunci; kalau sudah tidak approved (mis. dibatalkan) amendment tidak berlaku.
+		var currentDays int
+		var parentStatus string
+		err = tx.QueryRow("SELECT total_days, status FROM leave_requests WHERE id = ? FOR UPDATE", amendment.LeaveRequestID).
+			Scan(&currentDays, &parentStatus)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if parentStatus != "approved" {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":  "Leave request is no longer approved",
+				"status": parentStatus,
+			})
+			return
+		}
+
+		_, err = tx.Exec(`
+			UPDATE leave_requests
+			SET leave_type = ?, start_date = ?, end_date = ?, total_days = ?, reason = ?,
+				approved_by = ?, approved_at = NOW()
+			WHERE id = ?`,
+			amendment.NewLeaveType, dateOnly(amendment.NewStartDate), dateOnly(amendment.NewEndDate),
+			amendment.NewTotalDays, amendment.NewReason, approverID, amendment.LeaveRequestID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		_, err = tx.Exec(`UPDATE employees SET remaining_leave_days = remaining_leave_days - ? WHERE id = ?`,
+			amendment.NewTotalDays-currentDays, amendment.RequestedBy)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("📋 Amendment %d for leave request %d %s by %d",
+		amendment.ID, amendment.LeaveRequestID, request.Status, approverID)
+
+	go func() {
+		if employeeEmail != "" {
+			emailService.SendLeaveStatusNotification(
+				employeeEmail,
+				amendment.EmployeeName,
+				request.Status,
+				amendment.NewLeaveType,
+				dateOnly(amendment.NewStartDate),
+				dateOnly(amendment.NewEndDate),
+			)
+		}
+		websocket.SendLeaveStatusNotification(
+			amendment.EmployeeName,
+			request.Status,
+			amendment.NewLeaveType,
+			amendment.RequestedBy,
+		)
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "Amendment " + request.Status + " successfully"})
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"database/sql"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Urutan event di tanggal yang sama: carry-over dulu, lalu expiry, accrual, baru cuti
+const (
+	forecastCarryOver = "carry_over"
+	forecastExpiry    = "carry_over_expiry"
+	forecastAccrual   = "accrual"
+	forecastApproved  = "approved_leave"
+	forecastPending   = "pending_leave"
+	forecastWhatIf    = "hypothetical_leave"
+)
+
+var forecastKindOrder = map[string]int{
+	forecastCarryOver: 0,
+	forecastExpiry:    1,
+	forecastAccrual:   2,
+	forecastApproved:  3,
+	forecastPending:   3,
+	forecastWhatIf:    3,
+}
+
+// maxForecastHorizon - Proyeksi paling jauh 3 tahun ke depan
+const maxForecastHorizon = 3 * 365 * 24 * time.Hour
+
+// forecastEvent - Satu titik perubahan balance di timeline proyeksi
+type forecastEvent struct {
+	Date           string  `json:"date"`
+	Kind           string  `json:"kind"`
+	LeaveType      string  `json:"leave_type,omitempty"`
+	LeaveRequestID int     `json:"leave_request_id,omitempty"`
+	Change         float64 `json:"change"`
+	Balance        float64 `json:"balance"`
+	Note           string  `json:"note,omitempty"`
+
+	date time.Time
+	days float64
+}
+
+// forecastPool - Balance yang dipakai bersama oleh satu atau lebih leave type.
+// Balance utama (remaining_leave_days) dipotong oleh semua leave type; leave type dengan
+// annual_entitlement sendiri juga punya pool sendiri (lihat poolsCharged).
+type forecastPool struct {
+	LeaveTypes        []string        `json:"leave_types"`
+	AnnualEntitlement float64         `json:"annual_entitlement"`
+	AccrualFrequency  string          `json:"accrual_frequency"`
+	CurrentBalance    float64         `json:"current_balance"`
+	ProjectedBalance  float64         `json:"projected_balance"`
+	LowestBalance     float64         `json:"lowest_balance"`
+	Sufficient        bool            `json:"sufficient"`
+	Timeline          []forecastEvent `json:"timeline"`
+
+	maxCarryOver      *int
+	carryExpiryMonths *int
+	events            []forecastEvent
+}
+
+// GetLeaveForecast - Proyeksi balance cuti per leave type sampai tanggal tertentu.
+// Query: date (wajib), employee_id (opsional, untuk approver), dan what-if request:
+// leave_type, start_date, end_date, total_days.
+//
+// Catatan: carry-over yang sudah berjalan di tahun ini tidak tercatat di DB,
+// jadi proyeksi menganggap balance sekarang tidak punya sisa carry-over.
+func GetLeaveForecast(c *gin.Context) {
+	targetDate, err := parseLeaveDate(c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date is required in YYYY-MM-DD format"})
+		return
+	}
+	now := today()
+	if targetDate.Before(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must not be in the past"})
+		return
+	}
+	if targetDate.Sub(now) > maxForecastHorizon {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "date must be within 3 years from today"})
+		return
+	}
+
+	employeeID := auth.CurrentEmployeeID(c)
+	if raw := c.Query("employee_id"); raw != "" {
+		employeeID, err = strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "employee_id must be a number"})
+			return
+		}
+	}
+
+	var target leaveApprovalTarget
+	var totalLeaveDays, remainingLeaveDays int
+	err = database.DB.QueryRow(`
+		SELECT id, manager_id, department_id, total_leave_days, remaining_leave_days
+		FROM employees WHERE id = ?`, employeeID).
+		Scan(&target.EmployeeID, &target.ManagerID, &target.DepartmentID, &totalLeaveDays, &remainingLeaveDays)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if employeeID != auth.CurrentEmployeeID(c) {
+		if reason := checkLeaveApprover(c, target); reason != "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": reason})
+			return
+		}
+	}
+
+	pools, poolFor, err := loadForecastPools(employeeID, totalLeaveDays, remainingLeaveDays, now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Leave request yang masih akan berjalan
+	rows, err := database.DB.Query(`
+		SELECT id, leave_type, start_date, total_days, status
+		FROM leave_requests
+		WHERE employee_id = ? AND status IN ('approved', 'pending')
+		AND end_date >= ? AND start_date <= ?
+		ORDER BY start_date`,
+		employeeID, now.Format("2006-01-02"), targetDate.Format("2006-01-02"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, totalDays int
+		var leaveType, startDate, status string
+		if err := rows.Scan(&id, &leaveType, &startDate, &totalDays, &status); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		start, err := parseLeaveDate(startDate)
+		if err != nil || start.Before(now) {
+			start = now
+		}
+
+		for _, pool := range poolsCharged(pools, poolFor(leaveType)) {
+			event := forecastEvent{
+				Kind:           forecastPending,
+				LeaveType:      leaveType,
+				LeaveRequestID: id,
+				date:           start,
+				days:           float64(totalDays),
+			}
+			if status == "approved" {
+				event.Kind = forecastApproved
+				// Balance utama dipotong saat approve; entitlement sendiri dihitung dari cuti tahun berjalan
+				if pool == pools[0] || start.Year() == now.Year() {
+					event.days = 0
+					event.Note = "already included in current balance"
+				}
+			}
+			pool.events = append(pool.events, event)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// What-if request dari query string
+	var hypothetical *models.LeaveRequest
+	var violations []models.ValidationError
+	if c.Query("start_date") != "" {
+		hypothetical = &models.LeaveRequest{
+			EmployeeID: employeeID,
+			LeaveType:  strings.ToLower(c.DefaultQuery("leave_type", "annual")),
+			StartDate:  c.Query("start_date"),
+			EndDate:    c.DefaultQuery("end_date", c.Query("start_date")),
+		}
+		hypothetical.TotalDays, _ = strconv.Atoi(c.Query("total_days"))
+		if hypothetical.TotalDays == 0 {
+			hypothetical.TotalDays = leaveDays(hypothetical.StartDate, hypothetical.EndDate)
+		}
+
+		violations, err = validateLeaveRequest(*hypothetical)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if start, err := parseLeaveDate(hypothetical.StartDate); err == nil && !start.After(targetDate) {
+			if start.Before(now) {
+				start = now
+			}
+			for _, pool := range poolsCharged(pools, poolFor(hypothetical.LeaveType)) {
+				pool.events = append(pool.events, forecastEvent{
+					Kind:      forecastWhatIf,
+					LeaveType: hypothetical.LeaveType,
+					date:      start,
+					days:      float64(hypothetical.TotalDays),
+				})
+			}
+		}
+	}
+
+	for _, pool := range pools {
+		pool.simulate(now, targetDate)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"employee_id":             employeeID,
+		"as_of":                   now.Format("2006-01-02"),
+		"target_date":             targetDate.Format("2006-01-02"),
+		"balances":                pools,
+		"hypothetical":            hypothetical,
+		"hypothetical_violations": violations,
+	})
+}
+
+// loadForecastPools - Siapkan balance pool dari leave_type_policies.
+// pools[0] selalu balance utama; poolFor mengembalikan pool untuk leave type tertentu.
+func loadForecastPools(employeeID, totalLeaveDays, remainingLeaveDays int, now time.Time) ([]*forecastPool, func(string) *forecastPool, error) {
+	mainPool := &forecastPool{
+		AnnualEntitlement: float64(totalLeaveDays),
+		AccrualFrequency:  "yearly",
+		CurrentBalance:    float64(remainingLeaveDays),
+	}
+	pools := []*forecastPool{mainPool}
+	ownPools := map[string]*forecastPool{}
+
+	rows, err := database.DB.Query(`SELECT ` + leaveTypePolicyColumns + `
+		FROM leave_type_policies ORDER BY leave_type`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var policy models.LeaveTypePolicy
+		if err := scanLeaveTypePolicy(rows, &policy); err != nil {
+			return nil, nil, err
+		}
+
+		if policy.AnnualEntitlement == nil {
+			mainPool.LeaveTypes = append(mainPool.LeaveTypes, policy.LeaveType)
+			// Accrual balance utama mengikuti policy "annual"
+			if policy.LeaveType == "annual" {
+				mainPool.AccrualFrequency = policy.AccrualFrequency
+				mainPool.maxCarryOver = policy.MaxCarryOverDays
+				mainPool.carryExpiryMonths = policy.CarryOverExpiryMonths
+			}
+			continue
+		}
+
+		pool := &forecastPool{
+			LeaveTypes:        []string{policy.LeaveType},
+			AnnualEntitlement: float64(*policy.AnnualEntitlement),
+			AccrualFrequency:  policy.AccrualFrequency,
+			maxCarryOver:      policy.MaxCarryOverDays,
+			carryExpiryMonths: policy.CarryOverExpiryMonths,
+		}
+		ownPools[policy.LeaveType] = pool
+		pools = append(pools, pool)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	// Entitlement sendiri: sisa = entitlement - cuti approved tahun ini
+	for leaveType, pool := range ownPools {
+		var used int
+		err := database.DB.QueryRow(`
+			SELECT COALESCE(SUM(total_days), 0) FROM leave_requests
+			WHERE employee_id = ? AND leave_type = ? AND status = 'approved' AND YEAR(start_date) = ?`,
+			employeeID, leaveType, now.Year()).Scan(&used)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool.CurrentBalance = pool.AnnualEntitlement - float64(used)
+	}
+
+	poolFor := func(leaveType string) *forecastPool {
+		leaveType = strings.ToLower(leaveType)
+		if pool, ok := ownPools[leaveType]; ok {
+			return pool
+		}
+		for _, t := range mainPool.LeaveTypes {
+			if t == leaveType {
+				return mainPool
+			}
+		}
+		mainPool.LeaveTypes = append(mainPool.LeaveTypes, leaveType)
+		return mainPool
+	}
+
+	return pools, poolFor, nil
+}
+
+// poolsCharged - Pool yang berkurang oleh cuti di pool ini. Approval selalu memotong
+// remaining_leave_days, jadi cuti dari leave type dengan entitlement sendiri juga mengurangi
+// balance utama selain entitlement-nya sendiri.
+func poolsCharged(pools []*forecastPool, pool *forecastPool) []*forecastPool {
+	if pool == pools[0] {
+		return pools[:1]
+	}
+	return []*forecastPool{pool, pools[0]}
+}
+
+// simulate - Jalankan semua event (accrual, carry-over, cuti) dari hari ini sampai target
+func (p *forecastPool) simulate(now, targetDate time.Time) {
+	// Jadwal accrual & carry-over tiap awal bulan
+	for month := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.Local); !month.After(targetDate); month = month.AddDate(0, 1, 0) {
+		if month.Month() == time.January {
+			p.events = append(p.events, forecastEvent{Kind: forecastCarryOver, date: month})
+			if p.carryExpiryMonths != nil && *p.carryExpiryMonths > 0 {
+				expiry := month.AddDate(0, *p.carryExpiryMonths, 0)
+				if !expiry.After(targetDate) {
+					p.events = append(p.events, forecastEvent{Kind: forecastExpiry, date: expiry})
+				}
+			}
+		}
+		if p.AccrualFrequency == "monthly" || month.Month() == time.January {
+			p.events = append(p.events, forecastEvent{Kind: forecastAccrual, date: month})
+		}
+	}
+
+	sort.SliceStable(p.events, func(i, j int) bool {
+		if !p.events[i].date.Equal(p.events[j].date) {
+			return p.events[i].date.Before(p.events[j].date)
+		}
+		return forecastKindOrder[p.events[i].Kind] < forecastKindOrder[p.events[j].Kind]
+	})
+
+	balance := p.CurrentBalance
+	carried := 0.0
+	lowest := balance
+	p.Timeline = []forecastEvent{}
+
+	for _, event := range p.events {
+		switch event.Kind {
+		case forecastCarryOver:
+			carry := balance
+			if p.maxCarryOver != nil && carry > float64(*p.maxCarryOver) {
+				carry = float64(*p.maxCarryOver)
+			}
+			event.Change = carry - balance
+			if event.Change < 0 {
+				event.Note = "unused days above the carry-over limit are forfeited"
+			}
+			balance = carry
+			carried = math.Max(carry, 0)
+		case forecastExpiry:
+			if carried == 0 {
+				continue
+			}
+			event.Change = -carried
+			event.Note = "unused carried-over days expire"
+			balance -= carried
+			carried = 0
+		case forecastAccrual:
+			event.Change = p.AnnualEntitlement
+			if p.AccrualFrequency == "monthly" {
+				event.Change = p.AnnualEntitlement / 12
+			}
+			balance += event.Change
+		default:
+			if event.days > 0 {
+				event.Change = -event.days
+				balance -= event.days
+				// Cuti memakai sisa carry-over lebih dulu
+				carried = math.Max(carried-event.days, 0)
+			}
+		}
+
+		event.Date = event.date.Format("2006-01-02")
+		event.Change = roundDays(event.Change)
+		event.Balance = roundDays(balance)
+		lowest = math.Min(lowest, balance)
+		p.Timeline = append(p.Timeline, event)
+	}
+
+	p.CurrentBalance = roundDays(p.CurrentBalance)
+	p.ProjectedBalance = roundDays(balance)
+	p.LowestBalance = roundDays(lowest)
+	p.Sufficient = lowest >= 0
+}
+
+func roundDays(days float64) float64 {
+	return math.Round(days*100) / 100
+}
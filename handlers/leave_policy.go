@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"leavemaster/database"
+	"leavemaster/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const leaveTypePolicyColumns = `leave_type, min_notice_days, max_advance_days,
+	max_backdate_days, max_consecutive_days, annual_entitlement, accrual_frequency,
+	max_carry_over_days, carry_over_expiry_months, calendar_visibility, reason_visibility, updated_at`
+
+func scanLeaveTypePolicy(scanner rowScanner, policy *models.LeaveTypePolicy) error {
+	return scanner.Scan(
+		&policy.LeaveType, &policy.MinNoticeDays, &policy.MaxAdvanceDays,
+		&policy.MaxBackdateDays, &policy.MaxConsecutiveDays, &policy.AnnualEntitlement,
+		&policy.AccrualFrequency, &policy.MaxCarryOverDays, &policy.CarryOverExpiryMonths,
+		&policy.CalendarVisibility, &policy.ReasonVisibility, &policy.UpdatedAt,
+	)
+}
+
+// getLeaveTypePolicy - Ambil policy untuk leave type. Return nil kalau leave type tidak punya policy.
+func getLeaveTypePolicy(leaveType string) (*models.LeaveTypePolicy, error) {
+	var policy models.LeaveTypePolicy
+	err := scanLeaveTypePolicy(database.DB.QueryRow(`SELECT `+leaveTypePolicyColumns+`
+		FROM leave_type_policies WHERE leave_type = ?`, strings.ToLower(leaveType)), &policy)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// validateLeaveRequest - Cek tanggal leave request terhadap policy leave type-nya.
+// Return semua aturan yang dilanggar (kosong kalau valid).
+func validateLeaveRequest(leaveReq models.LeaveRequest) ([]models.ValidationError, error) {
+	var violations []models.ValidationError
+
+	startDate, startErr := parseLeaveDate(leaveReq.StartDate)
+	if startErr != nil {
+		violations = append(violations, models.ValidationError{
+			Field: "start_date", Rule: "date_format", Message: "start_date must be a date in YYYY-MM-DD format",
+		})
+	}
+	endDate, endErr := parseLeaveDate(leaveReq.EndDate)
+	if endErr != nil {
+		violations = append(violations, models.ValidationError{
+			Field: "end_date", Rule: "date_format", Message: "end_date must be a date in YYYY-MM-DD format",
+		})
+	}
+	if startErr != nil || endErr != nil {
+		return violations, nil
+	}
+	if endDate.Before(startDate) {
+		violations = append(violations, models.ValidationError{
+			Field: "end_date", Rule: "date_order", Message: "end_date must not be before start_date",
+		})
+		return violations, nil
+	}
+	// total_days dipakai untuk auto-approval dan potongan balance, jadi harus sama dengan rentang tanggal
+	if days := daysBetween(startDate, endDate) + 1; leaveReq.TotalDays != days {
+		violations = append(violations, models.ValidationError{
+			Field: "total_days", Rule: "date_range",
+			Message: fmt.Sprintf("total_days must match start_date to end_date (%d day(s))", days),
+		})
+	}
+
+	policy, err := getLeaveTypePolicy(leaveReq.LeaveType)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return violations, nil
+	}
+
+	// Hitung per tanggal kalender, bukan jam - hari perpindahan DST tidak 24 jam
+	daysUntilStart := daysBetween(today(), startDate)
+	consecutiveDays := daysBetween(startDate, endDate) + 1
+
+	if daysUntilStart < 0 {
+		backdated := -daysUntilStart
+		if policy.MaxBackdateDays != nil && backdated > *policy.MaxBackdateDays {
+			violations = append(violations, models.ValidationError{
+				Field: "start_date",
+				Rule:  "max_backdate_days",
+				Message: fmt.Sprintf("%s leave can be backdated by at most %d day(s); this request starts %d day(s) ago",
+					policy.LeaveType, *policy.MaxBackdateDays, backdated),
+			})
+		}
+	} else if policy.MinNoticeDays != nil && daysUntilStart < *policy.MinNoticeDays {
+		violations = append(violations, models.ValidationError{
+			Field: "start_date",
+			Rule:  "min_notice_days",
+			Message: fmt.Sprintf("%s leave requires at least %d day(s) notice; this request starts in %d day(s)",
+				policy.LeaveType, *policy.MinNoticeDays, daysUntilStart),
+		})
+	}
+
+	if policy.MaxAdvanceDays != nil && daysUntilStart > *policy.MaxAdvanceDays {
+		violations = append(violations, models.ValidationError{
+			Field: "start_date",
+			Rule:  "max_advance_days",
+			Message: fmt.Sprintf("%s leave can be requested at most %d day(s) in advance; this request starts in %d day(s)",
+				policy.LeaveType, *policy.MaxAdvanceDays, daysUntilStart),
+		})
+	}
+
+	if policy.MaxConsecutiveDays != nil && consecutiveDays > *policy.MaxConsecutiveDays {
+		violations = append(violations, models.ValidationError{
+			Field: "end_date",
+			Rule:  "max_consecutive_days",
+			Message: fmt.Sprintf("%s leave can last at most %d consecutive day(s); this request spans %d day(s)",
+				policy.LeaveType, *policy.MaxConsecutiveDays, consecutiveDays),
+		})
+	}
+
+	return violations, nil
+}
+
+// GetLeavePolicies - List policy semua leave type
+func GetLeavePolicies(c *gin.Context) {
+	rows, err := database.DB.Query(`SELECT ` + leaveTypePolicyColumns + `
+		FROM leave_type_policies ORDER BY leave_type`)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	policies := []models.LeaveTypePolicy{}
+	for rows.Next() {
+		var policy models.LeaveTypePolicy
+		if err := scanLeaveTypePolicy(rows, &policy); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		policies = append(policies, policy)
+	}
+
+	c.JSON(http.StatusOK, policies)
+}
+
+// UpsertLeavePolicy - Create atau replace policy untuk satu leave type
+func UpsertLeavePolicy(c *gin.Context) {
+	leaveType := strings.ToLower(strings.TrimSpace(c.Param("type")))
+
+	var req models.LeaveTypePolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.AccrualFrequency == "" {
+		req.AccrualFrequency = "yearly"
+	}
+	if req.CalendarVisibility == "" {
+		req.CalendarVisibility = calendarVisibilityFull
+	}
+	if req.ReasonVisibility == "" {
+		req.ReasonVisibility = reasonVisibleToApprovers
+	}
+
+	_, err := database.DB.Exec(`
+		INSERT INTO leave_type_policies
+			(leave_type, min_notice_days, max_advance_days, max_backdate_days, max_consecutive_days,
+			annual_entitlement, accrual_frequency, max_carry_over_days, carry_over_expiry_months,
+			calendar_visibility, reason_visibility)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			min_notice_days = VALUES(min_notice_days),
+			max_advance_days = VALUES(max_advance_days),
+			max_backdate_days = VALUES(max_backdate_days),
+			max_consecutive_days = VALUES(max_consecutive_days),
+			annual_entitlement = VALUES(annual_entitlement),
+			accrual_frequency = VALUES(accrual_frequency),
+			max_carry_over_days = VALUES(max_carry_over_days),
+			carry_over_expiry_months = VALUES(carry_over_expiry_months),
+			calendar_visibility = VALUES(calendar_visibility),
+			reason_visibility = VALUES(reason_visibility)`,
+		leaveType, req.MinNoticeDays, req.MaxAdvanceDays, req.MaxBackdateDays, req.MaxConsecutiveDays,
+		req.AnnualEntitlement, req.AccrualFrequency, req.MaxCarryOverDays, req.CarryOverExpiryMonths,
+		req.CalendarVisibility, req.ReasonVisibility)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := getLeaveTypePolicy(leaveType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("✏️ LEAVE POLICY UPDATED: %s", leaveType)
+	c.JSON(http.StatusOK, policy)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+
+	"leavemaster/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Visibility policy per leave type (kolom leave_type_policies.calendar_visibility dan reason_visibility).
+// Requester selalu melihat semuanya; "HR" adalah caller dengan permission leave:confidential
+// dalam scope-nya, "approver" adalah caller dengan leave:approve dalam scope-nya.
+const (
+	calendarVisibilityFull        = "full"          // semua orang melihat leave type
+	calendarVisibilityOutOfOffice = "out_of_office" // rekan kerja hanya melihat "Out of office"
+	reasonVisibleToApprovers      = "approvers"     // requester, approver dan HR
+	reasonVisibleToHR             = "hr"            // requester dan HR saja
+
+	// leaveTypeOutOfOffice - Leave type yang ditampilkan ke rekan kerja kalau type aslinya disembunyikan
+	leaveTypeOutOfOffice = "out_of_office"
+	// restrictedReason - Pengganti reason di notifikasi ke approver kalau reason hanya untuk HR
+	restrictedReason = "(restricted - visible to HR only)"
+)
+
+// leavePolicyJoin - JOIN yang dibutuhkan leaveViewer.leaveTypeSQL/reasonSQL dengan alias p
+const leavePolicyJoin = "LEFT JOIN leave_type_policies p ON p.leave_type = LOWER(lr.leave_type)"
+
+// leaveViewer - Siapa yang melihat data leave di request ini, dalam bentuk kondisi SQL
+// terhadap employee pemilik leave (alias e)
+type leaveViewer struct {
+	employeeID         int
+	approveClause      string
+	approveArgs        []interface{}
+	confidentialClause string
+	confidentialArgs   []interface{}
+}
+
+func newLeaveViewer(c *gin.Context) (leaveViewer, error) {
+	identity, _ := auth.CurrentIdentity(c)
+	approve, err := auth.PermissionScopeOf(identity, "leave:approve")
+	if err != nil {
+		return leaveViewer{}, err
+	}
+	confidential, err := auth.PermissionScopeOf(identity, "leave:confidential")
+	if err != nil {
+		return leaveViewer{}, err
+	}
+
+	v := leaveViewer{employeeID: identity.EmployeeID}
+	v.approveClause, v.approveArgs = auth.ScopeFilter(c, approve, "e")
+	v.confidentialClause, v.confidentialArgs = auth.ScopeFilter(c, confidential, "e")
+	return v, nil
+}
+
+// leaveTypeSQL - Ekspresi leave type yang boleh dilihat caller; "out_of_office" untuk rekan kerja
+// kalau policy leave type-nya menyembunyikan type
+func (v leaveViewer) leaveTypeSQL(typeColumn, policyAlias string) (string, []interface{}) {
+	expr := "CASE WHEN COALESCE(" + policyAlias + ".calendar_visibility, '" + calendarVisibilityFull + "') = '" +
+		calendarVisibilityFull + "' OR e.id = ? OR (" + v.confidentialClause + ") OR (" + v.approveClause + ")" +
+		" THEN " + typeColumn + " ELSE '" + leaveTypeOutOfOffice + "' END"
+	args := []interface{}{v.employeeID}
+	args = append(args, v.confidentialArgs...)
+	return expr, append(args, v.approveArgs...)
+}
+
+// reasonSQL - Ekspresi reason yang boleh dilihat caller; string kosong kalau disembunyikan
+func (v leaveViewer) reasonSQL(reasonColumn, policyAlias string) (string, []interface{}) {
+	expr := "CASE WHEN e.id = ? OR (" + v.confidentialClause + ") OR (COALESCE(" + policyAlias +
+		".reason_visibility, '" + reasonVisibleToApprovers + "') = '" + reasonVisibleToApprovers +
+		"' AND (" + v.approveClause + ")) THEN " + reasonColumn + " ELSE '' END"
+	args := []interface{}{v.employeeID}
+	args = append(args, v.confidentialArgs...)
+	return expr, append(args, v.approveArgs...)
+}
+
+// leaveRequestColumns - leaveRequestColumns dengan leave_type dan reason yang sudah disaring;
+// query-nya harus memakai leavePolicyJoin dan args ini sebelum args WHERE
+func (v leaveViewer) leaveRequestColumns() (string, []interface{}) {
+	typeExpr, args := v.leaveTypeSQL("lr.leave_type", "p")
+	reasonExpr, reasonArgs := v.reasonSQL("lr.reason", "p")
+	columns := strings.Replace(leaveRequestColumns, "lr.leave_type", typeExpr+" AS leave_type", 1)
+	columns = strings.Replace(columns, "lr.reason", reasonExpr+" AS reason", 1)
+	return columns, append(args, reasonArgs...)
+}
+
+// leaveAmendmentPolicyJoins - JOIN policy leave type lama (po) dan baru (pn) untuk leaveAmendmentColumns
+const leaveAmendmentPolicyJoins = `LEFT JOIN leave_type_policies po ON po.leave_type = LOWER(a.old_leave_type)
+		LEFT JOIN leave_type_policies pn ON pn.leave_type = LOWER(a.new_leave_type)`
+
+// leaveAmendmentColumns - leaveAmendmentColumns dengan reason lama/baru yang disaring policy
+// leave type masing-masing; query-nya harus memakai leaveAmendmentPolicyJoins dan args ini
+// sebelum args WHERE
+func (v leaveViewer) leaveAmendmentColumns() (string, []interface{}) {
+	oldReason, args := v.reasonSQL("COALESCE(a.old_reason, '')", "po")
+	newReason, newReasonArgs := v.reasonSQL("COALESCE(a.new_reason, '')", "pn")
+	columns := strings.Replace(leaveAmendmentColumns, "COALESCE(a.old_reason, '')", oldReason, 1)
+	columns = strings.Replace(columns, "COALESCE(a.new_reason, '')", newReason, 1)
+	return columns, append(args, newReasonArgs...)
+}
+
+// leaveTypeLabel - Label leave type untuk judul event kalender
+func leaveTypeLabel(leaveType string) string {
+	if leaveType == leaveTypeOutOfOffice {
+		return "Out of office"
+	}
+	return leaveType
+}
+
+// reasonForApprovers - Reason untuk notifikasi yang dikirim ke approver (email manager,
+// WebSocket ke manager department). Kalau policy tidak bisa dibaca, reason tidak dikirim.
+func reasonForApprovers(leaveType, reason string) string {
+	policy, err := getLeaveTypePolicy(leaveType)
+	if err != nil {
+		log.Printf("⚠️ Failed to load visibility policy for %s: %v", leaveType, err)
+		return restrictedReason
+	}
+	if policy != nil && policy.ReasonVisibility == reasonVisibleToHR {
+		return restrictedReason
+	}
+	return reason
+}
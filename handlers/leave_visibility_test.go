@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+// Reason lama dan baru amendment harus lewat policy leave type masing-masing (po/pn)
+func TestLeaveAmendmentColumnsFilterBothReasons(t *testing.T) {
+	viewer := leaveViewer{
+		employeeID:         4,
+		approveClause:      "e.manager_id = ?",
+		approveArgs:        []interface{}{4},
+		confidentialClause: "FALSE",
+	}
+	columns, args := viewer.leaveAmendmentColumns()
+
+	for _, policyAlias := range []string{"po", "pn"} {
+		if !strings.Contains(columns, "COALESCE("+policyAlias+".reason_visibility, 'approvers')") {
+			t.Errorf("reason not filtered by %s policy: %s", policyAlias, columns)
+		}
+	}
+	for _, reason := range []string{"COALESCE(a.old_reason, '')", "COALESCE(a.new_reason, '')"} {
+		if !strings.Contains(columns, "THEN "+reason+" ELSE '' END") {
+			t.Errorf("%s returned without a visibility check: %s", reason, columns)
+		}
+	}
+	if placeholders := strings.Count(columns, "?"); placeholders != len(args) {
+		t.Errorf("%d placeholders but %d args", placeholders, len(args))
+	}
+	for _, join := range []string{"po.leave_type = LOWER(a.old_leave_type)", "pn.leave_type = LOWER(a.new_leave_type)"} {
+		if !strings.Contains(leaveAmendmentPolicyJoins, join) {
+			t.Errorf("leaveAmendmentPolicyJoins missing %q", join)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"leavemaster/auth"
+	"leavemaster/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var loginLimiter auth.LoginLimiter
+
+// SetLoginLimiter - Dipanggil dari main setelah env dimuat
+func SetLoginLimiter(limiter auth.LoginLimiter) {
+	loginLimiter = limiter
+}
+
+// loginLimitKeys - Gagal login dihitung per akun (email) dan per IP
+func loginLimitKeys(c *gin.Context, email string) []auth.LimitKey {
+	return []auth.LimitKey{auth.AccountLimitKey(email), auth.IPLimitKey(c.ClientIP())}
+}
+
+// loginRetryAfter - Waktu tunggu terlama dari semua key. Kalau limiter error, login tetap diizinkan.
+func loginRetryAfter(keys []auth.LimitKey) time.Duration {
+	if loginLimiter == nil {
+		return 0
+	}
+	var longest time.Duration
+	for _, key := range keys {
+		wait, err := loginLimiter.RetryAfter(key)
+		if err != nil {
+			log.Printf("❌ Login limiter check failed for %s: %v", key.Scope, err)
+			continue
+		}
+		if wait > longest {
+			longest = wait
+		}
+	}
+	return longest
+}
+
+// rejectThrottledLogin - Response 429 dengan Retry-After
+func rejectThrottledLogin(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts. Please try again later.",
+		"retry_after": seconds,
+	})
+}
+
+// recordLoginFailure - Catat gagal login; lockout baru dicatat ke audit log
+func recordLoginFailure(c *gin.Context, keys []auth.LimitKey, employeeID *int) {
+	if loginLimiter == nil {
+		return
+	}
+	for _, key := range keys {
+		status, err := loginLimiter.RecordFailure(key)
+		if err != nil {
+			log.Printf("❌ Failed to record login failure for %s: %v", key.Scope, err)
+			continue
+		}
+		if !status.JustLocked {
+			continue
+		}
+
+		log.Printf("🔒 Login locked - %s: %s until %s", key.Scope, key.Identifier, status.LockedUntil.Format(time.RFC3339))
+		event := services.AuditEvent{
+			Action:    "login_lockout",
+			IPAddress: c.ClientIP(),
+			Details: map[string]interface{}{
+				"scope":        key.Scope,
+				"identifier":   key.Identifier,
+				"failures":     status.Failures,
+				"locked_until": status.LockedUntil,
+			},
+		}
+		if key.Scope == auth.LimitScopeAccount {
+			event.SubjectID = employeeID
+		}
+		services.RecordAuditEvent(event)
+	}
+}
+
+// resetLoginFailures - Login sukses hanya mereset hitungan akun, bukan IP
+func resetLoginFailures(keys []auth.LimitKey) {
+	if loginLimiter == nil {
+		return
+	}
+	for _, key := range keys {
+		if key.Scope != auth.LimitScopeAccount {
+			continue
+		}
+		if err := loginLimiter.Reset(key); err != nil {
+			log.Printf("❌ Failed to reset login failures for %s: %v", key.Scope, err)
+		}
+	}
+}
+
+// GetLoginLockouts - Daftar akun/IP yang sedang terkunci
+func GetLoginLockouts(c *gin.Context) {
+	if loginLimiter == nil {
+		c.JSON(http.StatusOK, gin.H{"lockouts": []auth.LockoutStatus{}})
+		return
+	}
+
+	lockouts, err := loginLimiter.Lockouts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockouts"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"lockouts": lockouts})
+}
+
+// UnlockLogin - Buka lockout akun atau IP secara manual
+func UnlockLogin(c *gin.Context) {
+	var req struct {
+		Scope      string `json:"scope" binding:"required,oneof=account ip"`
+		Identifier string `json:"identifier" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key := auth.IPLimitKey(req.Identifier)
+	if req.Scope == auth.LimitScopeAccount {
+		key = auth.AccountLimitKey(req.Identifier)
+	}
+
+	if loginLimiter != nil {
+		if err := loginLimiter.Reset(key); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock"})
+			return
+		}
+	}
+
+	actorID := auth.CurrentEmployeeID(c)
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    "login_unlock",
+		ActorID:   &actorID,
+		IPAddress: c.ClientIP(),
+		Details: map[string]interface{}{
+			"scope":      key.Scope,
+			"identifier": key.Identifier,
+		},
+	})
+
+	log.Printf("🔓 Login unlocked - %s: %s by employee %d", key.Scope, key.Identifier, actorID)
+	c.JSON(http.StatusOK, gin.H{"message": "Login unlocked successfully"})
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// OIDCLogin - Mulai login SSO: simpan state/nonce/PKCE verifier lalu kembalikan URL IdP
+func OIDCLogin(c *gin.Context) {
+	if !auth.OIDCEnabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SSO login is not configured"})
+		return
+	}
+
+	state, err := auth.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+	nonce, err := auth.RandomToken(16)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+	verifier := auth.NewPKCEVerifier()
+
+	authURL, err := auth.OIDCAuthorizationURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("❌ OIDC login error: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	if err := saveOIDCState(state, nonce, verifier); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorization_url": authURL,
+		"state":             state,
+	})
+}
+
+// saveOIDCState / consumeOIDCState - Bisa diganti di test supaya tidak butuh database
+var (
+	saveOIDCState    = saveOIDCStateDB
+	consumeOIDCState = consumeOIDCStateDB
+)
+
+// saveOIDCStateDB - Simpan state baru dan bersihkan state yang sudah kadaluarsa.
+// expires_at dibandingkan dengan waktu Go (bukan NOW() MySQL) karena ditulis dari time.Now().
+func saveOIDCStateDB(state, nonce, verifier string) error {
+	now := time.Now()
+	database.DB.Exec("DELETE FROM oidc_login_states WHERE expires_at < ?", now)
+
+	_, err := database.DB.Exec(`INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, expires_at)
+		VALUES (?, ?, ?, ?)`, auth.HashToken(state), nonce, verifier, now.Add(oidcStateTTL))
+	return err
+}
+
+// consumeOIDCStateDB - Ambil dan hapus state (sekali pakai)
+func consumeOIDCStateDB(state string) (nonce, verifier string, err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	stateHash := auth.HashToken(state)
+	err = tx.QueryRow(`SELECT nonce, code_verifier FROM oidc_login_states
+		WHERE state_hash = ? AND expires_at > ? FOR UPDATE`, stateHash, time.Now()).Scan(&nonce, &verifier)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := tx.Exec("DELETE FROM oidc_login_states WHERE state_hash = ?", stateHash); err != nil {
+		return "", "", err
+	}
+	return nonce, verifier, tx.Commit()
+}
+
+// OIDCCallback - Frontend mengirim code & state dari redirect IdP; hasilnya sama dengan login biasa
+func OIDCCallback(c *gin.Context) {
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	nonce, verifier, err := consumeOIDCState(req.State)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "SSO login expired or already used, please try again"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify SSO login"})
+		return
+	}
+
+	identity, err := auth.ExchangeOIDCCode(c.Request.Context(), req.Code, verifier, nonce)
+	if err == auth.ErrOIDCEmailMissing {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Your identity provider account has no verified email"})
+		return
+	}
+	if err != nil {
+		log.Printf("❌ OIDC callback error: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "SSO login failed"})
+		return
+	}
+
+	employee, err := loadAuthEmployee("e.email = ?", identity.Email)
+	if err == sql.ErrNoRows {
+		employee, err = provisionOIDCEmployee(identity)
+		if err == errProvisioningDisabled || err == errAccountInactive {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "No active LeaveMaster account for " + identity.Email})
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("❌ OIDC employee lookup error for %s: %v", identity.Email, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load employee"})
+		return
+	}
+
+	log.Printf("🔑 SSO login - Employee: %d (%s)", employee.ID, identity.Email)
+	completePrimaryLogin(c, employee)
+}
+
+var (
+	errProvisioningDisabled = errors.New("OIDC auto-provisioning is disabled")
+	errAccountInactive      = errors.New("employee account is inactive")
+)
+
+// provisionOIDCEmployee - Buat employee dari identitas IdP (kalau OIDC_AUTO_PROVISION aktif).
+// Role dan department diambil dari claims; password diisi random karena login lewat SSO.
+func provisionOIDCEmployee(identity auth.OIDCIdentity) (models.Employee, error) {
+	// Employee yang dinonaktifkan tidak boleh "hidup lagi" lewat SSO
+	var existing int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM employees WHERE email = ?", identity.Email).
+		Scan(&existing); err != nil {
+		return models.Employee{}, err
+	}
+	if existing > 0 {
+		return models.Employee{}, errAccountInactive
+	}
+	if !auth.OIDCAutoProvision() {
+		return models.Employee{}, errProvisioningDisabled
+	}
+
+	roleName := auth.OIDCRoleName(identity.Roles)
+	var roleID int
+	err := database.DB.QueryRow("SELECT id FROM roles WHERE name = ?", roleName).Scan(&roleID)
+	if err != nil {
+		return models.Employee{}, fmt.Errorf("role %q for new SSO employee: %w", roleName, err)
+	}
+	isManager := roleName == "manager" || roleName == "admin" || roleName == "super_admin"
+
+	var departmentID *int
+	if identity.Department != "" {
+		var id int
+		err := database.DB.QueryRow("SELECT id FROM departments WHERE LOWER(name) = LOWER(?) AND is_archived = FALSE", identity.Department).Scan(&id)
+		if err == nil {
+			departmentID = &id
+		} else if err != sql.ErrNoRows {
+			return models.Employee{}, err
+		} else {
+			log.Printf("⚠️ SSO department %q not found or archived, creating %s without department", identity.Department, identity.Email)
+		}
+	}
+
+	randomPassword, err := auth.RandomToken(32)
+	if err != nil {
+		return models.Employee{}, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return models.Employee{}, err
+	}
+
+	// Kode employee dari subject IdP supaya stabil dan unik
+	employeeCode := "SSO-" + strings.ToUpper(auth.HashToken(os.Getenv("OIDC_ISSUER_URL") + "|" + identity.Subject)[:10])
+
+	_, err = database.DB.Exec(`
+		INSERT INTO employees (
+			employee_id, name, email, password, position,
+			department_id, role_id, is_manager, manager_id,
+			total_leave_days, remaining_leave_days, is_active, created_at
+		) VALUES (?, ?, ?, ?, '', ?, ?, ?, NULL, 12, 12, TRUE, NOW())`,
+		employeeCode, identity.Name, identity.Email, string(hashedPassword),
+		departmentID, roleID, isManager,
+	)
+	if err != nil {
+		return models.Employee{}, err
+	}
+
+	log.Printf("✅ SSO EMPLOYEE PROVISIONED: %s (%s), Role: %s", identity.Email, employeeCode, roleName)
+	return loadAuthEmployee("e.email = ?", identity.Email)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryOIDCStates - Pengganti tabel oidc_login_states untuk test
+type memoryOIDCStates struct {
+	mutex  sync.Mutex
+	states map[string][2]string
+}
+
+func useMemoryOIDCStates(t *testing.T) *memoryOIDCStates {
+	store := &memoryOIDCStates{states: map[string][2]string{}}
+	originalSave, originalConsume := saveOIDCState, consumeOIDCState
+	saveOIDCState = func(state, nonce, verifier string) error {
+		store.mutex.Lock()
+		defer store.mutex.Unlock()
+		store.states[state] = [2]string{nonce, verifier}
+		return nil
+	}
+	consumeOIDCState = func(state string) (string, string, error) {
+		store.mutex.Lock()
+		defer store.mutex.Unlock()
+		saved, ok := store.states[state]
+		if !ok {
+			return "", "", sql.ErrNoRows
+		}
+		delete(store.states, state)
+		return saved[0], saved[1], nil
+	}
+	t.Cleanup(func() { saveOIDCState, consumeOIDCState = originalSave, originalConsume })
+	return store
+}
+
+func postOIDCCallback(body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/auth/oidc/callback", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	OIDCCallback(c)
+	return w
+}
+
+// State dipakai sekali: callback kedua dengan state yang sama ditolak walaupun yang pertama gagal
+func TestOIDCCallbackRejectsReplayedState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("OIDC_ISSUER_URL", "")
+	t.Setenv("OIDC_CLIENT_ID", "")
+	store := useMemoryOIDCStates(t)
+	if err := saveOIDCState("state-1", "nonce-1", "verifier-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Exchange gagal (OIDC tidak dikonfigurasi) setelah state diambil
+	first := postOIDCCallback(`{"code":"code-1","state":"state-1"}`)
+	if first.Code != http.StatusUnauthorized {
+		t.Fatalf("first callback: status %d, body %s", first.Code, first.Body)
+	}
+	if len(store.states) != 0 {
+		t.Fatal("state should be consumed by the first callback")
+	}
+
+	replay := postOIDCCallback(`{"code":"code-1","state":"state-1"}`)
+	if replay.Code != http.StatusBadRequest || !strings.Contains(replay.Body.String(), "already used") {
+		t.Errorf("replayed callback: status %d, body %s", replay.Code, replay.Body)
+	}
+
+	unknown := postOIDCCallback(`{"code":"code-1","state":"never-issued"}`)
+	if unknown.Code != http.StatusBadRequest {
+		t.Errorf("unknown state: status %d", unknown.Code)
+	}
+}
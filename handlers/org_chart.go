@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOrgChart - Pohon reporting line employee aktif dalam scope users:read caller, dengan headcount
+// dan jumlah yang sedang cuti (leave approved yang mencakup hari ini) per node.
+// Query: root_id (opsional, subtree mulai dari employee ini) dan depth (opsional, jumlah level
+// reports yang ditampilkan; headcount tetap menghitung seluruh subtree).
+func GetOrgChart(c *gin.Context) {
+	rootID := 0
+	if raw := c.Query("root_id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "root_id must be a number"})
+			return
+		}
+		rootID = id
+	}
+	depth := 0
+	if raw := c.Query("depth"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "depth must be a positive number"})
+			return
+		}
+		depth = value
+	}
+
+	asOf := today().Format("2006-01-02")
+	scopeClause, args := auth.ScopeFilter(c, auth.CurrentScope(c), "e")
+	rows, err := database.DB.Query(`
+		SELECT e.id, e.employee_id, e.name, e.position, e.department_id, d.name,
+			e.manager_id, DATE_FORMAT(ol.until, '%Y-%m-%d')
+		FROM employees e
+		LEFT JOIN departments d ON e.department_id = d.id
+		LEFT JOIN (
+			SELECT employee_id, MAX(end_date) AS until
+			FROM leave_requests
+			WHERE status = 'approved' AND start_date <= ? AND end_date >= ?
+			GROUP BY employee_id
+		) ol ON ol.employee_id = e.id
+		WHERE e.is_active = TRUE AND `+scopeClause+`
+		ORDER BY e.name, e.id`, append([]interface{}{asOf, asOf}, args...)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	nodes := map[int]*models.OrgChartNode{}
+	var ordered []*models.OrgChartNode
+	for rows.Next() {
+		node := &models.OrgChartNode{Reports: []*models.OrgChartNode{}}
+		var deptName, until *string
+		if err := rows.Scan(&node.ID, &node.EmployeeID, &node.Name, &node.Position,
+			&node.DepartmentID, &deptName, &node.ManagerID, &until); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if deptName != nil {
+			node.DepartmentName = *deptName
+		}
+		if until != nil {
+			node.OnLeave = true
+			node.OnLeaveUntil = *until
+		}
+		nodes[node.ID] = node
+		ordered = append(ordered, node)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	roots := buildOrgChart(nodes, ordered)
+	if rootID != 0 {
+		root, ok := nodes[rootID]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+			return
+		}
+		roots = []*models.OrgChartNode{root}
+	}
+	sort.SliceStable(roots, func(i, j int) bool { return roots[i].Name < roots[j].Name })
+
+	chart := models.OrgChart{AsOf: asOf, Roots: roots}
+	for _, root := range roots {
+		chart.Headcount += root.Headcount
+		chart.OnLeave += root.OnLeaveCount
+		if depth > 0 {
+			pruneOrgChart(root, depth)
+		}
+	}
+
+	c.JSON(http.StatusOK, chart)
+}
+
+// buildOrgChart - Susun node (urut nama) jadi pohon dan isi headcount; return root-nya.
+// Employee yang manager-nya di luar scope (atau tidak aktif) jadi root.
+func buildOrgChart(nodes map[int]*models.OrgChartNode, ordered []*models.OrgChartNode) []*models.OrgChartNode {
+	var roots []*models.OrgChartNode
+	for _, node := range ordered {
+		if node.ManagerID != nil && nodes[*node.ManagerID] != nil && *node.ManagerID != node.ID {
+			manager := nodes[*node.ManagerID]
+			manager.Reports = append(manager.Reports, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+
+	visited := map[int]bool{}
+	for _, root := range roots {
+		countOrgChart(root, visited)
+	}
+	// Cycle lama di data tidak punya root; potong di node pertama supaya tetap tampil
+	for _, node := range ordered {
+		if !visited[node.ID] {
+			detachFromManager(nodes, node)
+			roots = append(roots, node)
+			countOrgChart(node, visited)
+		}
+	}
+	return roots
+}
+
+// countOrgChart - Isi headcount dan on_leave_count node dari seluruh subtree-nya
+func countOrgChart(node *models.OrgChartNode, visited map[int]bool) {
+	visited[node.ID] = true
+	node.Headcount, node.OnLeaveCount = 1, 0
+	if node.OnLeave {
+		node.OnLeaveCount = 1
+	}
+
+	reports := node.Reports[:0]
+	for _, report := range node.Reports {
+		if visited[report.ID] {
+			continue
+		}
+		countOrgChart(report, visited)
+		node.Headcount += report.Headcount
+		node.OnLeaveCount += report.OnLeaveCount
+		reports = append(reports, report)
+	}
+	node.Reports = reports
+}
+
+func detachFromManager(nodes map[int]*models.OrgChartNode, node *models.OrgChartNode) {
+	manager := nodes[*node.ManagerID]
+	for i, report := range manager.Reports {
+		if report.ID == node.ID {
+			manager.Reports = append(manager.Reports[:i], manager.Reports[i+1:]...)
+			return
+		}
+	}
+}
+
+// pruneOrgChart - Buang reports di bawah level depth (headcount tidak berubah)
+func pruneOrgChart(node *models.OrgChartNode, depth int) {
+	if depth == 0 {
+		node.Reports = []*models.OrgChartNode{}
+		return
+	}
+	for _, report := range node.Reports {
+		pruneOrgChart(report, depth-1)
+	}
+}
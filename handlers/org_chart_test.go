@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"leavemaster/models"
+)
+
+// orgChartNodes - Node dari pasangan {id, manager_id (0 = tidak ada)}, urutan sesuai input
+func orgChartNodes(pairs [][2]int, onLeave ...int) (map[int]*models.OrgChartNode, []*models.OrgChartNode) {
+	nodes := map[int]*models.OrgChartNode{}
+	var ordered []*models.OrgChartNode
+	for _, pair := range pairs {
+		node := &models.OrgChartNode{ID: pair[0], Reports: []*models.OrgChartNode{}}
+		if pair[1] != 0 {
+			node.ManagerID = intPtr(pair[1])
+		}
+		nodes[node.ID] = node
+		ordered = append(ordered, node)
+	}
+	for _, id := range onLeave {
+		nodes[id].OnLeave = true
+	}
+	return nodes, ordered
+}
+
+func nodeIDs(nodes []*models.OrgChartNode) []int {
+	ids := []int{}
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+	}
+	return ids
+}
+
+func TestBuildOrgChartCountsSubtrees(t *testing.T) {
+	// 1 -> (2 -> 4 -> 5), 3; yang cuti: 3 dan 5
+	nodes, ordered := orgChartNodes([][2]int{{1, 0}, {2, 1}, {3, 1}, {4, 2}, {5, 4}}, 3, 5)
+
+	roots := buildOrgChart(nodes, ordered)
+	if !reflect.DeepEqual(nodeIDs(roots), []int{1}) {
+		t.Fatalf("roots = %v, want [1]", nodeIDs(roots))
+	}
+
+	want := map[int][2]int{1: {5, 2}, 2: {3, 1}, 3: {1, 1}, 4: {2, 1}, 5: {1, 1}}
+	for id, counts := range want {
+		if got := [2]int{nodes[id].Headcount, nodes[id].OnLeaveCount}; got != counts {
+			t.Errorf("node %d: headcount/on leave = %v, want %v", id, got, counts)
+		}
+	}
+	if !reflect.DeepEqual(nodeIDs(nodes[1].Reports), []int{2, 3}) {
+		t.Errorf("reports of 1 = %v", nodeIDs(nodes[1].Reports))
+	}
+}
+
+func TestBuildOrgChartRootFallbacks(t *testing.T) {
+	// 6 melapor ke manager di luar scope, 7 ke dirinya sendiri,
+	// 8 <-> 9 cycle lama dengan 10 di bawah 9
+	nodes, ordered := orgChartNodes([][2]int{{6, 42}, {7, 7}, {8, 9}, {9, 8}, {10, 9}})
+
+	roots := buildOrgChart(nodes, ordered)
+	if !reflect.DeepEqual(nodeIDs(roots), []int{6, 7, 8}) {
+		t.Fatalf("roots = %v, want [6 7 8]", nodeIDs(roots))
+	}
+	// Cycle dipotong di node pertama: 8 jadi root dengan 9 dan 10 di bawahnya
+	if !reflect.DeepEqual(nodeIDs(nodes[9].Reports), []int{10}) {
+		t.Errorf("reports of 9 = %v, want [10]", nodeIDs(nodes[9].Reports))
+	}
+	if nodes[8].Headcount != 3 || nodes[6].Headcount != 1 || nodes[7].Headcount != 1 {
+		t.Errorf("headcounts = 6:%d 7:%d 8:%d", nodes[6].Headcount, nodes[7].Headcount, nodes[8].Headcount)
+	}
+
+	// Setiap employee muncul tepat sekali di pohon
+	seen := map[int]int{}
+	var walk func(*models.OrgChartNode)
+	walk = func(node *models.OrgChartNode) {
+		seen[node.ID]++
+		for _, report := range node.Reports {
+			walk(report)
+		}
+	}
+	for _, root := range roots {
+		walk(root)
+	}
+	for id := range nodes {
+		if seen[id] != 1 {
+			t.Errorf("node %d appears %d times", id, seen[id])
+		}
+	}
+}
+
+func TestDetachFromManager(t *testing.T) {
+	nodes, _ := orgChartNodes([][2]int{{1, 0}, {2, 1}, {3, 1}, {4, 1}})
+	nodes[1].Reports = []*models.OrgChartNode{nodes[2], nodes[3], nodes[4]}
+
+	detachFromManager(nodes, nodes[3])
+	if !reflect.DeepEqual(nodeIDs(nodes[1].Reports), []int{2, 4}) {
+		t.Errorf("reports after detach = %v, want [2 4]", nodeIDs(nodes[1].Reports))
+	}
+	// Node yang tidak ada di reports tidak mengubah apa-apa
+	detachFromManager(nodes, nodes[3])
+	if len(nodes[1].Reports) != 2 {
+		t.Errorf("second detach changed reports: %v", nodeIDs(nodes[1].Reports))
+	}
+}
+
+func TestPruneOrgChartKeepsHeadcount(t *testing.T) {
+	nodes, ordered := orgChartNodes([][2]int{{1, 0}, {2, 1}, {3, 2}, {4, 3}}, 4)
+	roots := buildOrgChart(nodes, ordered)
+
+	pruneOrgChart(roots[0], 2)
+	if len(nodes[1].Reports) != 1 || len(nodes[2].Reports) != 1 || len(nodes[3].Reports) != 0 {
+		t.Errorf("depth 2 should keep two levels of reports: %v / %v / %v",
+			nodeIDs(nodes[1].Reports), nodeIDs(nodes[2].Reports), nodeIDs(nodes[3].Reports))
+	}
+	if nodes[1].Headcount != 4 || nodes[1].OnLeaveCount != 1 || nodes[3].Headcount != 2 {
+		t.Errorf("pruning must not change counts: 1=%d/%d 3=%d", nodes[1].Headcount, nodes[1].OnLeaveCount, nodes[3].Headcount)
+	}
+
+	pruneOrgChart(roots[0], 0)
+	if nodes[1].Reports == nil || len(nodes[1].Reports) != 0 {
+		t.Errorf("depth 0 should leave an empty (non-nil) reports list, got %v", nodes[1].Reports)
+	}
+}
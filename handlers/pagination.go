@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// pageCursor - Posisi terakhir di keyset pagination: nilai kolom sort dan id sebagai tie-breaker
+type pageCursor struct {
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// encodeCursor - Cursor opaque untuk client (base64 URL-safe dari JSON)
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(raw string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID <= 0 {
+		return cursor, errInvalidCursor
+	}
+	return cursor, nil
+}
+
+// keysetClause - Kondisi baris setelah cursor untuk ORDER BY sortColumn, idColumn
+// (keduanya ASC atau keduanya DESC)
+func keysetClause(sortColumn, idColumn string, descending bool, cursor pageCursor) (string, []interface{}) {
+	compare := ">"
+	if descending {
+		compare = "<"
+	}
+	clause := "(" + sortColumn + " " + compare + " ? OR (" + sortColumn + " = ? AND " + idColumn + " " + compare + " ?))"
+	return clause, []interface{}{cursor.Value, cursor.Value, cursor.ID}
+}
+
+// pageLimit - ?limit=, default 50, maksimal 200
+func pageLimit(c *gin.Context) (int, error) {
+	raw := c.Query("limit")
+	if raw == "" {
+		return defaultPageLimit, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("limit must be a positive number")
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return limit, nil
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cursors := []pageCursor{
+		{Value: "Jane Doe", ID: 42},
+		{Value: "", ID: 1},
+		{Value: "2024-05-01 09:00:00", ID: 7},
+		{Value: "Ünïcødé & \"quotes\"/+=", ID: 99},
+	}
+	for _, want := range cursors {
+		raw := encodeCursor(want)
+		got, err := decodeCursor(raw)
+		if err != nil || got != want {
+			t.Errorf("decodeCursor(encodeCursor(%+v)) = %+v, %v", want, got, err)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	invalid := []string{
+		"not base64!",
+		encodeCursorRaw(`not json`),
+		encodeCursorRaw(`{"v":"x"}`),
+		encodeCursorRaw(`{"v":"x","id":0}`),
+		encodeCursorRaw(`{"v":"x","id":-3}`),
+		encodeCursorRaw(`{"v":"x","id":"5"}`),
+	}
+	for _, raw := range invalid {
+		if _, err := decodeCursor(raw); err != errInvalidCursor {
+			t.Errorf("decodeCursor(%q): got %v, want errInvalidCursor", raw, err)
+		}
+	}
+}
+
+func encodeCursorRaw(data string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(data))
+}
+
+func TestKeysetClause(t *testing.T) {
+	cursor := pageCursor{Value: "Jane", ID: 12}
+
+	clause, args := keysetClause("e.name", "e.id", false, cursor)
+	if want := "(e.name > ? OR (e.name = ? AND e.id > ?))"; clause != want {
+		t.Errorf("ascending clause = %q, want %q", clause, want)
+	}
+	if want := []interface{}{"Jane", "Jane", 12}; !reflect.DeepEqual(args, want) {
+		t.Errorf("ascending args = %v, want %v", args, want)
+	}
+
+	clause, _ = keysetClause("e.created_at", "e.id", true, cursor)
+	if want := "(e.created_at < ? OR (e.created_at = ? AND e.id < ?))"; clause != want {
+		t.Errorf("descending clause = %q, want %q", clause, want)
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	cases := map[string]struct {
+		limit int
+		ok    bool
+	}{
+		"":      {defaultPageLimit, true},
+		"10":    {10, true},
+		"500":   {maxPageLimit, true},
+		"0":     {0, false},
+		"-1":    {0, false},
+		"lots":  {0, false},
+		"10.5":  {0, false},
+		"200":   {200, true},
+		"00007": {7, true},
+	}
+	for raw, want := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/api/employees?limit="+raw, nil)
+		limit, err := pageLimit(c)
+		if (err == nil) != want.ok || (want.ok && limit != want.limit) {
+			t.Errorf("limit=%q: got %d, %v", raw, limit, err)
+		}
+	}
+}
+
+func TestContainsPatternEscapesWildcards(t *testing.T) {
+	cases := map[string]string{
+		"jane":      "%jane%",
+		"100%":      `%100\%%`,
+		"a_b":       `%a\_b%`,
+		`dom\user`:  `%dom\\user%`,
+		`50%_off\_`: `%50\%\_off\\\_%`,
+	}
+	for q, want := range cases {
+		if got := containsPattern(q); got != want {
+			t.Errorf("containsPattern(%q) = %q, want %q", q, got, want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// forgotPasswordMessage - Response sama persis, ada atau tidak email-nya
+const forgotPasswordMessage = "If an active account exists for that email, a password reset link has been sent"
+
+// ForgotPassword - Minta link reset password lewat email
+func ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+
+	// Throttle per email dan per IP, dihitung untuk setiap permintaan (ada atau tidak
+	// akunnya) supaya 429 juga tidak membocorkan apa-apa
+	keys := auth.PasswordResetLimitKeys(email, c.ClientIP())
+	if wait := loginRetryAfter(keys); wait > 0 {
+		seconds := int(math.Ceil(wait.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Too many password reset requests. Please try again later.",
+			"retry_after": seconds,
+		})
+		return
+	}
+	recordPasswordResetRequest(keys)
+
+	// Lookup dan kirim email di background supaya waktu response juga tidak membocorkan apa-apa
+	go passwordResetSender(email, c.ClientIP())
+
+	c.JSON(http.StatusOK, gin.H{"message": forgotPasswordMessage})
+}
+
+// recordPasswordResetRequest - Hitung permintaan ke limiter; kalau limiter error, permintaan tetap dilayani
+func recordPasswordResetRequest(keys []auth.LimitKey) {
+	if loginLimiter == nil {
+		return
+	}
+	for _, key := range keys {
+		status, err := loginLimiter.RecordFailure(key)
+		if err != nil {
+			log.Printf("❌ Failed to record password reset request for %s: %v", key.Scope, err)
+			continue
+		}
+		if status.JustLocked {
+			log.Printf("🔒 Password reset requests locked - %s: %s until %s",
+				key.Scope, key.Identifier, status.LockedUntil.Format(time.RFC3339))
+		}
+	}
+}
+
+// passwordResetSender - Bisa diganti di test supaya tidak butuh database
+var passwordResetSender = sendPasswordResetLink
+
+func sendPasswordResetLink(email, ipAddress string) {
+	var employeeID int
+	var name string
+	err := database.DB.QueryRow("SELECT id, name FROM employees WHERE email = ? AND is_active = TRUE", email).
+		Scan(&employeeID, &name)
+	if err != nil {
+		return
+	}
+
+	token, err := auth.IssuePasswordResetToken(employeeID, ipAddress)
+	if err != nil {
+		log.Printf("❌ Failed to create password reset token for employee %d: %v", employeeID, err)
+		return
+	}
+
+	if err := emailService.SendPasswordResetEmail(email, name, passwordResetURL(token), auth.PasswordResetTTL()); err != nil {
+		log.Printf("❌ Failed to send password reset email to employee %d: %v", employeeID, err)
+		return
+	}
+	log.Printf("🔑 Password reset link sent - Employee: %d", employeeID)
+}
+
+// passwordResetURL - Link ke halaman reset di frontend (env FRONTEND_URL)
+func passwordResetURL(token string) string {
+	base := os.Getenv("FRONTEND_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return strings.TrimRight(base, "/") + "/reset-password?token=" + url.QueryEscape(token)
+}
+
+// ResetPassword - Set password baru dengan token reset, lalu logout semua session
+func ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash new password"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	employeeID, err := auth.ConsumePasswordResetToken(tx, req.Token)
+	if err == auth.ErrResetTokenInvalid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify reset token"})
+		return
+	}
+
+	result, err := tx.Exec("UPDATE employees SET password = ?, must_change_password = FALSE WHERE id = ? AND is_active = TRUE",
+		string(passwordHash), employeeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to commit password reset"})
+		return
+	}
+
+	// Semua access token dan refresh token lama tidak berlaku lagi
+	if err := invalidateAccessTokens(employeeID, true); err != nil {
+		log.Printf("❌ Failed to revoke sessions after password reset for employee %d: %v", employeeID, err)
+	}
+
+	log.Printf("🔑 Password reset completed - Employee: %d", employeeID)
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset. Please log in with your new password."})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"leavemaster/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useMemoryResetLimiter - Limiter in-memory dengan policy default dan sender yang hanya mencatat email
+func useMemoryResetLimiter(t *testing.T) (sent func() []string) {
+	originalLimiter, originalSender := loginLimiter, passwordResetSender
+	t.Cleanup(func() { loginLimiter, passwordResetSender = originalLimiter, originalSender })
+
+	var mutex sync.Mutex
+	var emails []string
+	loginLimiter = auth.NewMemoryLimiter(auth.DefaultThrottlePolicies())
+	passwordResetSender = func(email, ipAddress string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		emails = append(emails, email)
+	}
+	return func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string(nil), emails...)
+	}
+}
+
+func postForgotPassword(email, ip string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/password/forgot", strings.NewReader(`{"email":"`+email+`"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.RemoteAddr = ip + ":40000"
+	ForgotPassword(c)
+	return w
+}
+
+func TestForgotPasswordThrottledPerEmail(t *testing.T) {
+	sent := useMemoryResetLimiter(t)
+
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2"} {
+		if w := postForgotPassword("jane@example.com", ip); w.Code != http.StatusOK {
+			t.Fatalf("request %d: got %d, want 200", i+1, w.Code)
+		}
+	}
+	// Email sama dari IP lain tetap ditahan: yang dilindungi inbox-nya
+	w := postForgotPassword("JANE@example.com", "10.0.0.3")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("third request: got %d (Retry-After %q), want 429", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := postForgotPassword("john@example.com", "10.0.0.3"); w.Code != http.StatusOK {
+		t.Errorf("other email: got %d, want 200", w.Code)
+	}
+
+	// Pengiriman berjalan di goroutine; tunggu sampai ketiga email yang lolos tercatat
+	for i := 0; i < 100 && len(sent()) < 3; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if got := sent(); len(got) != 3 {
+		t.Errorf("expected 3 reset emails, got %v", got)
+	}
+}
+
+func TestForgotPasswordThrottledPerIP(t *testing.T) {
+	useMemoryResetLimiter(t)
+
+	policy := auth.DefaultThrottlePolicies()[auth.LimitScopeResetIP]
+	// Permintaan ke-(FreeAttempts+1) masih lolos, setelah itu harus menunggu
+	for i := 0; i <= policy.FreeAttempts; i++ {
+		email := "user" + string(rune('a'+i)) + "@example.com"
+		if w := postForgotPassword(email, "10.0.0.9"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: got %d, want 200", i+1, w.Code)
+		}
+	}
+	if w := postForgotPassword("another@example.com", "10.0.0.9"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("request over the IP allowance: got %d, want 429", w.Code)
+	}
+}
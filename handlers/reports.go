@@ -3,8 +3,11 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
+	"leavemaster/auth"
 	"leavemaster/database"
 
 	"github.com/gin-gonic/gin"
@@ -21,6 +24,8 @@ type DashboardStats struct {
 }
 
 type DepartmentStats struct {
+	DepartmentID    *int    `json:"department_id"`
+	ParentID        *int    `json:"parent_id,omitempty"`
 	Department      string  `json:"department"`
 	TotalEmployees  int     `json:"total_employees"`
 	TotalLeaves     int     `json:"total_leaves"`
@@ -44,25 +49,17 @@ type LeaveTypeDistribution struct {
 }
 
 // Get Enhanced Dashboard Stats
-// Get Enhanced Dashboard Stats - WITH ROLE-BASED DATA
+// Get Enhanced Dashboard Stats - WITH SCOPE-BASED DATA
 func GetDashboardStats(c *gin.Context) {
-	// Get user info dari context
-	userRole, _ := c.Get("role_name")
-	userDeptID, hasDept := c.Get("department_id")
+	// Filter data berdasarkan scope reports:read caller
+	userRole := auth.CurrentRole(c)
+	scope := auth.CurrentScope(c)
+	scopeClause, args := auth.ScopeFilter(c, scope, "e")
+	whereClause := " AND " + scopeClause
 
-	log.Printf("🔍 GetDashboardStats - User: Role=%s, DeptID=%v", userRole, userDeptID)
+	log.Printf("🔍 GetDashboardStats - User: Role=%s, Scope=%s", userRole, scope)
 
 	var stats DashboardStats
-	var whereClause string
-	var args []interface{}
-
-	// Filter data berdasarkan role
-	if userRole == "manager" && hasDept {
-		whereClause = " AND e.department_id = ?"
-		args = []interface{}{userDeptID}
-		log.Printf("👤 Manager - Filtering dashboard data by department_id: %v", userDeptID)
-	}
-	// Untuk admin/super_admin, tidak ada filter (lihat semua data)
 
 	// Total employees dengan filter
 	totalEmployeesQuery := "SELECT COUNT(*) FROM employees e WHERE 1=1" + whereClause
@@ -126,59 +123,32 @@ func GetDashboardStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
-// Get Enhanced Department Stats - WITH ROLE-BASED FILTERING
+// Get Enhanced Department Stats - WITH SCOPE-BASED FILTERING
+// rollup=true: angka setiap department termasuk semua sub-department di bawahnya
+// (division ikut tampil walaupun tidak punya employee langsung).
 func GetDepartmentStats(c *gin.Context) {
-	// Get user info dari context
-	userRole, _ := c.Get("role_name")
-	userDeptID, hasDept := c.Get("department_id")
-
-	log.Printf("🔍 GetDepartmentStats - User: Role=%s, DeptID=%v", userRole, userDeptID)
+	// Filter data berdasarkan scope reports:read caller
+	userRole := auth.CurrentRole(c)
+	scope := auth.CurrentScope(c)
+	scopeClause, args := auth.ScopeFilter(c, scope, "e")
+	rollup, _ := strconv.ParseBool(c.Query("rollup"))
 
-	var query string
-	var args []interface{}
+	log.Printf("🔍 GetDepartmentStats - User: Role=%s, Scope=%s, Rollup=%t", userRole, scope, rollup)
 
-	// Super Admin & Admin - lihat semua departments
-	if userRole == "super_admin" || userRole == "admin" || userRole == "superadmin" {
-		query = `
-            SELECT 
-                COALESCE(d.name, 'No Department') as department,
-                COUNT(DISTINCT e.id) as total_employees,
-                COUNT(CASE WHEN lr.status = 'approved' THEN lr.id END) as total_leaves,
-                COALESCE(AVG(CASE WHEN lr.status = 'approved' THEN lr.total_days END), 0) as avg_leave_days,
-                COALESCE((SUM(CASE WHEN lr.status = 'approved' THEN COALESCE(lr.total_days, 0) ELSE 0 END) / NULLIF(COUNT(DISTINCT e.id) * 12.0, 0)) * 100, 0) as utilization_rate,
-                COUNT(CASE WHEN lr.status = 'pending' THEN lr.id END) as pending_count
-            FROM employees e
-            LEFT JOIN departments d ON e.department_id = d.id
-            LEFT JOIN leave_requests lr ON e.id = lr.employee_id
-            GROUP BY d.id, d.name
-            ORDER BY total_leaves DESC`
-		log.Printf("👑 Admin/SuperAdmin - Viewing ALL departments")
-	} else if userRole == "manager" && hasDept {
-		// Manager - hanya lihat departmentnya sendiri
-		query = `
+	// Total mentah per department; rata-rata dan utilization dihitung setelah rollup
+	query := `
             SELECT 
+                d.id,
                 COALESCE(d.name, 'No Department') as department,
                 COUNT(DISTINCT e.id) as total_employees,
                 COUNT(CASE WHEN lr.status = 'approved' THEN lr.id END) as total_leaves,
-                COALESCE(AVG(CASE WHEN lr.status = 'approved' THEN lr.total_days END), 0) as avg_leave_days,
-                COALESCE((SUM(CASE WHEN lr.status = 'approved' THEN COALESCE(lr.total_days, 0) ELSE 0 END) / NULLIF(COUNT(DISTINCT e.id) * 12.0, 0)) * 100, 0) as utilization_rate,
+                COALESCE(SUM(CASE WHEN lr.status = 'approved' THEN lr.total_days END), 0) as approved_days,
                 COUNT(CASE WHEN lr.status = 'pending' THEN lr.id END) as pending_count
             FROM employees e
             LEFT JOIN departments d ON e.department_id = d.id
             LEFT JOIN leave_requests lr ON e.id = lr.employee_id
-            WHERE e.department_id = ?
-            GROUP BY d.id, d.name
-            ORDER BY total_leaves DESC`
-		args = []interface{}{userDeptID}
-		log.Printf("👤 Manager - Filtering by department_id: %v", userDeptID)
-	} else {
-		log.Printf("❌ Access denied - Role: %s, HasDept: %v", userRole, hasDept)
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   "Access denied",
-			"message": "You don't have permission to view department statistics",
-		})
-		return
-	}
+            WHERE ` + scopeClause + `
+            GROUP BY d.id, d.name`
 
 	rows, err := database.DB.Query(query, args...)
 	if err != nil {
@@ -188,51 +158,143 @@ func GetDepartmentStats(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	var stats []DepartmentStats
-	totalPending := 0
-
+	var totals []departmentTotals
 	for rows.Next() {
-		var s DepartmentStats
-		var avgDays *float64
-		err := rows.Scan(&s.Department, &s.TotalEmployees, &s.TotalLeaves, &avgDays, &s.UtilizationRate, &s.PendingCount)
+		var t departmentTotals
+		err := rows.Scan(&t.id, &t.stats.Department, &t.stats.TotalEmployees, &t.stats.TotalLeaves, &t.approvedDays, &t.stats.PendingCount)
 		if err != nil {
 			log.Printf("⚠️ Error scanning row: %v", err)
 			continue
 		}
-
-		if avgDays != nil {
-			s.AvgLeaveDays = *avgDays
-		} else {
-			s.AvgLeaveDays = 0
-		}
-
-		totalPending += s.PendingCount
-		stats = append(stats, s)
+		totals = append(totals, t)
 	}
 
 	if err = rows.Err(); err != nil {
 		log.Printf("⚠️ Row iteration error: %v", err)
 	}
 
+	if rollup {
+		totals, err = rollupDepartmentTotals(totals)
+		if err != nil {
+			log.Printf("❌ Department rollup failed: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve department statistics"})
+			return
+		}
+	}
+
+	stats := []DepartmentStats{}
+	totalPending := 0
+	for _, t := range totals {
+		s := t.stats
+		s.DepartmentID = t.id
+		s.ParentID = t.parentID
+		if s.TotalLeaves > 0 {
+			s.AvgLeaveDays = t.approvedDays / float64(s.TotalLeaves)
+		}
+		if s.TotalEmployees > 0 {
+			s.UtilizationRate = t.approvedDays / (float64(s.TotalEmployees) * 12.0) * 100
+		}
+		if t.id == nil || !rollup || t.parentID == nil {
+			// Pending di sub-department sudah ikut di parent-nya kalau rollup
+			totalPending += s.PendingCount
+		}
+		stats = append(stats, s)
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].TotalLeaves > stats[j].TotalLeaves })
+
 	log.Printf("✅ %s retrieved %d department stats with %d total pending requests", userRole, len(stats), totalPending)
 	c.JSON(http.StatusOK, stats)
 }
 
+// departmentTotals - Angka mentah satu department sebelum dihitung jadi DepartmentStats
+type departmentTotals struct {
+	id           *int
+	parentID     *int
+	stats        DepartmentStats
+	approvedDays float64
+}
+
+// rollupDepartmentTotals - Tambahkan angka setiap department ke semua ancestor-nya. Ancestor
+// tanpa employee dalam scope ikut muncul; department yang di-archive tetap dihitung.
+func rollupDepartmentTotals(totals []departmentTotals) ([]departmentTotals, error) {
+	rows, err := database.DB.Query("SELECT id, name, parent_id FROM departments")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	departments := map[int]departmentNode{}
+	for rows.Next() {
+		var id int
+		var dept departmentNode
+		if err := rows.Scan(&id, &dept.name, &dept.parentID); err != nil {
+			return nil, err
+		}
+		departments[id] = dept
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return rollupTotals(totals, departments), nil
+}
+
+// departmentNode - Nama dan parent satu department untuk rollup
+type departmentNode struct {
+	name     string
+	parentID *int
+}
+
+// rollupTotals - Rollup totals ke ancestor berdasarkan hierarki departments
+func rollupTotals(totals []departmentTotals, departments map[int]departmentNode) []departmentTotals {
+	rolled := map[int]*departmentTotals{}
+	var order []int
+	var result []departmentTotals
+	for _, t := range totals {
+		if t.id == nil {
+			result = append(result, t)
+			continue
+		}
+		// seen menjaga dari cycle parent_id di data lama
+		seen := map[int]bool{}
+		for id := t.id; id != nil && !seen[*id]; id = departments[*id].parentID {
+			seen[*id] = true
+			entry, ok := rolled[*id]
+			if !ok {
+				deptID := *id
+				entry = &departmentTotals{id: &deptID, parentID: departments[deptID].parentID}
+				entry.stats.Department = departments[deptID].name
+				rolled[deptID] = entry
+				order = append(order, deptID)
+			}
+			entry.stats.TotalEmployees += t.stats.TotalEmployees
+			entry.stats.TotalLeaves += t.stats.TotalLeaves
+			entry.stats.PendingCount += t.stats.PendingCount
+			entry.approvedDays += t.approvedDays
+		}
+	}
+	for _, id := range order {
+		result = append(result, *rolled[id])
+	}
+	return result
+}
+
 // Get Monthly Trends with Details
 func GetMonthlyTrends(c *gin.Context) {
+	scopeClause, args := auth.ScopeFilter(c, auth.CurrentScope(c), "e")
 	query := `
 		SELECT 
-			DATE_FORMAT(created_at, '%Y-%m') as month,
+			DATE_FORMAT(lr.created_at, '%Y-%m') as month,
 			COUNT(*) as total_leaves,
-			SUM(CASE WHEN status = 'approved' THEN 1 ELSE 0 END) as approved,
-			SUM(CASE WHEN status = 'pending' THEN 1 ELSE 0 END) as pending,
-			SUM(CASE WHEN status = 'rejected' THEN 1 ELSE 0 END) as rejected
-		FROM leave_requests 
-		WHERE created_at >= DATE_SUB(NOW(), INTERVAL 12 MONTH)
-		GROUP BY DATE_FORMAT(created_at, '%Y-%m')
+			SUM(CASE WHEN lr.status = 'approved' THEN 1 ELSE 0 END) as approved,
+			SUM(CASE WHEN lr.status = 'pending' THEN 1 ELSE 0 END) as pending,
+			SUM(CASE WHEN lr.status = 'rejected' THEN 1 ELSE 0 END) as rejected
+		FROM leave_requests lr
+		JOIN employees e ON lr.employee_id = e.id
+		WHERE lr.created_at >= DATE_SUB(NOW(), INTERVAL 12 MONTH) AND ` + scopeClause + `
+		GROUP BY DATE_FORMAT(lr.created_at, '%Y-%m')
 		ORDER BY month DESC`
 
-	rows, err := database.DB.Query(query)
+	rows, err := database.DB.Query(query, args...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -259,16 +321,26 @@ func GetMonthlyTrends(c *gin.Context) {
 
 // Get Leave Type Distribution
 func GetLeaveTypeDistribution(c *gin.Context) {
+	scopeClause, args := auth.ScopeFilter(c, auth.CurrentScope(c), "e")
+	// Leave type yang disembunyikan policy dihitung sebagai "out_of_office"
+	viewer, err := newLeaveViewer(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	leaveType, typeArgs := viewer.leaveTypeSQL("lr.leave_type", "p")
 	query := `
 		SELECT 
-			leave_type,
+			` + leaveType + ` as visible_type,
 			COUNT(*) as count
-		FROM leave_requests 
-		WHERE status = 'approved'
-		GROUP BY leave_type
+		FROM leave_requests lr
+		JOIN employees e ON lr.employee_id = e.id
+		` + leavePolicyJoin + `
+		WHERE lr.status = 'approved' AND ` + scopeClause + `
+		GROUP BY visible_type
 		ORDER BY count DESC`
 
-	rows, err := database.DB.Query(query)
+	rows, err := database.DB.Query(query, append(typeArgs, args...)...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -281,6 +353,8 @@ func GetLeaveTypeDistribution(c *gin.Context) {
 		"sick":     "#e74c3c",
 		"personal": "#9b59b6",
 		"other":    "#f39c12",
+
+		leaveTypeOutOfOffice: "#95a5a6",
 	}
 
 	for rows.Next() {
@@ -297,38 +371,26 @@ func GetLeaveTypeDistribution(c *gin.Context) {
 }
 
 // Get Recent Activities
-// Get Recent Activities - WITH ROLE-BASED FILTERING
+// Get Recent Activities - WITH SCOPE-BASED FILTERING
 func GetRecentActivities(c *gin.Context) {
-	// Get user info dari context
-	userRole, _ := c.Get("role_name")
-	userDeptID, hasDept := c.Get("department_id")
+	// Filter data berdasarkan scope reports:read caller
+	userRole := auth.CurrentRole(c)
+	scope := auth.CurrentScope(c)
+	scopeClause, args := auth.ScopeFilter(c, scope, "e")
 
-	log.Printf("🔍 GetRecentActivities - User: Role=%s, DeptID=%v", userRole, userDeptID)
+	log.Printf("🔍 GetRecentActivities - User: Role=%s, Scope=%s", userRole, scope)
 
-	var query string
-	var args []interface{}
+	viewer, err := newLeaveViewer(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	leaveType, typeArgs := viewer.leaveTypeSQL("lr.leave_type", "p")
 
-	if userRole == "super_admin" || userRole == "admin" || userRole == "superadmin" {
-		query = `
-            SELECT 
-                e.name as employee_name,
-                lr.leave_type,
-                lr.status,
-                lr.created_at,
-                lr.start_date,
-                lr.end_date,
-                COALESCE(m.name, 'System') as action_by
-            FROM leave_requests lr
-            JOIN employees e ON lr.employee_id = e.id
-            LEFT JOIN employees m ON lr.approved_by = m.id
-            ORDER BY lr.created_at DESC
-            LIMIT 10`
-		log.Printf("👑 Admin/SuperAdmin - Viewing ALL activities")
-	} else if userRole == "manager" && hasDept {
-		query = `
+	query := `
             SELECT 
                 e.name as employee_name,
-                lr.leave_type,
+                ` + leaveType + `,
                 lr.status,
                 lr.created_at,
                 lr.start_date,
@@ -337,21 +399,12 @@ func GetRecentActivities(c *gin.Context) {
             FROM leave_requests lr
             JOIN employees e ON lr.employee_id = e.id
             LEFT JOIN employees m ON lr.approved_by = m.id
-            WHERE e.department_id = ?
+            ` + leavePolicyJoin + `
+            WHERE ` + scopeClause + `
             ORDER BY lr.created_at DESC
             LIMIT 10`
-		args = []interface{}{userDeptID}
-		log.Printf("👤 Manager - Filtering activities by department_id: %v", userDeptID)
-	} else {
-		log.Printf("❌ Access denied - Role: %s, HasDept: %v", userRole, hasDept)
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   "Access denied",
-			"message": "You don't have permission to view recent activities",
-		})
-		return
-	}
 
-	rows, err := database.DB.Query(query, args...)
+	rows, err := database.DB.Query(query, append(typeArgs, args...)...)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
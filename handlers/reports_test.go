@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRollupTotals(t *testing.T) {
+	// 1 Company -> 2 Engineering -> 3 Platform, 1 -> 4 Sales, 5 Empty di bawah 2 (tanpa employee),
+	// 6 <-> 7 cycle parent_id di data lama
+	departments := map[int]departmentNode{
+		1: {name: "Company"},
+		2: {name: "Engineering", parentID: intPtr(1)},
+		3: {name: "Platform", parentID: intPtr(2)},
+		4: {name: "Sales", parentID: intPtr(1)},
+		5: {name: "Empty", parentID: intPtr(2)},
+		6: {name: "Loop A", parentID: intPtr(7)},
+		7: {name: "Loop B", parentID: intPtr(6)},
+	}
+	totals := func(id *int, employees, leaves, pending int, days float64) departmentTotals {
+		t := departmentTotals{id: id, approvedDays: days}
+		t.stats.TotalEmployees, t.stats.TotalLeaves, t.stats.PendingCount = employees, leaves, pending
+		return t
+	}
+	input := []departmentTotals{
+		totals(intPtr(3), 5, 4, 1, 10),
+		totals(intPtr(4), 3, 2, 2, 5),
+		totals(intPtr(2), 2, 1, 0, 3),
+		totals(nil, 1, 1, 1, 1),
+		totals(intPtr(6), 1, 1, 0, 2),
+	}
+
+	result := rollupTotals(input, departments)
+
+	type row struct {
+		id, parent                 int
+		name                       string
+		employees, leaves, pending int
+		days                       float64
+	}
+	var got []row
+	for _, r := range result {
+		entry := row{name: r.stats.Department, employees: r.stats.TotalEmployees, leaves: r.stats.TotalLeaves,
+			pending: r.stats.PendingCount, days: r.approvedDays}
+		if r.id != nil {
+			entry.id = *r.id
+		}
+		if r.parentID != nil {
+			entry.parent = *r.parentID
+		}
+		got = append(got, entry)
+	}
+	want := []row{
+		{0, 0, "", 1, 1, 1, 1},
+		{3, 2, "Platform", 5, 4, 1, 10},
+		{2, 1, "Engineering", 7, 5, 1, 13},
+		{1, 0, "Company", 10, 7, 3, 18},
+		{4, 1, "Sales", 3, 2, 2, 5},
+		{6, 7, "Loop A", 1, 1, 0, 2},
+		{7, 6, "Loop B", 1, 1, 0, 2},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rollup:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestRollupTotalsUnknownDepartment(t *testing.T) {
+	// Department yang tidak ada di tabel (mis. dihapus) tetap dihitung sebagai root tanpa nama
+	result := rollupTotals([]departmentTotals{{id: intPtr(9), approvedDays: 4}}, map[int]departmentNode{})
+	if len(result) != 1 || *result[0].id != 9 || result[0].parentID != nil || result[0].approvedDays != 4 {
+		t.Errorf("got %+v", result)
+	}
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/models"
+	"leavemaster/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// roleNamePattern - Nama role dipakai di token dan perbandingan role, jadi dibatasi ke slug lowercase
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+// reservedRoleNames - Tidak bisa dibuat, diubah atau dihapus lewat API
+var reservedRoleNames = map[string]bool{
+	"super_admin":           true,
+	auth.RoleServiceAccount: true,
+}
+
+const roleColumns = `r.id, r.name, COALESCE(r.description, ''), COALESCE(r.permissions, ''), r.created_at,
+	(SELECT COUNT(*) FROM employees e WHERE e.role_id = r.id)`
+
+func scanRole(row rowScanner) (models.Role, error) {
+	var role models.Role
+	var permissionsJSON string
+	err := row.Scan(&role.ID, &role.Name, &role.Description, &permissionsJSON, &role.CreatedAt, &role.EmployeeCount)
+	if err != nil {
+		return role, err
+	}
+	role.Permissions, err = auth.ParsePermissions(permissionsJSON)
+	if err != nil {
+		log.Printf("⚠️ Role %s has invalid permissions JSON: %v", role.Name, err)
+		role.Permissions = []string{}
+	}
+	return role, nil
+}
+
+// validateRolePermissions - Hanya permission yang dikenal; "*" khusus super_admin
+func validateRolePermissions(permissions []string) ([]string, string) {
+	normalized, err := auth.NormalizePermissions(permissions)
+	if err != nil {
+		return nil, "Unknown permission or scope. Allowed: " + strings.Join(auth.KnownPermissions, ", ") +
+			", optionally suffixed with @" + strings.Join(auth.KnownScopes, ", @")
+	}
+	for _, permission := range normalized {
+		if permission == auth.PermissionAll {
+			return nil, "The wildcard permission is reserved for super_admin"
+		}
+	}
+	return normalized, ""
+}
+
+// encodePermissions - Format yang disimpan di roles.permissions
+func encodePermissions(permissions []string) string {
+	raw, _ := json.Marshal(permissions)
+	return string(raw)
+}
+
+// GetRoles - Semua role dengan permission yang sudah di-parse
+func GetRoles(c *gin.Context) {
+	rows, err := database.DB.Query("SELECT " + roleColumns + " FROM roles r ORDER BY r.name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	roles := []models.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		roles = append(roles, role)
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetPermissions - Daftar permission dan scope yang bisa diberikan ke role
+func GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"permissions": auth.KnownPermissions, "scopes": auth.KnownScopes})
+}
+
+// CreateRole - Role baru dengan set permission
+func CreateRole(c *gin.Context) {
+	var req models.CreateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !roleNamePattern.MatchString(req.Name) || reservedRoleNames[req.Name] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name must be a lowercase identifier (a-z, 0-9, _) and not reserved"})
+		return
+	}
+	permissions, problem := validateRolePermissions(req.Permissions)
+	if problem != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+		return
+	}
+
+	var exists int
+	database.DB.QueryRow("SELECT COUNT(*) FROM roles WHERE LOWER(name) = ?", req.Name).Scan(&exists)
+	if exists > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role name already exists"})
+		return
+	}
+
+	result, err := database.DB.Exec("INSERT INTO roles (name, description, permissions) VALUES (?, ?, ?)",
+		req.Name, req.Description, encodePermissions(permissions))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	id, _ := result.LastInsertId()
+	auth.InvalidatePermissionCache()
+
+	actorID := auth.CurrentEmployeeID(c)
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    "role_created",
+		ActorID:   &actorID,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"role_id": id, "name": req.Name, "permissions": permissions},
+	})
+	log.Printf("🛡️ Role created - %s %v by employee %d", req.Name, permissions, actorID)
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Role created successfully", "id": id})
+}
+
+// loadEditableRole - Role untuk update/delete; super_admin tidak bisa diubah lewat API
+func loadEditableRole(c *gin.Context) (models.Role, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return models.Role{}, false
+	}
+
+	role, err := scanRole(database.DB.QueryRow("SELECT "+roleColumns+" FROM roles r WHERE r.id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return role, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return role, false
+	}
+	if reservedRoleNames[role.Name] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "The " + role.Name + " role cannot be modified"})
+		return role, false
+	}
+	return role, true
+}
+
+// UpdateRole - Ubah deskripsi dan/atau permission role. Berlaku di request berikutnya
+// (cache di-invalidate), token employee tidak perlu diterbitkan ulang.
+func UpdateRole(c *gin.Context) {
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, ok := loadEditableRole(c)
+	if !ok {
+		return
+	}
+
+	description := role.Description
+	if req.Description != nil {
+		description = *req.Description
+	}
+	permissions := role.Permissions
+	if req.Permissions != nil {
+		var problem string
+		permissions, problem = validateRolePermissions(req.Permissions)
+		if problem != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": problem})
+			return
+		}
+	}
+
+	_, err := database.DB.Exec("UPDATE roles SET description = ?, permissions = ? WHERE id = ?",
+		description, encodePermissions(permissions), role.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auth.InvalidatePermissionCache()
+
+	actorID := auth.CurrentEmployeeID(c)
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    "role_updated",
+		ActorID:   &actorID,
+		IPAddress: c.ClientIP(),
+		Details: map[string]interface{}{
+			"role_id":         role.ID,
+			"name":            role.Name,
+			"old_permissions": role.Permissions,
+			"new_permissions": permissions,
+		},
+	})
+	log.Printf("🛡️ Role updated - %s %v by employee %d", role.Name, permissions, actorID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated successfully"})
+}
+
+// DeleteRole - Hanya role yang tidak dipakai employee mana pun
+func DeleteRole(c *gin.Context) {
+	role, ok := loadEditableRole(c)
+	if !ok {
+		return
+	}
+	if role.EmployeeCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "Role is still assigned to employees, reassign them first",
+			"employee_count": role.EmployeeCount,
+		})
+		return
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM roles WHERE id = ?", role.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	auth.InvalidatePermissionCache()
+
+	actorID := auth.CurrentEmployeeID(c)
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    "role_deleted",
+		ActorID:   &actorID,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"role_id": role.ID, "name": role.Name, "permissions": role.Permissions},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
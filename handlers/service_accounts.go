@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/models"
+	"leavemaster/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serviceAccountScopes - Scope yang boleh diberikan ke API key. Hanya read-only:
+// service account tidak punya identitas employee untuk aksi tulis.
+var serviceAccountScopes = map[string]bool{
+	"reports:read": true,
+	"users:read":   true,
+}
+
+const serviceAccountColumns = `id, name, COALESCE(description, ''), scopes, key_prefix, created_by,
+	created_at, rotated_at, last_used_at, revoked_at`
+
+func scanServiceAccount(row rowScanner) (models.ServiceAccount, error) {
+	var account models.ServiceAccount
+	var scopes string
+	err := row.Scan(&account.ID, &account.Name, &account.Description, &scopes, &account.KeyPrefix,
+		&account.CreatedBy, &account.CreatedAt, &account.RotatedAt, &account.LastUsedAt, &account.RevokedAt)
+	if err != nil {
+		return account, err
+	}
+	if err := json.Unmarshal([]byte(scopes), &account.Scopes); err != nil {
+		return account, err
+	}
+	return account, nil
+}
+
+// GetServiceAccounts - Daftar service account (termasuk yang sudah di-revoke)
+func GetServiceAccounts(c *gin.Context) {
+	rows, err := database.DB.Query("SELECT " + serviceAccountColumns + " FROM service_accounts ORDER BY name")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	accounts := []models.ServiceAccount{}
+	for rows.Next() {
+		account, err := scanServiceAccount(rows)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		accounts = append(accounts, account)
+	}
+
+	c.JSON(http.StatusOK, accounts)
+}
+
+// CreateServiceAccount - Buat service account; API key hanya ditampilkan sekali di response ini
+func CreateServiceAccount(c *gin.Context) {
+	var req models.CreateServiceAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !serviceAccountScopes[scope] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Scope not allowed for service accounts: " + scope})
+			return
+		}
+	}
+	scopes, _ := json.Marshal(req.Scopes)
+
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	createdBy := auth.CurrentEmployeeID(c)
+	result, err := database.DB.Exec(`INSERT INTO service_accounts (name, description, scopes, key_prefix, key_hash, created_by)
+		VALUES (?, ?, ?, ?, ?, ?)`, req.Name, req.Description, string(scopes), prefix, auth.HashToken(key), createdBy)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Service account name already exists"})
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    "service_account_created",
+		ActorID:   &createdBy,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"service_account_id": id, "name": req.Name, "scopes": req.Scopes},
+	})
+	log.Printf("🤖 Service account created - %s (%s) by employee %d", req.Name, prefix, createdBy)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Service account created. Store the API key now - it will not be shown again.",
+		"id":      id,
+		"api_key": key,
+	})
+}
+
+// RotateServiceAccountKey - Ganti API key; key lama langsung tidak berlaku
+func RotateServiceAccountKey(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID"})
+		return
+	}
+
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+
+	result, err := database.DB.Exec(`UPDATE service_accounts SET key_prefix = ?, key_hash = ?, rotated_at = NOW()
+		WHERE id = ? AND revoked_at IS NULL`, prefix, auth.HashToken(key), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Active service account not found"})
+		return
+	}
+
+	actorID := auth.CurrentEmployeeID(c)
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    "service_account_rotated",
+		ActorID:   &actorID,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"service_account_id": id, "key_prefix": prefix},
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API key rotated. Store the new key now - it will not be shown again.",
+		"api_key": key,
+	})
+}
+
+// RevokeServiceAccount - Nonaktifkan service account dan API key-nya (permanen)
+func RevokeServiceAccount(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid service account ID"})
+		return
+	}
+
+	account, err := scanServiceAccount(database.DB.QueryRow(
+		"SELECT "+serviceAccountColumns+" FROM service_accounts WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if account.RevokedAt != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Service account already revoked"})
+		return
+	}
+
+	if _, err := database.DB.Exec("UPDATE service_accounts SET revoked_at = NOW() WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	actorID := auth.CurrentEmployeeID(c)
+	services.RecordAuditEvent(services.AuditEvent{
+		Action:    "service_account_revoked",
+		ActorID:   &actorID,
+		IPAddress: c.ClientIP(),
+		Details:   map[string]interface{}{"service_account_id": id, "name": account.Name},
+	})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Service account revoked"})
+}
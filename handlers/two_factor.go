@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+)
+
+// needsTwoFactorSetup - Role wajib 2FA tapi employee belum enroll
+func needsTwoFactorSetup(employee models.Employee) bool {
+	return !employee.TwoFactorEnabled && auth.TwoFactorRequired(employee.RoleName)
+}
+
+// verifySecondFactor - Terima kode TOTP (sekali pakai per time step) atau recovery code.
+// Return "totp", "recovery_code" atau "" kalau kode salah.
+func verifySecondFactor(employeeID int, code string) (string, error) {
+	var secret sql.NullString
+	var enabled bool
+	err := database.DB.QueryRow("SELECT totp_secret, totp_enabled FROM employees WHERE id = ?", employeeID).
+		Scan(&secret, &enabled)
+	if err != nil {
+		return "", err
+	}
+	if !enabled || !secret.Valid {
+		return "", nil
+	}
+
+	if step, ok := auth.ValidateTOTP(secret.String, code, time.Now()); ok {
+		// Kode yang sama (atau lebih lama) tidak boleh dipakai ulang
+		result, err := database.DB.Exec(`UPDATE employees SET totp_last_step = ?
+			WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)`, step, employeeID, step)
+		if err != nil {
+			return "", err
+		}
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return "", nil
+		}
+		return "totp", nil
+	}
+
+	result, err := database.DB.Exec(`UPDATE two_factor_recovery_codes SET used_at = NOW()
+		WHERE employee_id = ? AND code_hash = ? AND used_at IS NULL`, employeeID, auth.HashRecoveryCode(code))
+	if err != nil {
+		return "", err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return "", nil
+	}
+	return "recovery_code", nil
+}
+
+// replaceRecoveryCodes - Hapus recovery code lama dan simpan hash dari yang baru
+func replaceRecoveryCodes(tx *sql.Tx, employeeID int) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM two_factor_recovery_codes WHERE employee_id = ?", employeeID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		_, err := tx.Exec("INSERT INTO two_factor_recovery_codes (employee_id, code_hash) VALUES (?, ?)",
+			employeeID, auth.HashRecoveryCode(code))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// LoginTwoFactor - Langkah kedua login: tukar challenge token + kode dengan token biasa
+func LoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	employeeID, err := auth.ParseChallengeToken(req.ChallengeToken, auth.PurposeTwoFactor)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login challenge expired, please log in again"})
+		return
+	}
+
+	employee, err := loadAuthEmployee("e.id = ?", employeeID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials or account inactive"})
+		return
+	}
+
+	// Kode 2FA yang salah dihitung di limiter yang sama dengan password
+	limitKeys := loginLimitKeys(c, employee.Email)
+	if wait := loginRetryAfter(limitKeys); wait > 0 {
+		rejectThrottledLogin(c, wait)
+		return
+	}
+
+	method, err := verifySecondFactor(employee.ID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if method == "" {
+		recordLoginFailure(c, limitKeys, &employee.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+	resetLoginFailures(limitKeys)
+
+	if method == "recovery_code" {
+		log.Printf("🔑 Recovery code used for login - Employee: %d", employee.ID)
+	}
+
+	response, err := startSession(c, employee)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetTwoFactorStatus - Status 2FA user yang login
+func GetTwoFactorStatus(c *gin.Context) {
+	employeeID := auth.CurrentEmployeeID(c)
+
+	var enabled bool
+	var roleName sql.NullString
+	err := database.DB.QueryRow(`SELECT e.totp_enabled, r.name FROM employees e
+		LEFT JOIN roles r ON e.role_id = r.id WHERE e.id = ?`, employeeID).Scan(&enabled, &roleName)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+
+	var remaining int
+	database.DB.QueryRow(`SELECT COUNT(*) FROM two_factor_recovery_codes
+		WHERE employee_id = ? AND used_at IS NULL`, employeeID).Scan(&remaining)
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  enabled,
+		"required":                 auth.TwoFactorRequired(roleName.String),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// EnrollTwoFactor - Buat secret baru; 2FA baru aktif setelah diverifikasi
+func EnrollTwoFactor(c *gin.Context) {
+	employeeID := auth.CurrentEmployeeID(c)
+
+	var email string
+	var enabled bool
+	err := database.DB.QueryRow("SELECT email, totp_enabled FROM employees WHERE id = ?", employeeID).
+		Scan(&email, &enabled)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	_, err = database.DB.Exec("UPDATE employees SET totp_secret = ?, totp_last_step = NULL WHERE id = ?",
+		secret, employeeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save secret"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(email, secret),
+		"message":     "Scan the QR code, then confirm with a code at /api/2fa/verify",
+	})
+}
+
+// VerifyTwoFactor - Konfirmasi enrollment dengan kode pertama. Aktifkan 2FA, buat recovery
+// code, akhiri semua session lama dan berikan session baru untuk device ini.
+func VerifyTwoFactor(c *gin.Context) {
+	employeeID := auth.CurrentEmployeeID(c)
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var secret sql.NullString
+	var enabled bool
+	err := database.DB.QueryRow("SELECT totp_secret, totp_enabled FROM employees WHERE id = ?", employeeID).
+		Scan(&secret, &enabled)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if !secret.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Start enrollment at /api/2fa/enroll first"})
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(secret.String, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE employees SET totp_enabled = TRUE, totp_last_step = ? WHERE id = ?", step, employeeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	codes, err := replaceRecoveryCodes(tx, employeeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recovery codes"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	// Session yang login tanpa 2FA diakhiri
+	if err := invalidateAccessTokens(employeeID, true); err != nil {
+		log.Printf("❌ Failed to revoke sessions after enabling 2FA for employee %d: %v", employeeID, err)
+	}
+
+	employee, err := loadAuthEmployee("e.id = ?", employeeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load employee"})
+		return
+	}
+	response, err := startSession(c, employee)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+		return
+	}
+
+	log.Printf("🔐 2FA enabled - Employee: %d", employeeID)
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled. Store these recovery codes somewhere safe - they are shown only once.",
+		"recovery_codes": codes,
+		"session":        response,
+	})
+}
+
+// DisableTwoFactor - Matikan 2FA (butuh kode valid); tidak boleh untuk role yang wajib 2FA
+func DisableTwoFactor(c *gin.Context) {
+	employeeID := auth.CurrentEmployeeID(c)
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if auth.TwoFactorRequired(auth.CurrentRole(c)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is mandatory for your role"})
+		return
+	}
+
+	method, err := verifySecondFactor(employeeID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if method == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE employees SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = NULL
+		WHERE id = ?`, employeeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM two_factor_recovery_codes WHERE employee_id = ?", employeeID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	log.Printf("🔓 2FA disabled - Employee: %d", employeeID)
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes - Ganti semua recovery code (butuh kode valid)
+func RegenerateRecoveryCodes(c *gin.Context) {
+	employeeID := auth.CurrentEmployeeID(c)
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	method, err := verifySecondFactor(employeeID, req.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify code"})
+		return
+	}
+	if method == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
+		return
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, employeeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create recovery codes"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
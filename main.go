@@ -1,9 +1,11 @@
 package main
 
 import (
+	"leavemaster/auth"
 	"leavemaster/database"
 	"leavemaster/handlers"
 	"leavemaster/middleware"
+	"leavemaster/services"
 	"leavemaster/websocket"
 	"log"
 	"net/http"
@@ -28,14 +30,39 @@ func main() {
 	// Load environment variables
 	godotenv.Load()
 
+	// Load JWT signing/verification keys
+	if err := auth.LoadKeys(); err != nil {
+		log.Fatalf("❌ Failed to load JWT keys: %v", err)
+	}
+
 	// Initialize database
 	database.InitDB()
 
+	// Login throttling (in-memory atau database, lihat LOGIN_LIMITER)
+	handlers.SetLoginLimiter(auth.NewLoginLimiter())
+
+	// Authenticator per domain email (AUTH_CHAIN) dan sync direktori LDAP opsional
+	handlers.SetAuthenticatorChain(auth.NewAuthenticatorChain())
+	services.StartDirectorySync()
+
 	// Start WebSocket hub
 	go websocket.HubInstance.Run()
 	log.Println("🚀 WebSocket Hub Started!")
 
-	// Create router
+	r := setupRouter()
+
+	// Start server
+	log.Println("🚀 Server starting on :8080")
+	log.Println("🔌 WebSocket available at: ws://localhost:8080/ws (WITH AUTH)")
+	log.Println("🏥 Health check at: http://localhost:8080/health")
+	log.Println("🔐 Role-based access control: ENABLED")
+	log.Println("🔑 Permission-based access: ENABLED")
+	log.Println("🌐 WebSocket authentication: ENABLED")
+	r.Run(":8080")
+}
+
+// setupRouter - Semua route dan middleware; dipisah dari main() supaya bisa dites
+func setupRouter() *gin.Engine {
 	r := gin.Default()
 
 	// CORS configuration - VERY PERMISSIVE FOR DEVELOPMENT
@@ -52,49 +79,117 @@ func main() {
 
 	// Public routes
 	r.POST("/api/login", handlers.Login)
+	r.POST("/api/login/2fa", handlers.LoginTwoFactor)
+	r.GET("/api/auth/oidc/login", handlers.OIDCLogin)
+	r.POST("/api/auth/oidc/callback", handlers.OIDCCallback)
+	r.POST("/api/token/refresh", handlers.RefreshToken)
+	r.POST("/api/logout", handlers.Logout)
+	r.POST("/api/password/forgot", handlers.ForgotPassword)
+	r.POST("/api/password/reset", handlers.ResetPassword)
 
 	// Protected routes
 	api := r.Group("/api")
 	api.Use(middleware.AuthMiddleware()) // Auth middleware untuk semua API routes
 	{
 		// 🔐 PUBLIC ROUTES - Untuk semua role yang login
-		api.GET("/profile", handlers.GetProfile)
-		api.PUT("/profile", handlers.UpdateProfile)
-		api.PUT("/change-password", handlers.ChangePassword)
+		api.GET("/profile", middleware.EmployeeOnly(), handlers.GetProfile)
+		api.PUT("/profile", middleware.EmployeeOnly(), handlers.UpdateProfile)
+		api.PUT("/change-password", middleware.EmployeeOnly(), handlers.ChangePassword)
+
+		// 🔐 TWO-FACTOR AUTH ROUTES - Untuk user yang login (juga saat setup 2FA wajib)
+		api.GET("/2fa/status", middleware.EmployeeOnly(), handlers.GetTwoFactorStatus)
+		api.POST("/2fa/enroll", middleware.EmployeeOnly(), handlers.EnrollTwoFactor)
+		api.POST("/2fa/verify", middleware.EmployeeOnly(), handlers.VerifyTwoFactor)
+		api.POST("/2fa/disable", middleware.EmployeeOnly(), handlers.DisableTwoFactor)
+		api.POST("/2fa/recovery-codes", middleware.EmployeeOnly(), handlers.RegenerateRecoveryCodes)
 
 		// 📋 LEAVE ROUTES
 		api.POST("/leave", middleware.PermissionMiddleware("leave:write"), handlers.CreateLeaveRequest)
 		api.GET("/leave/my-requests", middleware.PermissionMiddleware("leave:read"), handlers.GetMyLeaveRequests)
 		api.GET("/leave/pending", middleware.PermissionMiddleware("leave:approve"), handlers.GetPendingLeaveRequests)
 		api.PUT("/leave/:id/status", middleware.PermissionMiddleware("leave:approve"), handlers.UpdateLeaveStatus)
+		api.PUT("/leave/:id", middleware.PermissionMiddleware("leave:write"), handlers.UpdateLeaveRequest)
+		api.GET("/leave/:id/history", middleware.EmployeeOnly(), handlers.GetLeaveRequestHistory)
+		api.GET("/leave/forecast", middleware.EmployeeOnly(), handlers.GetLeaveForecast)
+		api.GET("/leave/amendments/pending", middleware.PermissionMiddleware("leave:approve"), handlers.GetPendingLeaveAmendments)
+		api.PUT("/leave/amendments/:id/status", middleware.PermissionMiddleware("leave:approve"), handlers.UpdateLeaveAmendmentStatus)
+
+		// 📜 LEAVE POLICIES - Semua bisa lihat, update butuh users:write
+		api.GET("/leave/policies", middleware.EmployeeOnly(), handlers.GetLeavePolicies)
+		api.PUT("/leave/policies/:type", middleware.PermissionMiddleware("users:write"), handlers.UpsertLeavePolicy)
+
+		// 🤖 AUTO-APPROVAL RULES - Butuh users:write permission
+		api.GET("/leave/auto-approval-rules", middleware.PermissionMiddleware("users:write"), handlers.GetAutoApprovalRules)
+		api.POST("/leave/auto-approval-rules", middleware.PermissionMiddleware("users:write"), handlers.CreateAutoApprovalRule)
+		api.PUT("/leave/auto-approval-rules/:id", middleware.PermissionMiddleware("users:write"), handlers.UpdateAutoApprovalRule)
+		api.DELETE("/leave/auto-approval-rules/:id", middleware.PermissionMiddleware("users:write"), handlers.DeleteAutoApprovalRule)
 
 		// 📅 CALENDAR ROUTES
-		api.GET("/calendar/events", handlers.GetCalendarEvents) // Semua bisa lihat calendar
-		api.GET("/calendar/team", middleware.RoleMiddleware("super_admin", "admin", "manager"), handlers.GetTeamLeaveCalendar)
+		api.GET("/calendar/events", middleware.EmployeeOnly(), handlers.GetCalendarEvents) // Semua bisa lihat calendar
+		api.GET("/calendar/team", middleware.PermissionMiddleware("calendar:team"), handlers.GetTeamLeaveCalendar)
+
+		// 📊 REPORTS ROUTES - Butuh reports:read permission (juga bisa lewat API key service account)
+		api.GET("/reports/dashboard-stats", middleware.PermissionMiddleware("reports:read"), handlers.GetDashboardStats)
+		api.GET("/reports/department-stats", middleware.PermissionMiddleware("reports:read"), handlers.GetDepartmentStats)
+		api.GET("/reports/monthly-trends", middleware.PermissionMiddleware("reports:read"), handlers.GetMonthlyTrends)
+		api.GET("/reports/leave-type-distribution", middleware.PermissionMiddleware("reports:read"), handlers.GetLeaveTypeDistribution)
+		api.GET("/reports/recent-activities", middleware.PermissionMiddleware("reports:read"), handlers.GetRecentActivities)
 
-		// 📊 REPORTS ROUTES - Butuh reports:read permission
-		api.GET("/reports/dashboard-stats", middleware.RoleMiddleware("super_admin", "admin", "manager"), handlers.GetDashboardStats)
-		api.GET("/reports/department-stats", middleware.RoleMiddleware("super_admin", "admin", "manager"), handlers.GetDepartmentStats)
-		api.GET("/reports/monthly-trends", middleware.RoleMiddleware("super_admin", "admin", "manager"), handlers.GetMonthlyTrends)
-		api.GET("/reports/leave-type-distribution", middleware.RoleMiddleware("super_admin", "admin", "manager"), handlers.GetLeaveTypeDistribution)
-		api.GET("/reports/recent-activities", middleware.RoleMiddleware("super_admin", "admin", "manager"), handlers.GetRecentActivities)
+		// 📤 EXPORTS - CSV/XLSX, di-stream dan mengikuti scope permission masing-masing
+		api.GET("/exports/employees", middleware.PermissionMiddleware("users:read"), handlers.ExportEmployees)
+		api.GET("/exports/leave-requests", middleware.PermissionMiddleware("reports:read"), handlers.ExportLeaveRequests)
+		api.GET("/exports/balances", middleware.PermissionMiddleware("reports:read"), handlers.ExportLeaveBalances)
 
 		// 🔥 USER MANAGEMENT ROUTES - Butuh users:read & users:write permissions
 		api.GET("/employees", middleware.PermissionMiddleware("users:read"), handlers.GetEmployees)
 		api.GET("/employees/:id", middleware.PermissionMiddleware("users:read"), handlers.GetEmployeeByID)
+		api.GET("/org-chart", middleware.PermissionMiddleware("users:read"), handlers.GetOrgChart)
 		api.POST("/employees", middleware.PermissionMiddleware("users:write"), handlers.CreateEmployee)
 		api.PUT("/employees/:id", middleware.PermissionMiddleware("users:write"), handlers.UpdateEmployee)
 		api.DELETE("/employees/:id", middleware.PermissionMiddleware("users:write"), handlers.DeleteEmployee)
+		api.POST("/employees/balance-adjustments", middleware.PermissionMiddleware("users:write"), handlers.CreateBalanceAdjustment)
+		api.POST("/employees/import", middleware.PermissionMiddleware("users:write"), handlers.ImportEmployees)
+
+		// ✌️ CHANGE REQUESTS - Perubahan sensitif butuh approval user privileged kedua
+		api.GET("/change-requests", middleware.PermissionMiddleware("users:write"), handlers.GetChangeRequests)
+		api.POST("/change-requests/:id/approve", middleware.PermissionMiddleware("changes:approve"), handlers.ApproveChangeRequest)
+		api.POST("/change-requests/:id/reject", middleware.PermissionMiddleware("changes:approve"), handlers.RejectChangeRequest)
+		api.POST("/change-requests/:id/cancel", middleware.PermissionMiddleware("users:write"), handlers.CancelChangeRequest)
 
 		// 🛠️ HELPER ROUTES - Butuh users:read permission
 		api.GET("/managers", middleware.PermissionMiddleware("users:read"), handlers.GetManagers)
 		api.GET("/roles", middleware.PermissionMiddleware("users:read"), handlers.GetRoles)
+		api.GET("/roles/permissions", middleware.PermissionMiddleware("users:read"), handlers.GetPermissions)
 		api.GET("/departments", middleware.PermissionMiddleware("users:read"), handlers.GetDepartments)
 
+		// 🛡️ ROLE MANAGEMENT ROUTES - Butuh roles:write permission (default hanya super_admin)
+		api.POST("/roles", middleware.PermissionMiddleware("roles:write"), handlers.CreateRole)
+		api.PUT("/roles/:id", middleware.PermissionMiddleware("roles:write"), handlers.UpdateRole)
+		api.DELETE("/roles/:id", middleware.PermissionMiddleware("roles:write"), handlers.DeleteRole)
+
+		// 🏢 DEPARTMENT MANAGEMENT ROUTES - Butuh departments:write untuk seluruh organisasi (default admin)
+		api.POST("/departments", middleware.PermissionMiddleware("departments:write"), handlers.CreateDepartment)
+		api.PUT("/departments/:id", middleware.PermissionMiddleware("departments:write"), handlers.UpdateDepartment)
+		api.POST("/departments/:id/archive", middleware.PermissionMiddleware("departments:write"), handlers.ArchiveDepartment)
+
+		// 🔒 LOGIN LOCKOUT ROUTES - Butuh users:write permission
+		api.GET("/admin/login-lockouts", middleware.PermissionMiddleware("users:write"), handlers.GetLoginLockouts)
+		api.POST("/admin/login-lockouts/unlock", middleware.PermissionMiddleware("users:write"), handlers.UnlockLogin)
+		api.POST("/admin/directory-sync", middleware.PermissionMiddleware("users:write"), handlers.RunDirectorySync)
+
+		// 🤖 SERVICE ACCOUNT ROUTES - API key untuk integrasi (payroll, BI)
+		api.GET("/service-accounts", middleware.PermissionMiddleware("users:write"), handlers.GetServiceAccounts)
+		api.POST("/service-accounts", middleware.PermissionMiddleware("users:write"), handlers.CreateServiceAccount)
+		api.POST("/service-accounts/:id/rotate", middleware.PermissionMiddleware("users:write"), handlers.RotateServiceAccountKey)
+		api.DELETE("/service-accounts/:id", middleware.PermissionMiddleware("users:write"), handlers.RevokeServiceAccount)
+
+		// 🕵️ IMPERSONATION - Hanya super_admin (dicek di handler), semua request tercatat di audit_logs
+		api.POST("/admin/impersonate", middleware.EmployeeOnly(), handlers.StartImpersonation)
+
 		// 🧪 TEST ENDPOINTS - Butuh users:write permission
 		api.POST("/test-ws", middleware.PermissionMiddleware("users:write"), func(c *gin.Context) {
 			// Get department dari user yang login
-			departmentID, exists := c.Get("department_id")
+			departmentID, exists := auth.CurrentDepartmentID(c)
 			if !exists {
 				departmentID = 1 // Default fallback
 			}
@@ -105,7 +200,7 @@ func main() {
 				"2024-02-15",
 				"2024-02-17",
 				"Testing WebSocket from API",
-				departmentID.(int),
+				departmentID,
 			)
 			c.JSON(200, gin.H{"message": "Test WebSocket notification sent!"})
 		})
@@ -141,17 +236,20 @@ func main() {
 		})
 
 		//check user context
-		api.GET("/debug/user-context", func(c *gin.Context) {
-			employeeID, _ := c.Get("employee_id")
-			roleName, _ := c.Get("role_name")
-			isManager, _ := c.Get("is_manager")
-			departmentID, _ := c.Get("department_id")
+		api.GET("/debug/user-context", middleware.EmployeeOnly(), func(c *gin.Context) {
+			identity, _ := auth.CurrentIdentity(c)
+
+			var impersonatedBy *int
+			if identity.IsImpersonated() {
+				impersonatedBy = &identity.Impersonator.EmployeeID
+			}
 
 			c.JSON(200, gin.H{
-				"employee_id":   employeeID,
-				"role_name":     roleName,
-				"is_manager":    isManager,
-				"department_id": departmentID,
+				"employee_id":     identity.EmployeeID,
+				"role_name":       identity.RoleName,
+				"is_manager":      identity.IsManager,
+				"department_id":   identity.DepartmentID,
+				"impersonated_by": impersonatedBy,
 			})
 		})
 
@@ -196,12 +294,5 @@ func main() {
 		})
 	})
 
-	// Start server
-	log.Println("🚀 Server starting on :8080")
-	log.Println("🔌 WebSocket available at: ws://localhost:8080/ws (WITH AUTH)")
-	log.Println("🏥 Health check at: http://localhost:8080/health")
-	log.Println("🔐 Role-based access control: ENABLED")
-	log.Println("🔑 Permission-based access: ENABLED")
-	log.Println("🌐 WebSocket authentication: ENABLED")
-	r.Run(":8080")
+	return r
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"leavemaster/auth"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+// publicRoutes - Route yang memang bisa diakses tanpa token
+var publicRoutes = map[string]bool{
+	"POST /api/login":              true,
+	"POST /api/login/2fa":          true,
+	"GET /api/auth/oidc/login":     true,
+	"POST /api/auth/oidc/callback": true,
+	"POST /api/token/refresh":      true,
+	"POST /api/logout":             true,
+	"POST /api/password/forgot":    true,
+	"POST /api/password/reset":     true,
+	"GET /health":                  true,
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Setenv("JWT_ALGORITHM", "HS256")
+	os.Setenv("JWT_SECRET", "test-secret-that-is-at-least-32-bytes-long")
+	if err := auth.LoadKeys(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// requestPath - Isi path parameter supaya route bisa dipanggil
+func requestPath(path string) string {
+	path = strings.ReplaceAll(path, ":id", "1")
+	return strings.ReplaceAll(path, ":type", "annual")
+}
+
+func signTestToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	token, err := auth.SignToken(claims)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func protectedRoutes(t *testing.T, r *gin.Engine) []gin.RouteInfo {
+	t.Helper()
+	var routes []gin.RouteInfo
+	for _, route := range r.Routes() {
+		if !publicRoutes[route.Method+" "+route.Path] {
+			routes = append(routes, route)
+		}
+	}
+	if len(routes) == 0 {
+		t.Fatal("no protected routes registered")
+	}
+	return routes
+}
+
+// Semua route selain publicRoutes harus menolak request tanpa identitas yang valid,
+// dan tidak boleh panic walaupun claims-nya tidak lengkap
+func TestProtectedRoutesRejectMissingOrInvalidCredentials(t *testing.T) {
+	r := setupRouter()
+
+	cases := []struct {
+		name          string
+		authorization string
+	}{
+		{"no token", ""},
+		{"malformed token", "Bearer not-a-jwt"},
+		{"token without claims", "Bearer " + signTestToken(t, jwt.MapClaims{})},
+		{"token without role", "Bearer " + signTestToken(t, jwt.MapClaims{"employee_id": 7})},
+		{"token with wrong claim types", "Bearer " + signTestToken(t, jwt.MapClaims{
+			"employee_id": "7", "role_name": 1, "is_manager": "yes",
+		})},
+		{"two-factor challenge token", "Bearer " + signTestToken(t, jwt.MapClaims{
+			"employee_id": 7, "role_name": "employee", "purpose": auth.PurposeTwoFactor,
+		})},
+	}
+
+	for _, route := range protectedRoutes(t, r) {
+		for _, tc := range cases {
+			req := httptest.NewRequest(route.Method, requestPath(route.Path), nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s with %s: got %d, want %d", route.Method, route.Path, tc.name, w.Code, http.StatusUnauthorized)
+			}
+		}
+	}
+}
+
+// Route EmployeeOnly menolak API key sebelum menyentuh database
+func TestAPIKeyRejectedOnEmployeeOnlyRoutes(t *testing.T) {
+	r := setupRouter()
+
+	employeeOnly := []string{
+		"GET /api/profile",
+		"PUT /api/profile",
+		"PUT /api/change-password",
+		"GET /api/2fa/status",
+		"POST /api/2fa/enroll",
+		"POST /api/2fa/verify",
+		"POST /api/2fa/disable",
+		"POST /api/2fa/recovery-codes",
+		"GET /api/leave/1/history",
+		"GET /api/leave/forecast",
+		"GET /api/leave/policies",
+		"GET /api/calendar/events",
+		"GET /api/debug/user-context",
+		"POST /api/admin/impersonate",
+	}
+	for _, route := range employeeOnly {
+		method, path, _ := strings.Cut(route, " ")
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", "lm_0000_test")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s with API key: got %d, want %d", route, w.Code, http.StatusForbidden)
+		}
+	}
+}
@@ -4,15 +4,20 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
+	"leavemaster/auth"
+
 	"github.com/gin-gonic/gin"
 )
 
-var jwtSecret = []byte("your-secret-key")
+// checkTokenVersion - Bisa diganti di test supaya tidak butuh database
+var checkTokenVersion = auth.CheckTokenVersion
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" && authHeader == "" {
+			authHeader = "Bearer " + apiKey
+		}
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
 			c.Abort()
@@ -20,28 +25,103 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
 
-		if err != nil || !token.Valid {
+		// API key service account (bukan JWT) baru diverifikasi di PermissionMiddleware
+		if auth.IsAPIKey(tokenString) {
+			c.Set(pendingAPIKeyKey, tokenString)
+			c.Next()
+			return
+		}
+
+		claims, err := auth.ParseToken(tokenString)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		identity, err := auth.IdentityFromClaims(claims)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
+		// Token lama ditolak setelah employee dinonaktifkan atau role-nya berubah
+		if err := checkTokenVersion(claims); err != nil {
+			if err == auth.ErrTokenRevoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+			}
+			c.Abort()
+			return
+		}
+
+		// Role yang wajib 2FA harus enroll dulu sebelum bisa akses API lain
+		if auth.TwoFactorSetupPending(claims) && !strings.HasPrefix(c.FullPath(), "/api/2fa/") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                     "Two-factor authentication setup required",
+				"two_factor_setup_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		// Password sementara (mis. dari import) harus diganti sebelum API lain bisa dipakai
+		if auth.PasswordChangePending(claims) && c.FullPath() != "/api/change-password" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                    "Password change required",
+				"password_change_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		if identity.IsImpersonated() {
+			serveImpersonated(c, identity)
+			return
+		}
+
+		auth.SetIdentity(c, identity)
+		c.Next()
+	}
+}
 
-		// ✅ STANDARDIZE: Gunakan lowercase dengan underscore
-		c.Set("employee_id", int(claims["employee_id"].(float64)))
-		c.Set("is_manager", claims["is_manager"].(bool))
-		c.Set("role_name", claims["role_name"].(string))
+// pendingAPIKeyKey - API key yang belum diverifikasi. Hanya PermissionMiddleware yang
+// memverifikasi dan memasang identitas service account, jadi route tanpa permission check
+// tidak pernah punya identitas dari API key (dan EmployeeOnly menolaknya dengan 403).
+const pendingAPIKeyKey = "pending_api_key"
 
-		// TAMBAHKAN INI untuk WebSocket department filtering
-		if departmentID, ok := claims["department_id"].(float64); ok {
-			c.Set("department_id", int(departmentID))
+// authenticateServiceAccount - Verifikasi API key yang ditunda AuthMiddleware lalu set identitas
+// service account. False kalau request sudah dihentikan.
+func authenticateServiceAccount(c *gin.Context, apiKey string) bool {
+	account, err := authenticateAPIKey(apiKey)
+	if err != nil {
+		if err == auth.ErrAPIKeyInvalid {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify API key"})
 		}
+		c.Abort()
+		return false
+	}
+
+	auth.SetIdentity(c, auth.ServiceAccountIdentityOf(account))
+	return true
+}
+
+// authenticateAPIKey - Bisa diganti di test supaya tidak butuh database
+var authenticateAPIKey = auth.AuthenticateAPIKey
 
+// EmployeeOnly - Route untuk employee yang login (profile, 2FA, ...); API key ditolak
+func EmployeeOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, pending := c.Get(pendingAPIKeyKey); pending {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys are not accepted on this endpoint"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
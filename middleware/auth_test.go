@@ -0,0 +1,387 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"leavemaster/auth"
+	"leavemaster/services"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Setenv("JWT_ALGORITHM", "HS256")
+	os.Setenv("JWT_SECRET", "test-secret-that-is-at-least-32-bytes-long")
+	if err := auth.LoadKeys(); err != nil {
+		panic(err)
+	}
+	// Tanpa database: anggap token_version selalu cocok, kecuali token challenge
+	checkTokenVersion = func(claims jwt.MapClaims) error {
+		if _, ok := claims["purpose"]; ok {
+			return auth.ErrTokenRevoked
+		}
+		return nil
+	}
+	// Permission default dari migration 013_scoped_role_permissions
+	seeded := map[string][]string{
+		"admin":    {"calendar:team", "leave:approve", "reports:read", "users:read", "users:write"},
+		"manager":  {"calendar:team@department", "leave:approve@department", "reports:read@department", "users:read@department"},
+		"employee": {"leave:read@self", "leave:write@self"},
+	}
+	permissionScopeOf = func(id auth.Identity, permission string) (auth.Scope, error) {
+		if id.IsServiceAccount() {
+			return auth.PermissionScopeOf(id, permission)
+		}
+		if id.RoleName == "super_admin" {
+			return auth.ScopeOrganisation, nil
+		}
+		for _, granted := range seeded[id.RoleName] {
+			if name, scope, _ := auth.SplitPermission(granted); name == permission {
+				return scope, nil
+			}
+		}
+		return auth.ScopeNone, nil
+	}
+	authenticateAPIKey = func(apiKey string) (auth.ServiceAccountIdentity, error) {
+		if apiKey != testAPIKey {
+			return auth.ServiceAccountIdentity{}, auth.ErrAPIKeyInvalid
+		}
+		return auth.ServiceAccountIdentity{ID: 3, Name: "payroll", Scopes: []string{"users:read"}}, nil
+	}
+	recordAuditEvent = func(event services.AuditEvent) {
+		auditEvents = append(auditEvents, event)
+	}
+	os.Exit(m.Run())
+}
+
+// testAPIKey - Satu-satunya API key yang valid selama test (scope users:read)
+const testAPIKey = "lm_0000_test"
+
+// auditEvents - Event yang dicatat middleware selama test
+var auditEvents []services.AuditEvent
+
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	token, err := auth.SignToken(claims)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+type identityResponse struct {
+	EmployeeID   int    `json:"employee_id"`
+	RoleName     string `json:"role_name"`
+	IsManager    bool   `json:"is_manager"`
+	DepartmentID *int   `json:"department_id"`
+}
+
+func echoIdentity(c *gin.Context) {
+	identity, ok := auth.CurrentIdentity(c)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "identity missing"})
+		return
+	}
+	c.JSON(http.StatusOK, identityResponse{
+		EmployeeID:   identity.EmployeeID,
+		RoleName:     identity.RoleName,
+		IsManager:    identity.IsManager,
+		DepartmentID: identity.DepartmentID,
+	})
+}
+
+func newTestRouter() *gin.Engine {
+	r := gin.New()
+	r.GET("/ws", WebSocketAuth(), echoIdentity)
+	api := r.Group("/api", AuthMiddleware())
+	api.GET("/whoami", echoIdentity)
+	api.GET("/2fa/status", echoIdentity)
+	api.GET("/leave/my-requests", PermissionMiddleware("leave:read"), echoIdentity)
+	api.GET("/employees", PermissionMiddleware("users:read"), echoIdentity)
+	api.GET("/calendar/team", PermissionMiddleware("calendar:team"), echoIdentity)
+	api.POST("/leave/request", PermissionMiddleware("leave:write"), echoIdentity)
+	api.PUT("/change-password", echoIdentity)
+	return r
+}
+
+func do(r *gin.Engine, path, token string) *httptest.ResponseRecorder {
+	return doMethod(r, http.MethodGet, path, token)
+}
+
+func doMethod(r *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// HTTP dan WebSocket harus menghasilkan identitas yang sama dari token yang sama
+func TestHTTPAndWebSocketShareIdentity(t *testing.T) {
+	r := newTestRouter()
+	token := signToken(t, jwt.MapClaims{
+		"employee_id":   42,
+		"role_name":     "Manager",
+		"is_manager":    true,
+		"department_id": 3,
+		"tv":            0,
+	})
+
+	var fromHTTP, fromWS identityResponse
+	for path, target := range map[string]*identityResponse{"/api/whoami": &fromHTTP, "/ws": &fromWS} {
+		w := do(r, path, token)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", path, w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), target); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+
+	if fromHTTP.EmployeeID != 42 || fromHTTP.RoleName != "manager" || !fromHTTP.IsManager ||
+		fromHTTP.DepartmentID == nil || *fromHTTP.DepartmentID != 3 {
+		t.Errorf("unexpected HTTP identity: %+v", fromHTTP)
+	}
+	if fromWS.EmployeeID != fromHTTP.EmployeeID || fromWS.RoleName != fromHTTP.RoleName ||
+		fromWS.IsManager != fromHTTP.IsManager || fromWS.DepartmentID == nil || *fromWS.DepartmentID != 3 {
+		t.Errorf("WebSocket identity %+v differs from HTTP identity %+v", fromWS, fromHTTP)
+	}
+}
+
+func TestOptionalClaimsDefault(t *testing.T) {
+	r := newTestRouter()
+	token := signToken(t, jwt.MapClaims{"employee_id": 5, "role_name": "employee", "department_id": nil})
+
+	w := do(r, "/api/whoami", token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var got identityResponse
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if got.IsManager || got.DepartmentID != nil {
+		t.Errorf("expected no manager flag and no department, got %+v", got)
+	}
+}
+
+func TestIncompleteClaimsRejectedWithoutPanic(t *testing.T) {
+	r := newTestRouter()
+	tokens := map[string]string{
+		"empty":            signToken(t, jwt.MapClaims{}),
+		"no role":          signToken(t, jwt.MapClaims{"employee_id": 5}),
+		"no employee":      signToken(t, jwt.MapClaims{"role_name": "admin"}),
+		"wrong types":      signToken(t, jwt.MapClaims{"employee_id": "5", "role_name": true, "is_manager": "yes"}),
+		"challenge token":  signToken(t, jwt.MapClaims{"employee_id": 5, "role_name": "admin", "purpose": auth.PurposeTwoFactor}),
+		"zero employee id": signToken(t, jwt.MapClaims{"employee_id": 0, "role_name": "admin"}),
+	}
+
+	for name, token := range tokens {
+		for _, path := range []string{"/api/whoami", "/ws"} {
+			if w := do(r, path, token); w.Code != http.StatusUnauthorized {
+				t.Errorf("%s on %s: got %d, want %d", name, path, w.Code, http.StatusUnauthorized)
+			}
+		}
+	}
+}
+
+func TestTwoFactorSetupTokenLimitedToEnrollment(t *testing.T) {
+	r := newTestRouter()
+	token := signToken(t, jwt.MapClaims{"employee_id": 5, "role_name": "admin", "2fa_setup": true})
+
+	if w := do(r, "/api/whoami", token); w.Code != http.StatusForbidden {
+		t.Errorf("/api/whoami: got %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := do(r, "/api/2fa/status", token); w.Code != http.StatusOK {
+		t.Errorf("/api/2fa/status: got %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := do(r, "/ws", token); w.Code != http.StatusForbidden {
+		t.Errorf("/ws: got %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestPermissionAndRoleChecksUseIdentity(t *testing.T) {
+	r := newTestRouter()
+	employee := signToken(t, jwt.MapClaims{"employee_id": 5, "role_name": "employee"})
+	manager := signToken(t, jwt.MapClaims{"employee_id": 6, "role_name": "manager", "is_manager": true})
+	superAdmin := signToken(t, jwt.MapClaims{"employee_id": 1, "role_name": "super_admin"})
+
+	cases := []struct {
+		path  string
+		token string
+		want  int
+	}{
+		{"/api/leave/my-requests", employee, http.StatusOK},
+		{"/api/employees", employee, http.StatusForbidden},
+		{"/api/calendar/team", employee, http.StatusForbidden},
+		{"/api/employees", manager, http.StatusOK},
+		{"/api/calendar/team", manager, http.StatusOK},
+		{"/api/employees", superAdmin, http.StatusOK},
+		{"/api/calendar/team", superAdmin, http.StatusOK},
+	}
+	for _, tc := range cases {
+		if w := do(r, tc.path, tc.token); w.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.path, w.Code, tc.want)
+		}
+	}
+}
+
+func TestPermissionMiddlewareWithoutIdentity(t *testing.T) {
+	r := gin.New()
+	r.GET("/open", PermissionMiddleware("users:read"), echoIdentity)
+
+	if w := do(r, "/open", ""); w.Code != http.StatusForbidden {
+		t.Errorf("got %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestPermissionMiddlewareSetsScope(t *testing.T) {
+	r := gin.New()
+	r.GET("/api/employees", AuthMiddleware(), PermissionMiddleware("users:read"), func(c *gin.Context) {
+		c.String(http.StatusOK, auth.CurrentScope(c).String())
+	})
+
+	cases := map[string]string{
+		"manager":     "department",
+		"admin":       "organisation",
+		"super_admin": "organisation",
+	}
+	for role, want := range cases {
+		w := do(r, "/api/employees", signToken(t, jwt.MapClaims{"employee_id": 5, "role_name": role}))
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("%s: got %d %q, want %q", role, w.Code, w.Body.String(), want)
+		}
+	}
+}
+
+func impersonationToken(t *testing.T, readOnly bool) string {
+	claims := jwt.MapClaims{"employee_id": 5, "role_name": "employee", "tv": 0}
+	auth.AddImpersonatorClaim(claims, auth.Impersonator{EmployeeID: 1, ReadOnly: readOnly, SessionID: "s1"})
+	return signToken(t, claims)
+}
+
+func TestImpersonationActsAsTargetAndAuditsBothIdentities(t *testing.T) {
+	r := newTestRouter()
+	auditEvents = nil
+
+	w := do(r, "/api/whoami", impersonationToken(t, true))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body.String())
+	}
+	var got identityResponse
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if got.EmployeeID != 5 || got.RoleName != "employee" {
+		t.Errorf("expected target identity, got %+v", got)
+	}
+
+	if len(auditEvents) != 1 {
+		t.Fatalf("expected 1 audit event, got %d", len(auditEvents))
+	}
+	event := auditEvents[0]
+	if event.Action != "impersonated_request" || event.ActorID == nil || *event.ActorID != 1 ||
+		event.SubjectID == nil || *event.SubjectID != 5 || event.Details["status"] != http.StatusOK {
+		t.Errorf("unexpected audit event: %+v", event)
+	}
+}
+
+func TestImpersonationWriteBlocking(t *testing.T) {
+	r := newTestRouter()
+	readOnly := impersonationToken(t, true)
+	writable := impersonationToken(t, false)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"read-only GET", http.MethodGet, "/api/leave/my-requests", readOnly, http.StatusOK},
+		{"read-only POST", http.MethodPost, "/api/leave/request", readOnly, http.StatusForbidden},
+		{"writable POST", http.MethodPost, "/api/leave/request", writable, http.StatusOK},
+		{"change password", http.MethodPut, "/api/change-password", writable, http.StatusForbidden},
+		{"2fa", http.MethodGet, "/api/2fa/status", writable, http.StatusForbidden},
+		{"websocket", http.MethodGet, "/ws", readOnly, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		auditEvents = nil
+		w := doMethod(r, tc.method, tc.path, tc.token)
+		if w.Code != tc.want {
+			t.Errorf("%s: got %d, want %d", tc.name, w.Code, tc.want)
+		}
+		// Request yang ditolak tetap tercatat (kecuali WebSocket yang tidak pernah dibuka)
+		if tc.path != "/ws" && len(auditEvents) != 1 {
+			t.Errorf("%s: expected 1 audit event, got %d", tc.name, len(auditEvents))
+		}
+	}
+}
+
+func TestMalformedImpersonatorClaimRejected(t *testing.T) {
+	r := newTestRouter()
+	token := signToken(t, jwt.MapClaims{"employee_id": 5, "role_name": "employee", "act": "admin"})
+
+	if w := do(r, "/api/whoami", token); w.Code != http.StatusUnauthorized {
+		t.Errorf("got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestPendingPasswordChangeLimitedToChangePassword(t *testing.T) {
+	r := newTestRouter()
+	token := signToken(t, jwt.MapClaims{"employee_id": 5, "role_name": "employee", "pwd_change": true})
+
+	if w := do(r, "/api/whoami", token); w.Code != http.StatusForbidden {
+		t.Errorf("/api/whoami: got %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := doMethod(r, http.MethodPut, "/api/change-password", token); w.Code != http.StatusOK {
+		t.Errorf("/api/change-password: got %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := do(r, "/ws", token); w.Code != http.StatusForbidden {
+		t.Errorf("/ws: got %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+// API key hanya diverifikasi dan dipakai di route dengan PermissionMiddleware
+func TestAPIKeyOnlyAcceptedBehindPermissionCheck(t *testing.T) {
+	r := gin.New()
+	api := r.Group("/api", AuthMiddleware())
+	api.GET("/employees", PermissionMiddleware("users:read"), echoIdentity)
+	api.GET("/calendar/team", PermissionMiddleware("calendar:team"), echoIdentity)
+	api.GET("/profile", EmployeeOnly(), echoIdentity)
+	api.GET("/unmarked", echoIdentity)
+
+	cases := []struct {
+		path   string
+		apiKey string
+		want   int
+	}{
+		{"/api/employees", testAPIKey, http.StatusOK},
+		{"/api/employees", "lm_9999_wrong", http.StatusUnauthorized},
+		{"/api/calendar/team", testAPIKey, http.StatusForbidden},
+		{"/api/profile", testAPIKey, http.StatusForbidden},
+		// Route yang lupa ditandai tetap tidak mendapat identitas dari API key
+		{"/api/unmarked", testAPIKey, http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("X-API-Key", tc.apiKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s with %s: got %d, want %d", tc.path, tc.apiKey, w.Code, tc.want)
+		}
+	}
+
+	// Employee tetap bisa memakai route EmployeeOnly
+	token := signToken(t, jwt.MapClaims{"employee_id": 5, "role_name": "employee"})
+	if w := do(r, "/api/profile", token); w.Code != http.StatusOK {
+		t.Errorf("/api/profile with employee token: got %d", w.Code)
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"leavemaster/auth"
+	"leavemaster/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAuditEvent - Bisa diganti di test supaya tidak butuh database
+var recordAuditEvent = services.RecordAuditEvent
+
+// impersonationDeniedRoutes - Route yang tidak boleh dipakai lewat token impersonation
+// walaupun write diizinkan: kredensial milik target dan impersonation berantai
+var impersonationDeniedRoutes = []string{
+	"/api/change-password",
+	"/api/2fa/",
+	"/api/admin/impersonate",
+}
+
+// serveImpersonated - Jalankan request atas nama target; setiap request (termasuk yang
+// ditolak) dicatat di audit_logs dengan actor = super_admin dan subject = target
+func serveImpersonated(c *gin.Context, identity auth.Identity) {
+	defer recordImpersonatedRequest(c, identity)
+
+	if message := impersonationDenied(c, identity); message != "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": message, "impersonating": true})
+		c.Abort()
+		return
+	}
+
+	auth.SetIdentity(c, identity)
+	c.Next()
+}
+
+func impersonationDenied(c *gin.Context, identity auth.Identity) string {
+	path := c.FullPath()
+	for _, denied := range impersonationDeniedRoutes {
+		if path == denied || (strings.HasSuffix(denied, "/") && strings.HasPrefix(path, denied)) {
+			return "This endpoint is not available while impersonating"
+		}
+	}
+	if identity.Impersonator.ReadOnly {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			return "Impersonation session is read-only"
+		}
+	}
+	return ""
+}
+
+func recordImpersonatedRequest(c *gin.Context, identity auth.Identity) {
+	actorID := identity.Impersonator.EmployeeID
+	subjectID := identity.EmployeeID
+	recordAuditEvent(services.AuditEvent{
+		Action:    "impersonated_request",
+		ActorID:   &actorID,
+		SubjectID: &subjectID,
+		IPAddress: c.ClientIP(),
+		Details: map[string]interface{}{
+			"session_id": identity.Impersonator.SessionID,
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"status":     c.Writer.Status(),
+			"read_only":  identity.Impersonator.ReadOnly,
+		},
+	})
+}
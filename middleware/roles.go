@@ -5,27 +5,27 @@ import (
 	"net/http"
 	"strings"
 
+	"leavemaster/auth"
+
 	"github.com/gin-gonic/gin"
 )
 
 // RoleMiddleware - Check if user has required role
 func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userRole, exists := c.Get("role_name")
+		identity, exists := auth.CurrentIdentity(c)
 		if !exists {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Role information not found"})
 			c.Abort()
 			return
 		}
+		userRole := identity.RoleName
 
 		// Debug log
 		log.Printf("🔐 Role check - User role: %s, Allowed: %v", userRole, allowedRoles)
 
-		// Convert user role to lowercase for consistent comparison
-		userRoleStr := strings.ToLower(strings.TrimSpace(userRole.(string)))
-
 		// Super admin can access everything
-		if userRoleStr == "super_admin" {
+		if userRole == "super_admin" {
 			c.Next()
 			return
 		}
@@ -33,7 +33,7 @@ func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 		// Check if user's role is in allowed roles
 		for _, role := range allowedRoles {
 			// Case insensitive comparison
-			if userRoleStr == strings.ToLower(role) {
+			if userRole == strings.ToLower(role) {
 				c.Next()
 				return
 			}
@@ -47,43 +47,48 @@ func RoleMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	}
 }
 
+// permissionScopeOf - Bisa diganti di test supaya tidak butuh database
+var permissionScopeOf = auth.PermissionScopeOf
+
 // PermissionMiddleware - Check specific permissions
 func PermissionMiddleware(requiredPermission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userRole, exists := c.Get("role_name")
+		if apiKey, pending := c.Get(pendingAPIKeyKey); pending {
+			if _, verified := auth.CurrentIdentity(c); !verified && !authenticateServiceAccount(c, apiKey.(string)) {
+				return
+			}
+		}
+
+		identity, exists := auth.CurrentIdentity(c)
 		if !exists {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Role information not found"})
 			c.Abort()
 			return
 		}
+		userRole := identity.RoleName
 
 		// Debug log
 		log.Printf("🔐 Permission check - User role: %s, Required: %s", userRole, requiredPermission)
 
-		// Convert user role to lowercase for consistent comparison
-		userRoleStr := strings.ToLower(strings.TrimSpace(userRole.(string)))
-
-		// Super admin has all permissions
-		if userRoleStr == "super_admin" {
-			c.Next()
+		// Permission role dari tabel roles (di-cache), atau scope API key untuk service account.
+		// Scope-nya (self/team/department/organisation) dipakai handler lewat auth.ScopeFilter.
+		scope, err := permissionScopeOf(identity, requiredPermission)
+		if err != nil {
+			log.Printf("❌ Failed to load role permissions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			c.Abort()
 			return
 		}
-
-		// Define role permissions
-		rolePermissions := map[string][]string{
-			"admin":    {"users:read", "users:write", "reports:read", "leave:approve"},
-			"manager":  {"users:read", "leave:approve", "reports:read"},
-			"employee": {"leave:read", "leave:write"},
+		if scope != auth.ScopeNone {
+			auth.SetPermissionScope(c, scope)
+			c.Next()
+			return
 		}
 
-		// Check if user's role has the required permission
-		if permissions, exists := rolePermissions[userRoleStr]; exists {
-			for _, permission := range permissions {
-				if permission == requiredPermission {
-					c.Next()
-					return
-				}
-			}
+		if identity.IsServiceAccount() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing scope: " + requiredPermission})
+			c.Abort()
+			return
 		}
 
 		c.JSON(http.StatusForbidden, gin.H{
@@ -4,7 +4,8 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
+	"leavemaster/auth"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -27,31 +28,51 @@ func WebSocketAuth() gin.HandlerFunc {
 		}
 
 		// Parse token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte("your-secret-key"), nil // PASTIKAN SAMA DENGAN SECRET KEY LAINNYA
-		})
-
-		if err != nil || !token.Valid {
+		claims, err := auth.ParseToken(tokenString)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid WebSocket token"})
 			c.Abort()
 			return
 		}
 
-		// Set user info in context
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("employeeID", int(claims["employee_id"].(float64)))
-			c.Set("isManager", claims["is_manager"].(bool))
-			c.Set("role_name", claims["role_name"].(string))
+		identity, err := auth.IdentityFromClaims(claims)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid WebSocket token"})
+			c.Abort()
+			return
+		}
 
-			// TAMBAHKAN DEPARTMENT_ID
-			if departmentID, ok := claims["department_id"].(float64); ok {
-				c.Set("department_id", int(departmentID))
+		if err := checkTokenVersion(claims); err != nil {
+			if err == auth.ErrTokenRevoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "WebSocket token has been revoked"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify WebSocket token"})
 			}
+			c.Abort()
+			return
+		}
 
-			c.Next()
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		if auth.TwoFactorSetupPending(claims) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication setup required"})
 			c.Abort()
+			return
 		}
+
+		if auth.PasswordChangePending(claims) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password change required"})
+			c.Abort()
+			return
+		}
+
+		// Notifikasi realtime milik target tidak dikirim ke super_admin yang impersonate
+		if identity.IsImpersonated() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Impersonation tokens cannot open WebSocket connections"})
+			c.Abort()
+			return
+		}
+
+		// Identitas yang sama dengan AuthMiddleware, dibaca oleh hub
+		auth.SetIdentity(c, identity)
+		c.Next()
 	}
 }
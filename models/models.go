@@ -20,21 +20,81 @@ type Employee struct {
 	ManagerID          *int      `json:"manager_id"`
 	ManagerName        string    `json:"manager_name,omitempty"`
 	CreatedAt          time.Time `json:"created_at"`
+	TokenVersion       int       `json:"-"`
+	TwoFactorEnabled   bool      `json:"-"`
+	MustChangePassword bool      `json:"-"`
+}
+
+// EmployeePage - Satu halaman GET /api/employees; next_cursor kosong di halaman terakhir
+type EmployeePage struct {
+	Employees  []Employee `json:"employees"`
+	Total      int        `json:"total"`
+	Limit      int        `json:"limit"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// OrgChartNode - Satu employee di org chart; headcount dan on_leave_count termasuk dirinya sendiri
+type OrgChartNode struct {
+	ID             int             `json:"id"`
+	EmployeeID     string          `json:"employee_id"`
+	Name           string          `json:"name"`
+	Position       string          `json:"position"`
+	DepartmentID   *int            `json:"department_id"`
+	DepartmentName string          `json:"department_name,omitempty"`
+	ManagerID      *int            `json:"manager_id"`
+	OnLeave        bool            `json:"on_leave"`
+	OnLeaveUntil   string          `json:"on_leave_until,omitempty"`
+	Headcount      int             `json:"headcount"`
+	OnLeaveCount   int             `json:"on_leave_count"`
+	Reports        []*OrgChartNode `json:"reports"`
+}
+
+// OrgChart - Response GET /api/org-chart
+type OrgChart struct {
+	AsOf      string          `json:"as_of"`
+	Headcount int             `json:"headcount"`
+	OnLeave   int             `json:"on_leave"`
+	Roots     []*OrgChartNode `json:"roots"`
 }
 
 type Role struct {
-	ID          int                    `json:"id"`
-	Name        string                 `json:"name"`
-	Description string                 `json:"description"`
-	Permissions map[string]interface{} `json:"permissions"`
-	CreatedAt   time.Time              `json:"created_at"`
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Permissions   []string  `json:"permissions"`
+	EmployeeCount int       `json:"employee_count"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 type Department struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	ParentID    *int       `json:"parent_id"`
+	ParentName  string     `json:"parent_name,omitempty"`
+	HeadID      *int       `json:"head_id"`
+	HeadName    string     `json:"head_name,omitempty"`
+	CostCenter  *string    `json:"cost_center"`
+	IsArchived  bool       `json:"is_archived"`
+	ArchivedAt  *time.Time `json:"archived_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type CreateDepartmentRequest struct {
+	Name        string  `json:"name" binding:"required,max=100"`
+	Description string  `json:"description" binding:"max=255"`
+	ParentID    *int    `json:"parent_id"`
+	HeadID      *int    `json:"head_id"`
+	CostCenter  *string `json:"cost_center" binding:"omitempty,max=50"`
+}
+
+// UpdateDepartmentRequest - Field nil tidak diubah; parent_id/head_id 0 dan cost_center "" menghapus nilainya
+type UpdateDepartmentRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description" binding:"omitempty,max=255"`
+	ParentID    *int    `json:"parent_id"`
+	HeadID      *int    `json:"head_id"`
+	CostCenter  *string `json:"cost_center" binding:"omitempty,max=50"`
 }
 
 type LeaveRequest struct {
@@ -50,6 +110,76 @@ type LeaveRequest struct {
 	ApprovedBy   *int      `json:"approved_by"`
 	ApprovedAt   *string   `json:"approved_at"`
 	CreatedAt    time.Time `json:"created_at"`
+
+	// Terisi kalau request langsung di-approve oleh auto-approval rule
+	AutoApprovalRuleID   *int   `json:"auto_approval_rule_id"`
+	AutoApprovalRuleName string `json:"auto_approval_rule_name,omitempty"`
+}
+
+// AutoApprovalRule - Rule untuk approve leave request otomatis tanpa menunggu manager.
+// Field nil berarti kondisi tersebut tidak dicek.
+type AutoApprovalRule struct {
+	ID                  int       `json:"id"`
+	Name                string    `json:"name" binding:"required"`
+	LeaveType           *string   `json:"leave_type"`
+	MaxDays             *int      `json:"max_days"`
+	MinNoticeDays       *int      `json:"min_notice_days"`
+	MinRemainingBalance *int      `json:"min_remaining_balance"`
+	MaxTeamAbsent       *int      `json:"max_team_absent"`
+	Priority            int       `json:"priority"`
+	IsActive            bool      `json:"is_active"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// LeaveAmendment - Perubahan pada leave request. Edit request pending langsung "applied",
+// edit request approved jadi "pending" sampai di-approve ulang.
+type LeaveAmendment struct {
+	ID             int       `json:"id"`
+	LeaveRequestID int       `json:"leave_request_id"`
+	RequestedBy    int       `json:"requested_by"`
+	EmployeeName   string    `json:"employee_name,omitempty"`
+	OldLeaveType   string    `json:"old_leave_type"`
+	OldStartDate   string    `json:"old_start_date"`
+	OldEndDate     string    `json:"old_end_date"`
+	OldTotalDays   int       `json:"old_total_days"`
+	OldReason      string    `json:"old_reason"`
+	NewLeaveType   string    `json:"new_leave_type"`
+	NewStartDate   string    `json:"new_start_date"`
+	NewEndDate     string    `json:"new_end_date"`
+	NewTotalDays   int       `json:"new_total_days"`
+	NewReason      string    `json:"new_reason"`
+	Status         string    `json:"status"`
+	DecidedBy      *int      `json:"decided_by"`
+	DecidedAt      *string   `json:"decided_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// LeaveTypePolicy - Aturan pengajuan per leave type. Field nil berarti tidak dibatasi.
+type LeaveTypePolicy struct {
+	LeaveType          string `json:"leave_type"`
+	MinNoticeDays      *int   `json:"min_notice_days"`
+	MaxAdvanceDays     *int   `json:"max_advance_days"`
+	MaxBackdateDays    *int   `json:"max_backdate_days"`
+	MaxConsecutiveDays *int   `json:"max_consecutive_days"`
+
+	// Accrual & carry-over. AnnualEntitlement nil = pakai balance utama employee (remaining_leave_days).
+	AnnualEntitlement     *int   `json:"annual_entitlement"`
+	AccrualFrequency      string `json:"accrual_frequency" binding:"omitempty,oneof=yearly monthly"`
+	MaxCarryOverDays      *int   `json:"max_carry_over_days"`
+	CarryOverExpiryMonths *int   `json:"carry_over_expiry_months"`
+
+	// Visibility: "out_of_office" menyembunyikan leave type dari rekan kerja,
+	// "hr" membatasi reason ke requester dan HR (default: requester, approver dan HR)
+	CalendarVisibility string    `json:"calendar_visibility" binding:"omitempty,oneof=full out_of_office"`
+	ReasonVisibility   string    `json:"reason_visibility" binding:"omitempty,oneof=approvers hr"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// ValidationError - Satu aturan yang dilanggar oleh request
+type ValidationError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
 }
 
 type LoginRequest struct {
@@ -58,8 +188,124 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	Token    string    `json:"token"`
-	Employee *Employee `json:"employee"`
+	Token                  string    `json:"token"`
+	RefreshToken           string    `json:"refresh_token"`
+	ExpiresIn              int64     `json:"expires_in"`
+	Employee               *Employee `json:"employee"`
+	TwoFactorSetupRequired bool      `json:"two_factor_setup_required,omitempty"`
+	PasswordChangeRequired bool      `json:"password_change_required,omitempty"`
+}
+
+// TwoFactorChallengeResponse - Response login kalau 2FA aktif; lanjut ke POST /api/login/2fa
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int64  `json:"expires_in"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"` // kode TOTP atau recovery code
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+type ServiceAccount struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Scopes      []string   `json:"scopes"`
+	KeyPrefix   string     `json:"key_prefix"`
+	CreatedBy   *int       `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RotatedAt   *time.Time `json:"rotated_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+// ChangeRequest - Perubahan administratif sensitif (promosi ke role privileged, reaktivasi,
+// penyesuaian balance massal) yang baru berlaku setelah di-approve user privileged kedua
+type ChangeRequest struct {
+	ID              int                    `json:"id"`
+	Action          string                 `json:"action"`
+	SubjectID       *int                   `json:"subject_id"`
+	SubjectName     *string                `json:"subject_name"`
+	Payload         map[string]interface{} `json:"payload"`
+	Reason          string                 `json:"reason"`
+	Status          string                 `json:"status"`
+	RequestedBy     int                    `json:"requested_by"`
+	RequestedByName string                 `json:"requested_by_name"`
+	DecidedBy       *int                   `json:"decided_by"`
+	DecidedAt       *time.Time             `json:"decided_at"`
+	DecisionNote    string                 `json:"decision_note"`
+	ExpiresAt       time.Time              `json:"expires_at"`
+	CreatedAt       time.Time              `json:"created_at"`
+}
+
+type ChangeRequestDecision struct {
+	Note string `json:"note" binding:"max=255"`
+}
+
+// BalanceAdjustmentRequest - Tambah/kurangi balance cuti beberapa employee sekaligus
+type BalanceAdjustmentRequest struct {
+	EmployeeIDs []int  `json:"employee_ids" binding:"required,min=1"`
+	Days        int    `json:"days" binding:"required,min=-365,max=365"`
+	Reason      string `json:"reason" binding:"required,max=255"`
+}
+
+type CreateServiceAccountRequest struct {
+	Name        string   `json:"name" binding:"required,max=100"`
+	Description string   `json:"description" binding:"max=255"`
+	Scopes      []string `json:"scopes" binding:"required,min=1"`
+}
+
+type CreateRoleRequest struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Description string   `json:"description" binding:"max=255"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// UpdateRoleRequest - Nama role tidak bisa diubah (dipakai di token yang sudah terbit)
+type UpdateRoleRequest struct {
+	Description *string  `json:"description" binding:"omitempty,max=255"`
+	Permissions []string `json:"permissions"`
+}
+
+// ImpersonationRequest - AllowWrites default false: token impersonation hanya bisa GET
+type ImpersonationRequest struct {
+	EmployeeID  int    `json:"employee_id" binding:"required"`
+	Reason      string `json:"reason" binding:"required,max=255"`
+	AllowWrites bool   `json:"allow_writes"`
+}
+
+// ImpersonationResponse - Token untuk bertindak sebagai employee; tidak ada refresh token
+type ImpersonationResponse struct {
+	Token     string    `json:"token"`
+	ExpiresIn int64     `json:"expires_in"`
+	ExpiresAt time.Time `json:"expires_at"`
+	ReadOnly  bool      `json:"read_only"`
+	SessionID string    `json:"session_id"`
+	Employee  *Employee `json:"employee"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 type CreateEmployeeRequest struct {
@@ -74,6 +320,32 @@ type CreateEmployeeRequest struct {
 	TotalLeaveDays int    `json:"total_leave_days"`
 }
 
+// ImportRowError - Satu masalah di satu baris file import (Row = nomor baris di file, header = 1)
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportedEmployee - Employee yang dibuat oleh import; InviteURL atau TemporaryPassword
+// sesuai mode credentials, hanya ditampilkan sekali di response ini
+type ImportedEmployee struct {
+	Row               int    `json:"row"`
+	ID                int    `json:"id"`
+	EmployeeID        string `json:"employee_id"`
+	Email             string `json:"email"`
+	InviteURL         string `json:"invite_url,omitempty"`
+	TemporaryPassword string `json:"temporary_password,omitempty"`
+}
+
+type EmployeeImportResult struct {
+	DryRun    bool               `json:"dry_run"`
+	TotalRows int                `json:"total_rows"`
+	ValidRows int                `json:"valid_rows"`
+	Errors    []ImportRowError   `json:"errors"`
+	Created   []ImportedEmployee `json:"created,omitempty"`
+}
+
 type UpdateEmployeeRequest struct {
 	Name           string `json:"name"`
 	Email          string `json:"email"`
@@ -83,4 +355,7 @@ type UpdateEmployeeRequest struct {
 	ManagerID      *int   `json:"manager_id"`
 	IsActive       *bool  `json:"is_active"`
 	TotalLeaveDays int    `json:"total_leave_days"`
+
+	// ChangeReason - Dicatat di change request kalau perubahan butuh approval kedua
+	ChangeReason string `json:"change_reason" binding:"max=255"`
 }
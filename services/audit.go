@@ -0,0 +1,40 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+
+	"leavemaster/database"
+)
+
+// AuditEvent - Satu kejadian yang perlu dicatat di audit_logs
+type AuditEvent struct {
+	Action    string // contoh: "login_lockout", "login_unlock"
+	ActorID   *int   // employee yang melakukan aksi (nil = sistem)
+	SubjectID *int   // employee yang terkena aksi
+	IPAddress string
+	Details   map[string]interface{} // data tambahan, disimpan sebagai JSON
+}
+
+// RecordAuditEvent - Simpan event ke audit_logs. Gagal simpan hanya di-log supaya request utama tetap jalan.
+func RecordAuditEvent(event AuditEvent) {
+	var details interface{}
+	if len(event.Details) > 0 {
+		data, err := json.Marshal(event.Details)
+		if err != nil {
+			log.Printf("❌ Failed to marshal audit details for %s: %v", event.Action, err)
+		} else {
+			details = string(data)
+		}
+	}
+
+	_, err := database.DB.Exec(`
+		INSERT INTO audit_logs (action, actor_id, subject_id, ip_address, details)
+		VALUES (?, ?, ?, ?, ?)`,
+		event.Action, event.ActorID, event.SubjectID, event.IPAddress, details)
+	if err != nil {
+		log.Printf("❌ Failed to record audit event %s: %v", event.Action, err)
+		return
+	}
+	log.Printf("📝 Audit: %s", event.Action)
+}
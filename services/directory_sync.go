@@ -0,0 +1,166 @@
+package services
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"leavemaster/auth"
+	"leavemaster/database"
+	"leavemaster/websocket"
+)
+
+// DirectorySyncResult - Ringkasan satu kali sync
+type DirectorySyncResult struct {
+	DirectoryUsers int      `json:"directory_users"`
+	Matched        int      `json:"matched"`
+	Updated        int      `json:"updated"`
+	Warnings       []string `json:"warnings"`
+}
+
+var directorySyncMutex sync.Mutex
+
+// StartDirectorySync - Sync periodik dari LDAP kalau LDAP_SYNC_INTERVAL diisi (contoh "1h")
+func StartDirectorySync() {
+	raw := os.Getenv("LDAP_SYNC_INTERVAL")
+	if raw == "" || auth.LDAPConfigFromEnv() == nil {
+		return
+	}
+	interval, err := time.ParseDuration(raw)
+	if err != nil || interval < time.Minute {
+		log.Printf("⚠️ Invalid LDAP_SYNC_INTERVAL=%q (minimum 1m), directory sync disabled", raw)
+		return
+	}
+
+	log.Printf("📇 Directory sync every %s", interval)
+	go func() {
+		for {
+			if result, err := SyncDirectory(); err != nil {
+				log.Printf("❌ Directory sync failed: %v", err)
+			} else {
+				log.Printf("📇 Directory sync done - Directory: %d, Matched: %d, Updated: %d, Warnings: %d",
+					result.DirectoryUsers, result.Matched, result.Updated, len(result.Warnings))
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// SyncDirectory - Tarik nama, department dan manager dari direktori ke employees yang aktif.
+// Employee hanya dicocokkan lewat email; employee baru tidak dibuat di sini.
+func SyncDirectory() (DirectorySyncResult, error) {
+	directorySyncMutex.Lock()
+	defer directorySyncMutex.Unlock()
+
+	result := DirectorySyncResult{Warnings: []string{}}
+	users, err := auth.SearchDirectoryUsers(auth.LDAPConfigFromEnv())
+	if err != nil {
+		return result, err
+	}
+	result.DirectoryUsers = len(users)
+
+	departmentIDs, err := departmentIDsByName()
+	if err != nil {
+		return result, err
+	}
+
+	for _, user := range users {
+		var employeeID int
+		var name string
+		var departmentID, managerID sql.NullInt64
+		err := database.DB.QueryRow(`SELECT id, name, department_id, manager_id FROM employees
+			WHERE LOWER(email) = ? AND is_active = TRUE`, user.Email).
+			Scan(&employeeID, &name, &departmentID, &managerID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Matched++
+
+		newName := name
+		if user.Name != "" {
+			newName = user.Name
+		}
+
+		newDepartmentID := departmentID
+		if user.Department != "" {
+			if id, ok := departmentIDs[strings.ToLower(user.Department)]; ok {
+				newDepartmentID = sql.NullInt64{Int64: int64(id), Valid: true}
+			} else {
+				result.Warnings = append(result.Warnings, user.Email+": unknown or archived department "+user.Department)
+			}
+		}
+
+		// Manager dari direktori divalidasi sama seperti edit manual; kalau ditolak
+		// (tidak aktif, diri sendiri, cycle) manager lama dipertahankan
+		newManagerID := managerID
+		if user.ManagerEmail != "" {
+			var id int64
+			err := database.DB.QueryRow("SELECT id FROM employees WHERE LOWER(email) = ?", user.ManagerEmail).Scan(&id)
+			switch {
+			case err == sql.ErrNoRows:
+				result.Warnings = append(result.Warnings, user.Email+": manager "+user.ManagerEmail+" is not an employee")
+			case err != nil:
+				return result, err
+			case !managerID.Valid || managerID.Int64 != id:
+				reason, err := CheckReportingLine(employeeID, int(id))
+				if err != nil {
+					return result, err
+				}
+				if reason != "" {
+					warning := user.Email + ": manager " + user.ManagerEmail + " skipped - " + reason
+					log.Printf("⚠️ Directory sync: %s", warning)
+					result.Warnings = append(result.Warnings, warning)
+				} else {
+					newManagerID = sql.NullInt64{Int64: id, Valid: true}
+				}
+			}
+		}
+
+		if newName == name && newDepartmentID == departmentID && newManagerID == managerID {
+			continue
+		}
+
+		_, err = database.DB.Exec("UPDATE employees SET name = ?, department_id = ?, manager_id = ? WHERE id = ?",
+			newName, newDepartmentID, newManagerID, employeeID)
+		if err != nil {
+			return result, err
+		}
+		result.Updated++
+
+		// department_id ada di claims - token lama harus ditolak
+		if newDepartmentID != departmentID {
+			if err := auth.BumpTokenVersion(employeeID); err != nil {
+				log.Printf("❌ Failed to revoke tokens for employee %d: %v", employeeID, err)
+			}
+			websocket.HubInstance.DisconnectEmployee(employeeID)
+		}
+	}
+
+	return result, nil
+}
+
+// departmentIDsByName - Department yang bisa di-assign (tidak diarsipkan), key nama lowercase
+func departmentIDsByName() (map[string]int, error) {
+	rows, err := database.DB.Query("SELECT id, name FROM departments WHERE is_archived = FALSE")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[string]int{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		ids[strings.ToLower(name)] = id
+	}
+	return ids, rows.Err()
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/resend/resend-go/v2"
 )
@@ -232,6 +233,154 @@ func (es *EmailService) SendLeaveStatusNotification(employeeEmail, employeeName,
 	return nil
 }
 
+// SendPasswordResetEmail - Kirim link reset password. Link tidak pernah ditulis ke log.
+func (es *EmailService) SendPasswordResetEmail(employeeEmail, employeeName, resetURL string, expiresIn time.Duration) error {
+	subject := "🔑 Reset Your LeaveMaster Password"
+	expiry := fmt.Sprintf("%d minutes", int(expiresIn.Minutes()))
+
+	htmlBody := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<style>
+			body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+			.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+			.header { background: #3498db; color: white; padding: 20px; text-align: center; border-radius: 10px 10px 0 0; }
+			.content { background: #f9f9f9; padding: 20px; border-radius: 0 0 10px 10px; }
+			.button { background: #3498db; color: white; padding: 12px 24px; text-decoration: none; border-radius: 5px; display: inline-block; }
+			.footer { text-align: center; margin-top: 20px; color: #666; font-size: 12px; }
+		</style>
+	</head>
+	<body>
+		<div class="container">
+			<div class="header">
+				<h1>📍 LeaveMaster</h1>
+				<p>Password Reset</p>
+			</div>
+			<div class="content">
+				<h2>Hello %s,</h2>
+				<p>We received a request to reset your LeaveMaster password. This link expires in %s and can only be used once.</p>
+
+				<p style="text-align: center;">
+					<a href="%s" class="button">Reset Password</a>
+				</p>
+
+				<p>If you did not request a password reset, you can ignore this email - your password will not change.</p>
+				<p><small>This is an automated notification. Please do not reply to this email.</small></p>
+			</div>
+			<div class="footer">
+				<p>&copy; 2024 LeaveMaster. All rights reserved.</p>
+			</div>
+		</div>
+	</body>
+	</html>
+	`, employeeName, expiry, resetURL)
+
+	textBody := fmt.Sprintf(`
+	Password Reset
+
+	Hello %s,
+
+	We received a request to reset your LeaveMaster password.
+	Open this link within %s to choose a new password (it can only be used once):
+	%s
+
+	If you did not request a password reset, you can ignore this email.
+	`, employeeName, expiry, resetURL)
+
+	params := &resend.SendEmailRequest{
+		From:    es.from,
+		To:      []string{employeeEmail},
+		Subject: subject,
+		Html:    htmlBody,
+		Text:    textBody,
+	}
+
+	_, err := es.client.Emails.Send(params)
+	if err != nil {
+		// Body berisi token reset, jadi jangan fallback ke console
+		fmt.Printf("❌ Password reset email to %s failed: %v\n", employeeEmail, err)
+		return err
+	}
+
+	fmt.Printf("✅ Password reset email sent via Resend to: %s\n", employeeEmail)
+	return nil
+}
+
+// SendInviteEmail - Undangan untuk employee baru (hasil import) memilih password pertamanya
+func (es *EmailService) SendInviteEmail(employeeEmail, employeeName, inviteURL string, expiresIn time.Duration) error {
+	subject := "👋 Welcome to LeaveMaster"
+	expiry := fmt.Sprintf("%d days", int(expiresIn.Hours()/24))
+	if expiresIn < 48*time.Hour {
+		expiry = fmt.Sprintf("%d hours", int(expiresIn.Hours()))
+	}
+
+	htmlBody := fmt.Sprintf(`
+	<!DOCTYPE html>
+	<html>
+	<head>
+		<style>
+			body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
+			.container { max-width: 600px; margin: 0 auto; padding: 20px; }
+			.header { background: #3498db; color: white; padding: 20px; text-align: center; border-radius: 10px 10px 0 0; }
+			.content { background: #f9f9f9; padding: 20px; border-radius: 0 0 10px 10px; }
+			.button { background: #3498db; color: white; padding: 12px 24px; text-decoration: none; border-radius: 5px; display: inline-block; }
+			.footer { text-align: center; margin-top: 20px; color: #666; font-size: 12px; }
+		</style>
+	</head>
+	<body>
+		<div class="container">
+			<div class="header">
+				<h1>📍 LeaveMaster</h1>
+				<p>Your account is ready</p>
+			</div>
+			<div class="content">
+				<h2>Hello %s,</h2>
+				<p>An account has been created for you in LeaveMaster. Choose a password to get started. This link expires in %s and can only be used once.</p>
+
+				<p style="text-align: center;">
+					<a href="%s" class="button">Set Password</a>
+				</p>
+
+				<p><small>This is an automated notification. Please do not reply to this email.</small></p>
+			</div>
+			<div class="footer">
+				<p>&copy; 2024 LeaveMaster. All rights reserved.</p>
+			</div>
+		</div>
+	</body>
+	</html>
+	`, employeeName, expiry, inviteURL)
+
+	textBody := fmt.Sprintf(`
+	Welcome to LeaveMaster
+
+	Hello %s,
+
+	An account has been created for you in LeaveMaster.
+	Open this link within %s to choose your password (it can only be used once):
+	%s
+	`, employeeName, expiry, inviteURL)
+
+	params := &resend.SendEmailRequest{
+		From:    es.from,
+		To:      []string{employeeEmail},
+		Subject: subject,
+		Html:    htmlBody,
+		Text:    textBody,
+	}
+
+	_, err := es.client.Emails.Send(params)
+	if err != nil {
+		// Body berisi token, jadi jangan fallback ke console
+		fmt.Printf("❌ Invite email to %s failed: %v\n", employeeEmail, err)
+		return err
+	}
+
+	fmt.Printf("✅ Invite email sent via Resend to: %s\n", employeeEmail)
+	return nil
+}
+
 func getStatusColor(status string) string {
 	if status == "approved" {
 		return "#2ecc71" // Green
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"database/sql"
+
+	"leavemaster/database"
+)
+
+// CheckReportingLine - Validasi manager_id baru untuk employee (employeeID 0 = employee baru).
+// Return alasan penolakan (kosong kalau valid): manager harus employee aktif lain, dan
+// employee tidak boleh muncul di rantai manager di atasnya (cycle).
+func CheckReportingLine(employeeID, managerID int) (string, error) {
+	if employeeID != 0 && managerID == employeeID {
+		return "An employee cannot be their own manager", nil
+	}
+
+	active, _, err := reportingLineOf(managerID)
+	if err == sql.ErrNoRows {
+		return "Manager not found", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !active {
+		return "Manager is not active", nil
+	}
+	if employeeID == 0 {
+		return "", nil
+	}
+
+	// Naik dari manager baru sampai puncak; kalau ketemu employee ini berarti cycle.
+	// seen menjaga dari cycle lama di data yang sudah ada.
+	seen := map[int]bool{}
+	for current := managerID; ; {
+		if current == employeeID {
+			return "Reporting line would form a cycle", nil
+		}
+		if seen[current] {
+			return "", nil
+		}
+		seen[current] = true
+
+		_, next, err := reportingLineOf(current)
+		if err == sql.ErrNoRows || (err == nil && next == nil) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		current = *next
+	}
+}
+
+// reportingLineOf - Status aktif dan manager_id satu employee (sql.ErrNoRows kalau tidak ada).
+// Bisa diganti di test supaya tidak butuh database.
+var reportingLineOf = func(employeeID int) (active bool, managerID *int, err error) {
+	err = database.DB.QueryRow("SELECT is_active, manager_id FROM employees WHERE id = ?", employeeID).
+		Scan(&active, &managerID)
+	return active, managerID, err
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+type testEmployee struct {
+	active    bool
+	managerID *int
+}
+
+func useReportingLines(t *testing.T, employees map[int]testEmployee) {
+	original := reportingLineOf
+	reportingLineOf = func(id int) (bool, *int, error) {
+		if id == 99 {
+			return false, nil, errors.New("connection lost")
+		}
+		employee, ok := employees[id]
+		if !ok {
+			return false, nil, sql.ErrNoRows
+		}
+		return employee.active, employee.managerID, nil
+	}
+	t.Cleanup(func() { reportingLineOf = original })
+}
+
+func managedBy(id int) *int { return &id }
+
+func TestCheckReportingLine(t *testing.T) {
+	// 1 <- 2 <- 3 <- 4, 5 tidak aktif, 6 <-> 7 cycle lama di data, 8 melapor ke employee yang sudah dihapus
+	useReportingLines(t, map[int]testEmployee{
+		1: {active: true},
+		2: {active: true, managerID: managedBy(1)},
+		3: {active: true, managerID: managedBy(2)},
+		4: {active: true, managerID: managedBy(3)},
+		5: {active: false, managerID: managedBy(1)},
+		6: {active: true, managerID: managedBy(7)},
+		7: {active: true, managerID: managedBy(6)},
+		8: {active: true, managerID: managedBy(42)},
+	})
+
+	cases := []struct {
+		name                  string
+		employeeID, managerID int
+		want                  string
+	}{
+		{"new employee under active manager", 0, 3, ""},
+		{"new employee under inactive manager", 0, 5, "Manager is not active"},
+		{"new employee under unknown manager", 0, 42, "Manager not found"},
+		{"move up the chain", 4, 1, ""},
+		{"move to another branch", 2, 8, ""},
+		{"self management", 3, 3, "An employee cannot be their own manager"},
+		{"direct cycle", 2, 3, "Reporting line would form a cycle"},
+		{"deep cycle", 1, 4, "Reporting line would form a cycle"},
+		{"inactive manager", 4, 5, "Manager is not active"},
+		{"existing cycle above does not loop forever", 1, 6, ""},
+		{"keeping an existing cycle is rejected", 6, 7, "Reporting line would form a cycle"},
+	}
+	for _, tc := range cases {
+		got, err := CheckReportingLine(tc.employeeID, tc.managerID)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %q, %v; want %q", tc.name, got, err, tc.want)
+		}
+	}
+
+	if _, err := CheckReportingLine(2, 99); err == nil {
+		t.Error("expected database error to be returned")
+	}
+}
@@ -3,6 +3,7 @@ package websocket
 import (
 	"encoding/json"
 	"fmt"
+	"leavemaster/auth"
 	"leavemaster/database"
 	"log"
 	"net/http"
@@ -134,24 +135,28 @@ func (c *Client) WritePump() {
 }
 
 func HandleWebSocket(c *gin.Context) {
+	// Identitas di-set oleh WebSocketAuth; tanpa itu koneksi tidak punya pemilik
+	identity, ok := auth.CurrentIdentity(c)
+	if !ok || identity.EmployeeID == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "WebSocket token required"})
+		return
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Println("❌ WebSocket upgrade error:", err)
 		return
 	}
 
-	employeeID, _ := c.Get("employeeID")
-	isManager, _ := c.Get("isManager")
-
-	log.Printf("✅ New WebSocket connection - EmployeeID: %d, IsManager: %t", employeeID, isManager)
+	log.Printf("✅ New WebSocket connection - EmployeeID: %d, IsManager: %t", identity.EmployeeID, identity.IsManager)
 	log.Printf("🌐 Connection from: %s", c.Request.RemoteAddr)
 
 	client := &Client{
-		ID:        employeeID.(int),
+		ID:        identity.EmployeeID,
 		Conn:      conn,
 		Hub:       HubInstance,
 		Send:      make(chan []byte, 256),
-		IsManager: isManager.(bool),
+		IsManager: identity.IsManager,
 	}
 
 	client.Hub.Register <- client
@@ -160,6 +165,15 @@ func HandleWebSocket(c *gin.Context) {
 	go client.ReadPump()
 }
 
+// deliversTo - Notifikasi dengan TargetID hanya untuk employee itu (semua koneksinya);
+// tanpa TargetID dibagi per ForManager
+func (n Notification) deliversTo(client *Client) bool {
+	if n.TargetID > 0 {
+		return client.ID == n.TargetID
+	}
+	return n.ForManager == client.IsManager
+}
+
 // PERBAIKAN: Function SendNotification yang lebih spesifik
 func SendNotification(notification Notification) {
 	message, err := json.Marshal(notification)
@@ -179,20 +193,8 @@ func SendNotification(notification Notification) {
 		notification.Type, notification.ForManager, notification.TargetID)
 
 	for client := range HubInstance.Clients {
-		shouldSend := false
-
-		if notification.ForManager && client.IsManager {
-			shouldSend = true
-			log.Printf("   → Sending to MANAGER ID: %d", client.ID)
-		} else if !notification.ForManager && !client.IsManager {
-			shouldSend = true
-			log.Printf("   → Sending to EMPLOYEE ID: %d", client.ID)
-		} else if notification.TargetID > 0 && client.ID == notification.TargetID {
-			shouldSend = true
-			log.Printf("   → Sending to TARGET ID: %d", client.ID)
-		}
-
-		if shouldSend {
+		if notification.deliversTo(client) {
+			log.Printf("   → Sending to client ID: %d", client.ID)
 			select {
 			case client.Send <- message:
 				sentCount++
@@ -228,6 +230,48 @@ func SendNewLeaveRequestNotification(employeeName, leaveType, startDate, endDate
 	SendNotificationToDepartmentManagers(notification, departmentID)
 }
 
+// Function untuk amendment leave yang sudah approved - HANYA ke manager department
+func SendLeaveAmendmentNotification(employeeName, leaveType, startDate, endDate string, departmentID int) {
+	notification := Notification{
+		Type:       "leave_amendment_request",
+		Message:    fmt.Sprintf("%s wants to change an approved leave request", employeeName),
+		ForManager: true,
+		Data: map[string]interface{}{
+			"employee_name": employeeName,
+			"leave_type":    leaveType,
+			"start_date":    startDate,
+			"end_date":      endDate,
+			"department_id": departmentID,
+			"timestamp":     time.Now().Format(time.RFC3339),
+		},
+	}
+
+	log.Printf("📝 Sending LEAVE AMENDMENT notification for employee: %s (Dept: %d)", employeeName, departmentID)
+	SendNotificationToDepartmentManagers(notification, departmentID)
+}
+
+// DisconnectEmployee - Tutup semua koneksi WebSocket milik employee (token-nya sudah di-revoke)
+func (h *Hub) DisconnectEmployee(employeeID int) int {
+	h.Mutex.Lock()
+	defer h.Mutex.Unlock()
+
+	disconnected := 0
+	for client := range h.Clients {
+		if client.ID != employeeID {
+			continue
+		}
+		// Menutup Send membuat WritePump kirim close frame lalu menutup koneksi
+		delete(h.Clients, client)
+		close(client.Send)
+		disconnected++
+	}
+
+	if disconnected > 0 {
+		log.Printf("🔒 Disconnected %d WebSocket client(s) for employee %d", disconnected, employeeID)
+	}
+	return disconnected
+}
+
 // New Func to send notification to manager
 func SendNotificationToDepartmentManagers(notification Notification, departmentID int) {
 	message, err := json.Marshal(notification)
@@ -0,0 +1,67 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNotificationDeliversTo(t *testing.T) {
+	employee := &Client{ID: 5}
+	otherEmployee := &Client{ID: 6}
+	manager := &Client{ID: 7, IsManager: true}
+
+	cases := []struct {
+		name         string
+		notification Notification
+		client       *Client
+		want         bool
+	}{
+		{"target receives", Notification{TargetID: 5}, employee, true},
+		{"other employee skipped", Notification{TargetID: 5}, otherEmployee, false},
+		{"manager skipped", Notification{TargetID: 5}, manager, false},
+		{"targeted manager receives", Notification{TargetID: 7}, manager, true},
+		{"manager broadcast", Notification{ForManager: true}, manager, true},
+		{"manager broadcast skips employee", Notification{ForManager: true}, employee, false},
+		{"employee broadcast", Notification{}, otherEmployee, true},
+		{"employee broadcast skips manager", Notification{}, manager, false},
+	}
+	for _, tc := range cases {
+		if got := tc.notification.deliversTo(tc.client); got != tc.want {
+			t.Errorf("%s: got %t, want %t", tc.name, got, tc.want)
+		}
+	}
+}
+
+// Status approve/reject berisi nama dan jenis cuti: hanya pemilik request yang menerima
+func TestLeaveStatusNotificationOnlyReachesTarget(t *testing.T) {
+	target := &Client{ID: 5, Send: make(chan []byte, 1)}
+	targetOtherTab := &Client{ID: 5, Send: make(chan []byte, 1)}
+	colleague := &Client{ID: 6, Send: make(chan []byte, 1)}
+	manager := &Client{ID: 7, IsManager: true, Send: make(chan []byte, 1)}
+
+	original := HubInstance
+	HubInstance = NewHub()
+	t.Cleanup(func() { HubInstance = original })
+	for _, client := range []*Client{target, targetOtherTab, colleague, manager} {
+		HubInstance.Clients[client] = true
+	}
+
+	SendLeaveStatusNotification("Jane Doe", "approved", "Sick Leave", 5)
+
+	for _, client := range []*Client{target, targetOtherTab} {
+		select {
+		case message := <-client.Send:
+			var n Notification
+			if err := json.Unmarshal(message, &n); err != nil || n.Type != "leave_approved" || n.TargetID != 5 {
+				t.Errorf("unexpected notification %s (%v)", message, err)
+			}
+		default:
+			t.Errorf("client %d did not receive its status notification", client.ID)
+		}
+	}
+	for _, client := range []*Client{colleague, manager} {
+		if len(client.Send) != 0 {
+			t.Errorf("client %d received another employee's status notification", client.ID)
+		}
+	}
+}